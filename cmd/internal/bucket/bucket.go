@@ -0,0 +1,33 @@
+/*
+Package bucket opens the file storage the commands read templates from, either a local directory or any
+[gocloud blob URL] supported by the registered drivers.
+
+[gocloud blob URL]: https://gocloud.dev/concepts/urls/
+*/
+package bucket
+
+import (
+	"context"
+	"gocloud.dev/blob"
+	"path/filepath"
+	"strings"
+)
+
+import (
+	_ "gocloud.dev/blob/fileblob"
+	_ "gocloud.dev/blob/gcsblob"
+	_ "gocloud.dev/blob/s3blob"
+)
+
+// Open opens a blob URL or, when location has no scheme, a local directory.
+func Open(ctx context.Context, location string) (*blob.Bucket, error) {
+	if strings.Contains(location, "://") {
+		return blob.OpenBucket(ctx, location)
+	}
+
+	dir, err := filepath.Abs(location)
+	if err != nil {
+		return nil, err
+	}
+	return blob.OpenBucket(ctx, "file://"+filepath.ToSlash(dir))
+}
@@ -0,0 +1,70 @@
+/*
+Package main lints every email template in a blob bucket so template mistakes are caught in CI rather than when an
+event arrives. Templates are parsed with the same engines and template functions used to send emails and, when a
+sample data fixture exists next to the template i.e. welcome.html -> welcome.fixture.json, checked for missing and
+unused variables, render errors, and broken href/src links.
+
+	go run ./cmd/lint -templates gs://my-bucket -prefix emails/
+
+The report is written to stdout as JSON and the command exits with status 1 when any issue is an error.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"github.com/itmayziii/email/cmd/internal/bucket"
+	"github.com/itmayziii/email/send"
+	"log"
+	"os"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+// run lints the templates and returns the exit code, 1 when a template has errors and 2 when linting failed.
+func run() int {
+	templates := flag.String("templates", ".", "local directory or blob URL templates are read from")
+	prefix := flag.String("prefix", "", "only lint templates starting with the prefix")
+	remote := flag.Bool("remote-links", false, "check http(s) links by making requests to them")
+	markdownLayout := flag.String("markdown-layout", "", "path of the layout markdown is wrapped in")
+	inlineCSS := flag.Bool("inline-css", false, "inline CSS into style attributes before checking links")
+	flag.Parse()
+
+	ctx := context.Background()
+	fileStorage, err := bucket.Open(ctx, *templates)
+	if err != nil {
+		log.Printf("failed to open templates %s - %v", *templates, err)
+		return 2
+	}
+	defer func() {
+		if err := fileStorage.Close(); err != nil {
+			log.Printf("failed to close templates - %v", err)
+		}
+	}()
+
+	appOpts := []send.AppOption{send.AppWithFileStorage(fileStorage), send.AppWithMarkdownLayout(*markdownLayout)}
+	if *inlineCSS {
+		appOpts = append(appOpts, send.AppWithInlineCSS())
+	}
+	app := send.NewApp(appOpts...)
+
+	report, err := send.LintTemplates(ctx, app, send.LintOptions{Prefix: *prefix, CheckRemoteLinks: *remote})
+	if err != nil {
+		log.Printf("failed to lint templates - %v", err)
+		return 2
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Printf("failed to write report - %v", err)
+		return 2
+	}
+	if report.HasErrors() {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,307 @@
+/*
+Package main renders an email template with sample data so it can be previewed without sending a CloudEvent. The
+template is rendered the same way as an email being sent, including the template engine, functions, markdown
+layouts, and CSS inlining.
+
+Write the rendered email to files:
+
+	go run ./cmd/preview -templates ./templates -template welcome.html -data welcome.json -out welcome
+
+Or serve it on a local preview page which reloads whenever the template, the partials, stylesheets, and schemas it
+depends on, or the data changes:
+
+	go run ./cmd/preview -templates gs://my-bucket -template welcome.html -data welcome.json -serve :8081
+
+The -templates flag accepts a local directory or any [gocloud blob URL], the data file is a JSON object of template
+variables.
+
+[gocloud blob URL]: https://gocloud.dev/concepts/urls/
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/itmayziii/email/cmd/internal/bucket"
+	"github.com/itmayziii/email/send"
+	"gocloud.dev/blob"
+	htmlTemplate "html/template"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// pollInterval is how often the template and data are checked for changes when serving the preview page.
+const pollInterval = time.Second
+
+type options struct {
+	templates      string
+	template       string
+	data           string
+	engine         string
+	subject        string
+	markdownLayout string
+	inlineCSS      bool
+	out            string
+	serve          string
+}
+
+func main() {
+	os.Exit(run())
+}
+
+// run renders or serves the preview and returns the exit code, 2 when the flags are invalid and 1 when it failed.
+func run() int {
+	var opts options
+	flag.StringVar(&opts.templates, "templates", ".", "local directory or blob URL templates are read from")
+	flag.StringVar(&opts.template, "template", "", "path of the template to render, relative to -templates")
+	flag.StringVar(&opts.data, "data", "", "path to a JSON file of template variables")
+	flag.StringVar(&opts.engine, "engine", "", "template engine to use, defaults to choosing by file extension")
+	flag.StringVar(&opts.subject, "subject", "Preview", "email subject, available to markdown layouts")
+	flag.StringVar(&opts.markdownLayout, "markdown-layout", "", "path of the layout markdown is wrapped in")
+	flag.BoolVar(&opts.inlineCSS, "inline-css", false, "inline CSS into style attributes")
+	flag.StringVar(&opts.out, "out", "", "write <out>.html and <out>.txt instead of printing to stdout")
+	flag.StringVar(&opts.serve, "serve", "", "address to serve a live reloading preview page on i.e. :8081")
+	flag.Parse()
+
+	if opts.template == "" {
+		log.Printf("missing -template")
+		flag.Usage()
+		return 2
+	}
+
+	ctx := context.Background()
+	fileStorage, err := bucket.Open(ctx, opts.templates)
+	if err != nil {
+		log.Printf("failed to open templates %s - %v", opts.templates, err)
+		return 1
+	}
+	defer func() {
+		if err := fileStorage.Close(); err != nil {
+			log.Printf("failed to close templates - %v", err)
+		}
+	}()
+
+	if opts.serve != "" {
+		if err := serve(fileStorage, opts); err != nil {
+			log.Printf("failed to serve preview - %v", err)
+			return 1
+		}
+		return 0
+	}
+
+	body, err := render(ctx, fileStorage, opts)
+	if err != nil {
+		log.Printf("failed to render %s - %v", opts.template, err)
+		return 1
+	}
+	if err := write(body, opts.out); err != nil {
+		log.Printf("failed to write output - %v", err)
+		return 1
+	}
+	return 0
+}
+
+// previewEmail is the sender and recipient of the rendered email, nothing is sent to it.
+const previewEmail = "preview@example.com"
+
+// render reads the template data and renders the template with [send.App.Render], the same pipeline used to send
+// emails, so the data is also validated against the template schema.
+func render(ctx context.Context, fileStorage *blob.Bucket, opts options) (send.Body, error) {
+	data, err := readData(opts.data)
+	if err != nil {
+		return send.Body{}, err
+	}
+
+	appOpts := []send.AppOption{
+		send.AppWithFileStorage(fileStorage),
+		send.AppWithMarkdownLayout(opts.markdownLayout),
+		send.AppWithDomainSender("example.com", send.NoopSender{}),
+	}
+	if opts.inlineCSS {
+		appOpts = append(appOpts, send.AppWithInlineCSS())
+	}
+	app := send.NewApp(appOpts...)
+
+	results, err := app.Render(ctx, send.EventData{
+		Sender:   previewEmail,
+		Subject:  opts.subject,
+		To:       send.MessageTo{previewEmail},
+		Template: opts.template,
+		Engine:   opts.engine,
+		Data:     data,
+	})
+	if err != nil {
+		return send.Body{}, err
+	}
+	return send.Body{HTML: results[0].Message.Body, Text: results[0].Message.Text}, nil
+}
+
+// readData reads a JSON object of template variables, no file means no variables.
+func readData(file string) (map[string]interface{}, error) {
+	if file == "" {
+		return nil, nil
+	}
+
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(contents, &data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s - %v", file, err)
+	}
+
+	return data, nil
+}
+
+// write writes the HTML and text to <out>.html and <out>.txt or to stdout when out is empty.
+func write(body send.Body, out string) error {
+	if out == "" {
+		if body.HTML != "" {
+			fmt.Println(body.HTML)
+		}
+		if body.Text != "" {
+			fmt.Println(body.Text)
+		}
+		return nil
+	}
+
+	if body.HTML != "" {
+		if err := os.WriteFile(out+".html", []byte(body.HTML), 0o644); err != nil {
+			return err
+		}
+	}
+	if body.Text != "" {
+		if err := os.WriteFile(out+".txt", []byte(body.Text), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var previewPage = htmlTemplate.Must(htmlTemplate.New("preview").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ .Template }}</title>
+<style>
+body { margin: 0; font-family: sans-serif; }
+header { padding: 8px 16px; background: #eee; }
+iframe { width: 100%; height: 70vh; border: 0; }
+pre { padding: 16px; white-space: pre-wrap; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<header>{{ .Template }} - {{ .Rendered }}</header>
+{{ if .Error }}<pre class="error">{{ .Error }}</pre>{{ end }}
+{{ if .Body.HTML }}<iframe srcdoc="{{ .Body.HTML }}"></iframe>{{ end }}
+{{ if .Body.Text }}<pre>{{ .Body.Text }}</pre>{{ end }}
+<script>new EventSource("/events").onmessage = function () { location.reload(); };</script>
+</body>
+</html>`))
+
+// serve renders the template on every request to "/" and notifies the page through server sent events at "/events"
+// whenever the template or data changes so the page reloads itself.
+func serve(fileStorage *blob.Bucket, opts options) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		body, err := render(r.Context(), fileStorage, opts)
+		page := struct {
+			Template string
+			Rendered string
+			Body     send.Body
+			Error    string
+		}{Template: opts.template, Rendered: time.Now().Format(time.Kitchen), Body: body}
+		if err != nil {
+			page.Error = err.Error()
+		}
+		if err := previewPage.Execute(w, page); err != nil {
+			log.Printf("failed to write preview page - %v", err)
+		}
+	})
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		flusher.Flush()
+
+		last := fingerprint(r.Context(), fileStorage, opts)
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ticker.C:
+				current := fingerprint(r.Context(), fileStorage, opts)
+				if current == last {
+					continue
+				}
+				last = current
+				if _, err := fmt.Fprint(w, "data: reload\n\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	})
+
+	log.Printf("previewing %s on http://%s", opts.template, previewAddress(opts.serve))
+	return http.ListenAndServe(opts.serve, mux)
+}
+
+// fingerprint identifies the current version of the files that make up the preview by their modification times.
+// Every file the template and markdown layout depend on is included, so editing a partial, stylesheet, or schema
+// reloads the preview too.
+func fingerprint(ctx context.Context, fileStorage *blob.Bucket, opts options) string {
+	app := send.NewApp(send.AppWithFileStorage(fileStorage))
+	var parts []string
+	for _, name := range []string{opts.template, opts.markdownLayout} {
+		if name == "" {
+			continue
+		}
+		files, err := send.TemplateFiles(ctx, app, name)
+		if err != nil {
+			// The template is broken, i.e. a partial is missing, the template itself is still watched so fixing it
+			// reloads the preview.
+			files = []string{name}
+			parts = append(parts, err.Error())
+		}
+		for _, file := range files {
+			if attrs, err := fileStorage.Attributes(ctx, file); err == nil {
+				parts = append(parts, file, attrs.ModTime.String(), attrs.ETag)
+			}
+		}
+	}
+	if opts.data != "" {
+		if info, err := os.Stat(opts.data); err == nil {
+			parts = append(parts, info.ModTime().String())
+		}
+	}
+
+	return strings.Join(parts, "|")
+}
+
+// previewAddress turns a listen address like ":8081" into something that can be visited in a browser.
+func previewAddress(addr string) string {
+	if strings.HasPrefix(addr, ":") {
+		return "localhost" + addr
+	}
+
+	return addr
+}
@@ -12,6 +12,7 @@ import (
 	"gocloud.dev/blob"
 	"log"
 	"os"
+	"time"
 )
 
 import (
@@ -19,6 +20,9 @@ import (
 	_ "gocloud.dev/blob/fileblob"
 )
 
+// scheduleInterval is how often scheduled emails are checked to see if they are due.
+const scheduleInterval = 10 * time.Second
+
 func main() {
 	ctx := context.Background()
 	if err := funcframework.RegisterCloudEventFunctionContext(ctx, "/", emailEvent(ctx)); err != nil {
@@ -52,7 +56,11 @@ func emailEvent(ctx context.Context) func(context.Context, cloudevents.Event) er
 		send.AppWithErrorLogger(errorLogger),
 		send.AppWithFileStorage(bucket),
 		send.AppWithDomainSender("example.com", send.NoopSender{}),
+		send.AppWithScheduleStore(send.NewBlobScheduleStore(bucket, "scheduled/")),
 	)
+	go func() {
+		_ = send.RunScheduleDispatcher(ctx, app, scheduleInterval)
+	}()
 
 	return send.EmailEvent(app)
 }
@@ -0,0 +1,87 @@
+/*
+Package main publishes and rolls back versions of email templates. Publishing copies the working copy of a template,
+and the partials, stylesheets, and schemas it depends on, to the next version and marks it as latest so events referencing "welcome.html@latest" use it, while events pinned to
+a version i.e. "welcome.html@v3" are unaffected.
+
+	go run ./cmd/templates -templates gs://my-bucket publish emails/welcome.html
+	go run ./cmd/templates -templates gs://my-bucket rollback emails/welcome.html [version]
+	go run ./cmd/templates -templates gs://my-bucket versions emails/welcome.html
+
+Rolling back without a version marks the version published before the current latest version as latest.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/itmayziii/email/cmd/internal/bucket"
+	"github.com/itmayziii/email/send"
+	"log"
+	"os"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+// run runs the command and returns the exit code, 2 when the command is invalid and 1 when it failed.
+func run() int {
+	templates := flag.String("templates", ".", "local directory or blob URL templates are read from")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: templates [flags] publish|rollback|versions <template> [version]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) < 2 {
+		flag.Usage()
+		return 2
+	}
+	command, template := args[0], args[1]
+
+	ctx := context.Background()
+	fileStorage, err := bucket.Open(ctx, *templates)
+	if err != nil {
+		log.Printf("failed to open templates %s - %v", *templates, err)
+		return 1
+	}
+	defer func() {
+		if err := fileStorage.Close(); err != nil {
+			log.Printf("failed to close templates - %v", err)
+		}
+	}()
+	app := send.NewApp(send.AppWithFileStorage(fileStorage))
+
+	var result interface{}
+	switch command {
+	case "publish":
+		result, err = send.PublishTemplate(ctx, app, template)
+	case "rollback":
+		version := ""
+		if len(args) > 2 {
+			version = args[2]
+		}
+		result, err = send.RollbackTemplate(ctx, app, template, version)
+	case "versions":
+		result, err = send.ReadTemplateManifest(ctx, app, template)
+	default:
+		log.Printf("unknown command \"%s\"", command)
+		flag.Usage()
+		return 2
+	}
+	if err != nil {
+		log.Printf("failed to %s %s - %v", command, template, err)
+		return 1
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		log.Printf("failed to write result - %v", err)
+		return 1
+	}
+	return 0
+}
@@ -3,13 +3,16 @@ package send
 import (
 	"gocloud.dev/blob"
 	"gocloud.dev/blob/memblob"
+	htmlTemplate "html/template"
 	"io"
 	"log"
+	"net/http"
+	"strings"
 )
 
 // App defines the dependencies the application uses.
 type App struct {
-	// flusher provides an opportunity to flush any buffers prior to the [EmailEvent] function ending.
+	// flusher provides an opportunity to flush any buffers prior to the [EmailEvent] function, or [App.Send], ending.
 	flusher Flusher
 	// infoLogger is meant to log "info" severity related events. This is a log.Logger instance because nobody can
 	// agree on what a logging interface should look like so the easiest decision for this package to make is to rely
@@ -30,6 +33,56 @@ type App struct {
 	// This allows flexibility to choose how to send emails per domain. A [Sender] is chosen from this map based on
 	// the [Sender] email address. i.e. no-reply@google.com -> google.com is the domain.
 	domainSenders map[string]Sender
+	// templateFuncs are the functions available to email templates. The [defaultTemplateFuncs] are always available
+	// and can be overridden or added to with [AppWithTemplateFuncs].
+	templateFuncs htmlTemplate.FuncMap
+	// templateEngines maps engine names to [TemplateEngine] implementations used to render email bodies.
+	templateEngines map[string]TemplateEngine
+	// templateExtensions maps template file extensions i.e. ".mustache" to engine names in templateEngines.
+	templateExtensions map[string]string
+	// inlineCSS moves CSS from <style> elements and linked stylesheets into style attributes after an HTML email body
+	// is rendered.
+	inlineCSS bool
+	// markdownLayout is the path in fileStorage of the HTML layout markdown email bodies are wrapped in.
+	markdownLayout string
+	// batchConcurrency is the maximum number of emails sent at the same time for an event with
+	// [EventData.Recipients].
+	batchConcurrency int
+	// scheduleStore persists emails with [EventData.SendAt] until they are due to be sent.
+	scheduleStore ScheduleStore
+	// suppressionStore keeps the email addresses emails should no longer be sent to.
+	suppressionStore SuppressionStore
+	// sendLog records what happened to every email that was sent.
+	sendLog SendLog
+	// unsubscribe configures the signed unsubscribe links added to emails.
+	unsubscribe *unsubscribeConfig
+	// resultPublisher publishes a CloudEvent after every email is sent or fails to send.
+	resultPublisher ResultPublisher
+	// resultSource is the CloudEvent source of the events published by resultPublisher.
+	resultSource string
+	// sandbox rewrites the recipients of every email in non-production environments.
+	sandbox *Sandbox
+	// dryRun renders and routes every email without sending it.
+	dryRun bool
+	// eventDecoders maps CloudEvent types to the [EventDecoder] which unwraps [EventData] from the event data.
+	eventDecoders map[string]EventDecoder
+	// attributeMapping maps [EventData.Attributes] to the [EventData] fields they set.
+	attributeMapping map[string]string
+	// pubSubSchemas maps Pub/Sub schema names to the content type of binary encoded messages.
+	pubSubSchemas map[string]string
+	// eventConcurrency is how many events of a batch are handled at the same time.
+	eventConcurrency int
+	// idempotencyStore saves the responses of [MessagesHandler] by Idempotency-Key and the results of sent emails by
+	// [EventData.IdempotencyKey].
+	idempotencyStore IdempotencyStore
+	// sendClaims are the idempotency keys of emails being sent.
+	sendClaims *sendClaims
+	// schemaClient fetches JSON Schemas from http(s) URLs.
+	schemaClient *http.Client
+	// schemaHosts are the lower case hosts JSON Schemas may be fetched from.
+	schemaHosts map[string]bool
+	// schemas caches compiled JSON Schemas.
+	schemas *schemaCache
 }
 
 // NewApp is a constructor for [App] which utilizes the [options pattern].
@@ -37,7 +90,19 @@ type App struct {
 // [options pattern]: https://dave.cheney.net/2014/10/17/functional-options-for-friendly-apis
 func NewApp(opts ...AppOption) *App {
 	app := &App{
-		domainSenders: make(map[string]Sender),
+		domainSenders:      make(map[string]Sender),
+		templateFuncs:      defaultTemplateFuncs(),
+		templateEngines:    defaultTemplateEngines(),
+		templateExtensions: defaultTemplateExtensions(),
+		batchConcurrency:   defaultBatchConcurrency,
+		eventDecoders:      defaultEventDecoders(),
+		attributeMapping:   defaultAttributeMapping(),
+		pubSubSchemas:      make(map[string]string),
+		eventConcurrency:   defaultEventConcurrency,
+		schemaClient:       &http.Client{Timeout: defaultSchemaTimeout},
+		schemaHosts:        make(map[string]bool),
+		schemas:            newSchemaCache(),
+		sendClaims:         newSendClaims(),
 	}
 
 	for _, opt := range opts {
@@ -58,7 +123,11 @@ func NewApp(opts ...AppOption) *App {
 	}
 
 	if app.fileStorage == nil {
-		memblob.OpenBucket(nil)
+		app.fileStorage = memblob.OpenBucket(nil)
+	}
+
+	if app.idempotencyStore == nil {
+		app.idempotencyStore = NewMemoryIdempotencyStore(defaultIdempotencyTTL)
 	}
 
 	return app
@@ -116,3 +185,218 @@ func AppWithDomainSender(domain string, sender Sender) AppOption {
 		app.domainSenders[domain] = sender
 	}
 }
+
+// AppWithTemplateFuncs provides an option to register custom functions to use in email templates. Functions with the
+// same name as one of the built-in functions will replace the built-in function. Functions must follow the
+// [Go template function] rules.
+//
+// [Go template function]: https://pkg.go.dev/text/template#hdr-Functions
+func AppWithTemplateFuncs(funcs htmlTemplate.FuncMap) AppOption {
+	return func(app *App) {
+		for name, fn := range funcs {
+			app.templateFuncs[name] = fn
+		}
+	}
+}
+
+// AppWithTemplateEngine registers a [TemplateEngine] under a name which events can select with [EventData.Engine].
+// Templates with any of the provided file extensions i.e. ".hbs" will also use the engine. Registering an engine with
+// the same name as a built-in engine, [HTMLEngine], [TextEngine], or [MustacheEngine], replaces the built-in engine.
+func AppWithTemplateEngine(name string, engine TemplateEngine, extensions ...string) AppOption {
+	return func(app *App) {
+		app.templateEngines[name] = engine
+		for _, ext := range extensions {
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			app.templateExtensions[strings.ToLower(ext)] = name
+		}
+	}
+}
+
+// AppWithInlineCSS provides an option to inline CSS into the style attribute of elements after an HTML email body is
+// rendered. Rules are taken from <style> elements and <link rel="stylesheet"> elements whose href points to a file in
+// the [AppWithFileStorage] file storage, relative to the template. Media queries and rules that can not be inlined,
+// such as :hover, are kept in the head for the email clients that support them.
+func AppWithInlineCSS() AppOption {
+	return func(app *App) {
+		app.inlineCSS = true
+	}
+}
+
+// AppWithMarkdownLayout provides an option to wrap markdown email bodies in an HTML layout read from the
+// [AppWithFileStorage] file storage. The layout is a [Go HTML template] which has access to the markdown converted
+// to HTML as {{ .Content }}, the email subject as {{ .Subject }}, and the same variables as the markdown.
+//
+// [Go HTML template]: https://pkg.go.dev/html/template
+func AppWithMarkdownLayout(layout string) AppOption {
+	return func(app *App) {
+		app.markdownLayout = layout
+	}
+}
+
+// AppWithBatchConcurrency provides an option to limit how many emails are sent at the same time for an event with
+// [EventData.Recipients]. Values less than 1 are ignored.
+func AppWithBatchConcurrency(concurrency int) AppOption {
+	return func(app *App) {
+		if concurrency > 0 {
+			app.batchConcurrency = concurrency
+		}
+	}
+}
+
+// AppWithScheduleStore provides an option to save emails with [EventData.SendAt] to a [ScheduleStore] until they are
+// due. Scheduled emails are sent by [DispatchScheduledEmails] or [RunScheduleDispatcher] and can be canceled with
+// [CancelScheduledEmail].
+func AppWithScheduleStore(store ScheduleStore) AppOption {
+	return func(app *App) {
+		app.scheduleStore = store
+	}
+}
+
+// AppWithSuppressionStore provides an option to check a [SuppressionStore] before every email is sent. Suppressed
+// addresses are removed from the email and the email is not sent when no [EventData.To] or [EventData.Recipients] are
+// left.
+func AppWithSuppressionStore(store SuppressionStore) AppOption {
+	return func(app *App) {
+		app.suppressionStore = store
+	}
+}
+
+// AppWithSendLog provides an option to record a [DeliveryEvent] in a [SendLog] for every email sent and for every
+// event reported by the email provider with [RecordDelivery].
+func AppWithSendLog(sendLog SendLog) AppOption {
+	return func(app *App) {
+		app.sendLog = sendLog
+	}
+}
+
+// AppWithUnsubscribe provides an option to add signed unsubscribe links to emails. The baseURL is where
+// [UnsubscribeHandler] is served and the secret signs the link tokens so they can not be forged. Emails with an
+// [EventData.Category] and a single [EventData.To] get the List-Unsubscribe and List-Unsubscribe-Post headers for
+// one-click unsubscribes, and templates can link to the unsubscribe page with the unsubscribeURL function.
+func AppWithUnsubscribe(baseURL string, secret []byte) AppOption {
+	return func(app *App) {
+		app.unsubscribe = &unsubscribeConfig{baseURL: baseURL, secret: secret}
+	}
+}
+
+// AppWithResultPublisher provides an option to publish an "email.sent" or "email.failed" CloudEvent, with the source,
+// after every email is sent or fails to send so downstream systems know what happened to the event which requested
+// it. The subject of a result event is the id of the requesting event and the data is a [SendResult].
+func AppWithResultPublisher(publisher ResultPublisher, source string) AppOption {
+	return func(app *App) {
+		app.resultPublisher = publisher
+		app.resultSource = source
+	}
+}
+
+// AppWithSandbox provides an option to keep non-production environments from emailing real people. The [Sandbox]
+// rewrites the to, cc, and bcc of every email, right before it is sent, to the catch-all address or removes recipients
+// which are not allowed. Rewritten emails have the original recipients in the X-Original-To header and a banner at the
+// top of the body, and every rewrite is logged to the info logger.
+func AppWithSandbox(sandbox Sandbox) AppOption {
+	return func(app *App) {
+		app.sandbox = &sandbox
+	}
+}
+
+// AppWithDryRun provides an option to handle every event as a dry run, see [DryRun]. Emails are extracted, validated,
+// rendered, and routed to a [Sender] as usual, then logged to the info logger rather than sent. A single event can
+// be handled as a dry run with the [DryRunExtension] instead.
+func AppWithDryRun() AppOption {
+	return func(app *App) {
+		app.dryRun = true
+	}
+}
+
+// AppWithEventDecoder provides an option to extract [EventData] from CloudEvents of the event type with the decoder,
+// for events which wrap the email in an envelope. An event type ending with "*" i.e. "com.example.*" matches every
+// type with the prefix, an exact match is preferred over the longest matching prefix. Decoders for GCP Pub/Sub,
+// [SNSNotificationType], [SQSMessageType], [EventBridgeEventType], and Azure, see [DecodeAzure], are registered by
+// default and can be replaced.
+func AppWithEventDecoder(eventType string, decoder EventDecoder) AppOption {
+	return func(app *App) {
+		app.eventDecoders[eventType] = decoder
+	}
+}
+
+// AppWithAttributeMapping provides an option to set [EventData] fields from [EventData.Attributes] i.e. Pub/Sub
+// message attributes, so producers can route emails without changing the message data. The mapping is from attribute
+// name to the JSON name of the field i.e. {"email_template": "template"}, and a mapped attribute overrides the field.
+// The "priority", "locale", "category", and "idempotencyKey" attributes are mapped to the fields of the same name by
+// default, the mapping is added to the defaults and mapping an attribute to "" removes it.
+//
+// Fields which can be set are sender, subject, template, engine, category, priority, locale, idempotencyKey, sendAt,
+// and to, cc, and bcc as comma separated addresses.
+func AppWithAttributeMapping(mapping map[string]string) AppOption {
+	return func(app *App) {
+		for attribute, field := range mapping {
+			if field == "" {
+				delete(app.attributeMapping, attribute)
+				continue
+			}
+			app.attributeMapping[attribute] = field
+		}
+	}
+}
+
+// AppWithPubSubSchema provides an option to decode the data of messages published to Pub/Sub topics with the schema
+// when they are binary encoded, the content type is [ContentTypeProtobuf] or [ContentTypeAvro]. The schema name is
+// either the full "projects/my-project/schemas/my-schema" name or the schema id. This replaces the GCP Pub/Sub
+// [EventDecoder], see [DecodePubSub].
+func AppWithPubSubSchema(schemaName string, contentType string) AppOption {
+	return func(app *App) {
+		app.pubSubSchemas[schemaName] = contentType
+		app.eventDecoders[pubSubType] = pubSubSchemaDecoder(app.pubSubSchemas)
+	}
+}
+
+// AppWithEventConcurrency provides an option to limit how many events of a batch are handled at the same time, see
+// [EmailEvents]. Each event may send to many [EventData.Recipients], limited by [AppWithBatchConcurrency]. Values less
+// than 1 are ignored.
+func AppWithEventConcurrency(concurrency int) AppOption {
+	return func(app *App) {
+		if concurrency > 0 {
+			app.eventConcurrency = concurrency
+		}
+	}
+}
+
+// AppWithEventMapping provides an option to send emails for CloudEvents of the event type with a declarative
+// [EventMapping] rather than [EventData], see [ParseEventMappings] to load mappings from a file. It registers an
+// [EventDecoder] for the type, so an event type ending with "*" matches every type with the prefix.
+func AppWithEventMapping(eventType string, mapping EventMapping) AppOption {
+	return func(app *App) {
+		app.eventDecoders[eventType] = mapping.decode
+	}
+}
+
+// AppWithIdempotencyStore provides an option to save the responses of [MessagesHandler], and the results of emails with
+// an [EventData.IdempotencyKey], to an [IdempotencyStore] so requests retried with the same Idempotency-Key and
+// redelivered events, i.e. Pub/Sub messages, are not sent twice. Without one, they are kept in memory for 24 hours.
+func AppWithIdempotencyStore(store IdempotencyStore) AppOption {
+	return func(app *App) {
+		app.idempotencyStore = store
+	}
+}
+
+// AppWithSchemaHosts provides an option to allow JSON Schemas to be fetched from http(s) URLs on the hosts i.e.
+// "schemas.example.com". The CloudEvent dataschema attribute is chosen by the producer, so no host is allowed by
+// default, and a dataschema URL on any other host is treated as an identifier rather than fetched. Fetched schemas are
+// cached for the life of the App, so the URL should change when the schema does.
+func AppWithSchemaHosts(hosts ...string) AppOption {
+	return func(app *App) {
+		for _, host := range hosts {
+			app.schemaHosts[strings.ToLower(host)] = true
+		}
+	}
+}
+
+// AppWithSchemaHTTPClient provides an option to fetch JSON Schemas from the hosts allowed with [AppWithSchemaHosts]
+// with the client. The default client times out after 10 seconds.
+func AppWithSchemaHTTPClient(client *http.Client) AppOption {
+	return func(app *App) {
+		app.schemaClient = client
+	}
+}
@@ -0,0 +1,138 @@
+package send
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// defaultAttributeMapping maps [EventData.Attributes] to the fields they set unless configured with
+// [AppWithAttributeMapping].
+func defaultAttributeMapping() map[string]string {
+	return map[string]string{
+		"priority":       "priority",
+		"locale":         "locale",
+		"category":       "category",
+		"idempotencyKey": "idempotencyKey",
+	}
+}
+
+// priorityHeaders are the headers sent for each [EventData.Priority].
+var priorityHeaders = map[string]map[string]string{
+	"":       nil,
+	"normal": nil,
+	"high":   {"X-Priority": "1", "Importance": "high"},
+	"low":    {"X-Priority": "5", "Importance": "low"},
+}
+
+// applyAttributes sets the fields of the event data from [EventData.Attributes] with the attribute mapping configured
+// with [AppWithAttributeMapping], attributes override the fields they are mapped to.
+func applyAttributes(app *App, eventData EventData) (EventData, error) {
+	for attribute, field := range app.attributeMapping {
+		value, ok := eventData.Attributes[attribute]
+		if !ok {
+			continue
+		}
+		if err := setEventDataField(&eventData, field, value); err != nil {
+			return EventData{}, fmt.Errorf("invalid attribute \"%s\" - %v", attribute, err)
+		}
+	}
+
+	return eventData, nil
+}
+
+// setEventDataField sets the [EventData] field with the JSON name to the attribute value. Lists of addresses are comma
+// separated and times are RFC 3339 formatted.
+func setEventDataField(eventData *EventData, field string, value string) error {
+	switch field {
+	case "sender":
+		eventData.Sender = value
+	case "subject":
+		eventData.Subject = value
+	case "template":
+		eventData.Template = value
+	case "engine":
+		eventData.Engine = value
+	case "category":
+		eventData.Category = value
+	case "priority":
+		eventData.Priority = strings.ToLower(value)
+	case "locale":
+		eventData.Locale = value
+	case "idempotencyKey":
+		eventData.IdempotencyKey = value
+	case "to":
+		eventData.To = splitAddresses(value)
+	case "cc":
+		eventData.Cc = splitAddresses(value)
+	case "bcc":
+		eventData.Bcc = splitAddresses(value)
+	case "sendAt":
+		sendAt, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return err
+		}
+		eventData.SendAt = &sendAt
+	default:
+		return fmt.Errorf("field \"%s\" can not be set from an attribute", field)
+	}
+
+	return nil
+}
+
+// splitAddresses splits a comma separated list of email addresses.
+func splitAddresses(value string) MessageTo {
+	var addresses MessageTo
+	for _, address := range strings.Split(value, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+
+	return addresses
+}
+
+// templateData is the data an email is rendered with, [EventData.Data] along with the [EventData.Attributes] and
+// [EventData.Locale] unless the data already has variables with those names.
+func templateData(eventData EventData) map[string]interface{} {
+	if len(eventData.Attributes) == 0 && eventData.Locale == "" {
+		return eventData.Data
+	}
+
+	data := make(map[string]interface{}, len(eventData.Data)+2)
+	for k, v := range eventData.Data {
+		data[k] = v
+	}
+	if _, ok := data["attributes"]; !ok && len(eventData.Attributes) > 0 {
+		data["attributes"] = eventData.Attributes
+	}
+	if _, ok := data["locale"]; !ok && eventData.Locale != "" {
+		data["locale"] = eventData.Locale
+	}
+
+	return data
+}
+
+// emailHeaders are the headers for the [EventData.Priority], [EventData.Locale], and one-click unsubscribes.
+func emailHeaders(app *App, eventData EventData) (map[string]string, error) {
+	headers, err := unsubscribeHeaders(app, eventData)
+	if err != nil {
+		return nil, err
+	}
+
+	extra := make(map[string]string)
+	for name, value := range priorityHeaders[eventData.Priority] {
+		extra[name] = value
+	}
+	if eventData.Locale != "" {
+		extra["Content-Language"] = eventData.Locale
+	}
+	if len(extra) == 0 {
+		return headers, nil
+	}
+	for name, value := range headers {
+		extra[name] = value
+	}
+
+	return extra, nil
+}
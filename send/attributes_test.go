@@ -0,0 +1,209 @@
+package send_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/itmayziii/email/send"
+	"gocloud.dev/blob/memblob"
+	"testing"
+	"time"
+)
+
+// newPubSubEvent creates a GCP Pub/Sub CloudEvent with the email as the message data.
+func newPubSubEvent(t *testing.T, email map[string]interface{}, attributes map[string]string) cloudevents.Event {
+	t.Helper()
+	data, err := json.Marshal(email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := cloudevents.NewEvent()
+	event.SetID("1")
+	event.SetSource("//pubsub.googleapis.com/projects/example-project/topics/email")
+	event.SetType("google.cloud.pubsub.topic.v1.messagePublished")
+	err = event.SetData(cloudevents.ApplicationJSON, send.PubSubPayload{
+		Subscription: "projects/example-project/subscriptions/email",
+		Message: send.PubSubMessage{
+			Attributes:  attributes,
+			MessageId:   "2070443601311540",
+			PublishTime: "2021-02-26T19:13:55.749Z",
+			Data:        data,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return event
+}
+
+func TestEmailEvent_PubSubAttributes(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	sender := &recordingSender{}
+	bucket := memblob.OpenBucket(nil)
+	t.Cleanup(func() { _ = bucket.Close() })
+	err := bucket.WriteAll(ctx, "shipped.html", []byte(`{{ .Attributes.tenant }} order shipped ({{ .Locale }})`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := send.NewApp(
+		send.AppWithFileStorage(bucket),
+		send.AppWithDomainSender("example.com", sender),
+		send.AppWithAttributeMapping(map[string]string{"email_template": "template", "email_sender": "sender"}),
+	)
+
+	err = send.EmailEvent(app)(ctx, newPubSubEvent(t, map[string]interface{}{
+		"sender":   "wrong@example.org",
+		"subject":  "test",
+		"to":       "tom@example.com",
+		"template": "default.html",
+	}, map[string]string{
+		"email_template": "shipped.html",
+		"email_sender":   "no-reply@example.com",
+		"tenant":         "contoso",
+		"priority":       "HIGH",
+		"locale":         "fr-CA",
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(sender.messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(sender.messages))
+	}
+	message := sender.messages[0]
+	if message.Body != "contoso order shipped (fr-CA)" || message.Sender != "no-reply@example.com" {
+		t.Errorf("expected the mapped template and sender, got %+v", message)
+	}
+	expectedHeaders := map[string]string{"X-Priority": "1", "Importance": "high", "Content-Language": "fr-CA"}
+	for name, value := range expectedHeaders {
+		if message.Headers[name] != value {
+			t.Errorf("expected header %s: %s, got %+v", name, value, message.Headers)
+		}
+	}
+}
+
+func TestEmailEvent_PubSubMessageIdIsIdempotencyKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		email       map[string]interface{}
+		attributes  map[string]string
+		expectedKey string
+	}{
+		{"message id", map[string]interface{}{}, nil, "2070443601311540"},
+		{"event data", map[string]interface{}{"idempotencyKey": "order-1"}, nil, "order-1"},
+		{"attribute", map[string]interface{}{"idempotencyKey": "order-1"}, map[string]string{"idempotencyKey": "order-2"}, "order-2"},
+	}
+
+	for _, tt := range tests {
+		ttCopy := tt
+		t.Run(ttCopy.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			store := send.NewMemoryScheduleStore()
+			app := send.NewApp(send.AppWithDomainSender("example.com", &recordingSender{}), send.AppWithScheduleStore(store))
+			email := map[string]interface{}{
+				"sender":  "no-reply@example.com",
+				"subject": "test",
+				"to":      "tom@example.com",
+				"body":    "hello",
+				"sendAt":  time.Now().Add(time.Hour).Format(time.RFC3339),
+			}
+			for k, v := range ttCopy.email {
+				email[k] = v
+			}
+
+			if err := send.EmailEvent(app)(ctx, newPubSubEvent(t, email, ttCopy.attributes)); err != nil {
+				t.Fatalf("case: \"%s\", unexpected error: %v", ttCopy.name, err)
+			}
+			due, err := store.Due(ctx, time.Now().Add(2*time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(due) != 1 || due[0].Key != ttCopy.expectedKey {
+				t.Errorf("case: \"%s\", expected the email scheduled with key %s, got %+v", ttCopy.name, ttCopy.expectedKey, due)
+			}
+		})
+	}
+}
+
+func TestEmailEvent_InvalidAttributes(t *testing.T) {
+	tests := []struct {
+		name       string
+		mapping    map[string]string
+		attributes map[string]string
+	}{
+		{"invalid priority", nil, map[string]string{"priority": "urgent"}},
+		{"unknown field", map[string]string{"email_body": "body"}, map[string]string{"email_body": "hello"}},
+		{"invalid time", map[string]string{"deliver_at": "sendAt"}, map[string]string{"deliver_at": "tomorrow"}},
+	}
+
+	for _, tt := range tests {
+		ttCopy := tt
+		t.Run(ttCopy.name, func(t *testing.T) {
+			t.Parallel()
+			sender := &recordingSender{}
+			app := send.NewApp(send.AppWithDomainSender("example.com", sender), send.AppWithAttributeMapping(ttCopy.mapping))
+
+			err := send.EmailEvent(app)(context.Background(), newPubSubEvent(t, map[string]interface{}{
+				"sender":  "no-reply@example.com",
+				"subject": "test",
+				"to":      "tom@example.com",
+				"body":    "hello",
+			}, ttCopy.attributes))
+			if err == nil || len(sender.messages) != 0 {
+				t.Errorf("case: \"%s\", expected an error and no messages, got %v", ttCopy.name, err)
+			}
+		})
+	}
+}
+
+// flakySender fails to send the first email and records every call.
+type flakySender struct {
+	recordingSender
+	calls int
+}
+
+func (fs *flakySender) Send(ctx context.Context, m send.Message) (string, error) {
+	fs.mu.Lock()
+	fs.calls++
+	calls := fs.calls
+	fs.mu.Unlock()
+	if calls == 1 {
+		return "", errors.New("unavailable")
+	}
+	return fs.recordingSender.Send(ctx, m)
+}
+
+func TestEmailEvent_PubSubRedeliveryIsSentOnce(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	email := map[string]interface{}{"sender": "no-reply@example.com", "subject": "test", "to": "tom@example.com", "body": "hello"}
+
+	sender := &recordingSender{}
+	emailEvent := send.EmailEvent(send.NewApp(send.AppWithDomainSender("example.com", sender)))
+	for i := 0; i < 2; i++ {
+		if err := emailEvent(ctx, newPubSubEvent(t, email, nil)); err != nil {
+			t.Fatalf("delivery: %d, unexpected error: %v", i, err)
+		}
+	}
+	if len(sender.messages) != 1 {
+		t.Errorf("expected the redelivered message to be sent once, got %d messages", len(sender.messages))
+	}
+
+	flaky := &flakySender{}
+	emailEvent = send.EmailEvent(send.NewApp(send.AppWithDomainSender("example.com", flaky)))
+	if err := emailEvent(ctx, newPubSubEvent(t, email, nil)); err == nil {
+		t.Fatalf("expected the first delivery to fail")
+	}
+	for i := 0; i < 2; i++ {
+		if err := emailEvent(ctx, newPubSubEvent(t, email, nil)); err != nil {
+			t.Fatalf("redelivery: %d, unexpected error: %v", i, err)
+		}
+	}
+	if flaky.calls != 2 || len(flaky.messages) != 1 {
+		t.Errorf("expected a failed send to be retried once, got %d calls and %d messages", flaky.calls, len(flaky.messages))
+	}
+}
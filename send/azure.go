@@ -0,0 +1,146 @@
+package send
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// CloudEvent type prefixes of Azure events. Event Grid delivers CloudEvents with "Microsoft." types for Azure services
+// and bridges which convert Azure events to CloudEvents use "com.microsoft.azure." types.
+const (
+	azureTypePrefix       = "Microsoft."
+	azureBridgeTypePrefix = "com.microsoft.azure."
+)
+
+// eventGridValidationType is the Event Grid event sent to validate a webhook subscription, it is not an email.
+const eventGridValidationType = "Microsoft.EventGrid.SubscriptionValidationEvent"
+
+// EventGridEvent is an event in the [Azure Event Grid event schema], the Data is the [EventData].
+//
+// [Azure Event Grid event schema]: https://learn.microsoft.com/en-us/azure/event-grid/event-schema
+type EventGridEvent struct {
+	ID              string          `json:"id"`
+	Topic           string          `json:"topic"`
+	Subject         string          `json:"subject"`
+	EventType       string          `json:"eventType"`
+	EventTime       string          `json:"eventTime"`
+	Data            json.RawMessage `json:"data"`
+	DataVersion     string          `json:"dataVersion"`
+	MetadataVersion string          `json:"metadataVersion"`
+}
+
+// ServiceBusMessage is an [Azure Service Bus message] as delivered by Service Bus integrations, the Body is the
+// [EventData] as JSON, a JSON encoded string, or base64 encoded.
+//
+// [Azure Service Bus message]: https://learn.microsoft.com/en-us/azure/service-bus-messaging/service-bus-messages-payloads
+type ServiceBusMessage struct {
+	MessageID             string                 `json:"messageId"`
+	ContentType           string                 `json:"contentType"`
+	CorrelationID         string                 `json:"correlationId"`
+	Subject               string                 `json:"subject"`
+	ApplicationProperties map[string]interface{} `json:"applicationProperties"`
+	Body                  json.RawMessage        `json:"body"`
+}
+
+// azureEnvelope has the fields which identify an Event Grid event, a CloudEvent, or a Service Bus message wrapping
+// another payload.
+type azureEnvelope struct {
+	EventType   string          `json:"eventType"`
+	SpecVersion string          `json:"specversion"`
+	Type        string          `json:"type"`
+	Data        json.RawMessage `json:"data"`
+	DataBase64  string          `json:"data_base64"`
+	MessageID   string          `json:"messageId"`
+	Body        json.RawMessage `json:"body"`
+}
+
+// DecodeAzure is the [EventDecoder] for Azure events, it is registered for CloudEvent types starting with
+// "Microsoft." and "com.microsoft.azure.". The data may be the [EventData] itself or wrapped in an [EventGridEvent],
+// a single event array in the Event Grid schema, a JSON CloudEvent, or a [ServiceBusMessage].
+func DecodeAzure(event cloudevents.Event) (EventData, error) {
+	if event.Type() == eventGridValidationType {
+		return EventData{}, errors.New("Event Grid subscription validation events are not emails")
+	}
+
+	return decodeAzurePayload(event.Data())
+}
+
+// decodeAzurePayload unmarshals [EventData] from a payload after unwrapping the Azure envelopes it is nested in i.e. an
+// Event Grid event delivered as a Service Bus message body.
+func decodeAzurePayload(payload []byte) (EventData, error) {
+	for depth := 0; depth < maxEnvelopeDepth; depth++ {
+		payload = bytes.TrimSpace(payload)
+		if len(payload) == 0 {
+			return EventData{}, errors.New("empty Azure event data")
+		}
+
+		switch payload[0] {
+		case '[':
+			// Event Grid delivers events in the Event Grid schema as an array.
+			var events []json.RawMessage
+			if err := json.Unmarshal(payload, &events); err != nil {
+				return EventData{}, err
+			}
+			if len(events) != 1 {
+				return EventData{}, fmt.Errorf("expected a single Event Grid event, got %d", len(events))
+			}
+			payload = events[0]
+			continue
+		case '"':
+			unwrapped, err := decodeAzureString(payload)
+			if err != nil {
+				return EventData{}, err
+			}
+			payload = unwrapped
+			continue
+		}
+
+		var envelope azureEnvelope
+		if err := json.Unmarshal(payload, &envelope); err != nil {
+			return EventData{}, err
+		}
+		switch {
+		case envelope.EventType != "" && len(envelope.Data) > 0:
+			if envelope.EventType == eventGridValidationType {
+				return EventData{}, errors.New("Event Grid subscription validation events are not emails")
+			}
+			payload = envelope.Data
+		case envelope.SpecVersion != "" && envelope.DataBase64 != "":
+			decoded, err := base64.StdEncoding.DecodeString(envelope.DataBase64)
+			if err != nil {
+				return EventData{}, err
+			}
+			payload = decoded
+		case envelope.SpecVersion != "" && len(envelope.Data) > 0:
+			payload = envelope.Data
+		case envelope.MessageID != "" && len(envelope.Body) > 0:
+			payload = envelope.Body
+		default:
+			var eventData EventData
+			if err := json.Unmarshal(payload, &eventData); err != nil {
+				return EventData{}, err
+			}
+			return eventData, nil
+		}
+	}
+
+	return EventData{}, fmt.Errorf("more than %d nested envelopes", maxEnvelopeDepth)
+}
+
+// decodeAzureString returns the contents of a JSON string which is either JSON text or base64 encoded JSON, as Service
+// Bus message bodies are bytes which integrations encode either way.
+func decodeAzureString(payload []byte) ([]byte, error) {
+	var text string
+	if err := json.Unmarshal(payload, &text); err != nil {
+		return nil, err
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(text); err == nil && json.Valid(decoded) {
+		return decoded, nil
+	}
+
+	return []byte(text), nil
+}
@@ -0,0 +1,71 @@
+package send_test
+
+import (
+	"context"
+	"encoding/json"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/itmayziii/email/send"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readAzureEvent reads a recorded Azure CloudEvent from testdata/azure.
+func readAzureEvent(t *testing.T, name string) cloudevents.Event {
+	t.Helper()
+	recorded, err := os.ReadFile(filepath.Join("testdata", "azure", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var event cloudevents.Event
+	if err := json.Unmarshal(recorded, &event); err != nil {
+		t.Fatalf("failed to unmarshal %s: %v", name, err)
+	}
+
+	return event
+}
+
+func TestEmailEvent_Azure(t *testing.T) {
+	tests := []struct {
+		name        string
+		file        string
+		expectError bool
+	}{
+		{"Event Grid schema", "eventgrid-schema.json", false},
+		{"Event Grid CloudEvent", "eventgrid-cloudevent.json", false},
+		{"Service Bus message", "servicebus-message.json", false},
+		{"Event Grid event delivered by Service Bus", "servicebus-eventgrid.json", false},
+		{"Event Grid subscription validation", "eventgrid-validation.json", true},
+		{"invalid email", "eventgrid-invalid.json", true},
+	}
+
+	for _, tt := range tests {
+		ttCopy := tt
+		t.Run(ttCopy.name, func(t *testing.T) {
+			t.Parallel()
+			sender := &recordingSender{}
+			app := send.NewApp(send.AppWithDomainSender("example.com", sender))
+
+			err := send.EmailEvent(app)(context.Background(), readAzureEvent(t, ttCopy.file))
+			if ttCopy.expectError {
+				if err == nil || len(sender.messages) != 0 {
+					t.Errorf("case: \"%s\", expected an error and no messages, got %v", ttCopy.name, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("case: \"%s\", unexpected error: %v", ttCopy.name, err)
+			}
+			if len(sender.messages) != 1 {
+				t.Fatalf("case: \"%s\", expected 1 message, got %d", ttCopy.name, len(sender.messages))
+			}
+			message := sender.messages[0]
+			if message.Subject != "Your order has shipped" || message.To[0] != "tom@example.com" {
+				t.Errorf("case: \"%s\", unexpected message %+v", ttCopy.name, message)
+			}
+			if message.Body != "<p>Order 1234 is on its way.</p>" {
+				t.Errorf("case: \"%s\", unexpected body %s", ttCopy.name, message.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package send
+
+import (
+	"context"
+	"fmt"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"net/mail"
+)
+
+// defaultBatchConcurrency is how many emails are sent at the same time for an event with [EventData.Recipients] unless
+// configured with [AppWithBatchConcurrency].
+const defaultBatchConcurrency = 10
+
+// RecipientResult is the outcome of sending an email to a single recipient of [EventData.Recipients].
+type RecipientResult struct {
+	To string `json:"to"`
+	// ID is the id returned by the [Sender] when the email was sent.
+	ID string `json:"id,omitempty"`
+	// Status is what happened to the email when it did not fail.
+	Status MessageStatus `json:"status,omitempty"`
+	// Error describes why the email was not sent.
+	Error string `json:"error,omitempty"`
+}
+
+// BatchSendError represents an error that occurs when an email could not be sent to any of the
+// [EventData.Recipients].
+type BatchSendError struct {
+	results []RecipientResult
+}
+
+func (batchSendError BatchSendError) Error() string {
+	return fmt.Sprintf("failed to send email to all %d recipients", len(batchSendError.results))
+}
+
+// Results are the outcome for every recipient, in the same order as [EventData.Recipients].
+func (batchSendError BatchSendError) Results() []RecipientResult {
+	return batchSendError.results
+}
+
+// sendBatch sends the email individually to every recipient of [EventData.Recipients], at most
+// [App.batchConcurrency] at a time, and logs a summary of the results. Each recipient's address and data are
+// validated separately, so invalid recipients are reported in the results rather than failing the whole event. The
+// template, the files it depends on, and its schema are loaded once and shared by every recipient. Once the context
+// is done the remaining recipients fail without being sent.
+//
+// An error is only returned when no email could be sent, the results are then part of the [BatchSendError]. Returning
+// an error after some emails were sent would cause the event to be retried and the successful recipients to receive
+// the email again.
+func sendBatch(ctx context.Context, app *App, eventID string, eventData EventData, dataSchema string, version string) ([]RecipientResult, error) {
+	ctx = withFileCache(ctx)
+	schema := findRecipientSchema(ctx, app, eventData, dataSchema)
+	results := make([]RecipientResult, len(eventData.Recipients))
+	concurrently(ctx, app.batchConcurrency, len(eventData.Recipients), func(i int) {
+		recipient := eventData.Recipients[i]
+		results[i] = RecipientResult{To: recipient.To}
+		recipientData := recipientEventData(eventData, recipient)
+		sent, err := sendToRecipient(ctx, app, recipientData, schema)
+		if err == nil && sent.sandboxed {
+			results[i].Status = MessageStatusSandboxed
+			return
+		}
+		recipientData = sent.recipients(recipientData)
+		recordSend(ctx, app, recipientData, version, sent.id, err)
+		publishResult(ctx, app, eventID, recipientData, version, sent.id, err)
+		if err != nil {
+			results[i].Error = err.Error()
+			return
+		}
+		results[i].ID = sent.id
+		results[i].Status = deliveredStatus(ctx)
+	}, func(i int, err error) {
+		recipient := eventData.Recipients[i]
+		results[i] = RecipientResult{To: recipient.To, Error: err.Error()}
+		recipientData := recipientEventData(eventData, recipient)
+		recordSend(ctx, app, recipientData, version, "", err)
+		publishResult(ctx, app, eventID, recipientData, version, "", err)
+	})
+
+	failed, sandboxed := 0, 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+			app.errorLogger.Printf("failed to send email to recipient: to: %s - %s\n", result.To, result.Error)
+		}
+		if result.Status == MessageStatusSandboxed {
+			sandboxed++
+		}
+	}
+	app.infoLogger.Printf(
+		"batch email sent: sender: %s, subject: %s, template: %s, version: %s, recipients: %d, sent: %d, sandboxed: %d, failed: %d\n",
+		eventData.Sender,
+		eventData.Subject,
+		eventData.Template,
+		version,
+		len(results),
+		len(results)-failed-sandboxed,
+		sandboxed,
+		failed,
+	)
+
+	if failed == len(results) {
+		return nil, BatchSendError{results: results}
+	}
+	return results, nil
+}
+
+// recipientSchema is the JSON Schema every recipient's data is validated against, see [findSchema].
+type recipientSchema struct {
+	location string
+	schema   *jsonschema.Schema
+	err      error
+}
+
+// findRecipientSchema finds and compiles the schema for an email to [EventData.Recipients] once, the data of the
+// recipients is not needed to find it.
+func findRecipientSchema(ctx context.Context, app *App, eventData EventData, dataSchema string) recipientSchema {
+	location, schema, err := findSchema(ctx, app, eventData, dataSchema)
+	return recipientSchema{location: location, schema: schema, err: err}
+}
+
+// sendToRecipient validates a single recipient and sends them the email.
+func sendToRecipient(ctx context.Context, app *App, eventData EventData, schema recipientSchema) (sentMessage, error) {
+	if _, err := mail.ParseAddress(eventData.To[0]); err != nil {
+		return sentMessage{}, sendError{class: ErrorClassValidation, err: fmt.Errorf("invalid \"to\" - %v", err)}
+	}
+	err := schema.err
+	if err == nil {
+		err = validateSchema(schema.location, schema.schema, eventData.Data)
+	}
+	if err != nil {
+		return sentMessage{}, sendError{class: ErrorClassValidation, err: err}
+	}
+
+	return sendMessage(ctx, app, eventData)
+}
+
+// recipientEventData is the event data for a single recipient, the recipient's data is merged over
+// [EventData.Data].
+func recipientEventData(eventData EventData, recipient Recipient) EventData {
+	data := make(map[string]interface{}, len(eventData.Data)+len(recipient.Data))
+	for k, v := range eventData.Data {
+		data[k] = v
+	}
+	for k, v := range recipient.Data {
+		data[k] = v
+	}
+
+	eventData.To = MessageTo{recipient.To}
+	eventData.Data = data
+	eventData.Recipients = nil
+	return eventData
+}
@@ -0,0 +1,178 @@
+package send_test
+
+import (
+	"context"
+	"errors"
+	"github.com/itmayziii/email/send"
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/memblob"
+	"reflect"
+	"testing"
+)
+
+func TestEmailEvent_SendsToEachRecipient(t *testing.T) {
+	t.Parallel()
+	sender := &recordingSender{}
+	app := send.NewApp(send.AppWithDomainSender("example.com", sender), send.AppWithBatchConcurrency(2))
+
+	err := send.EmailEvent(app)(context.Background(), newEvent(t, map[string]interface{}{
+		"sender":  "no-reply@example.com",
+		"subject": "test",
+		"body":    "<p>{{ .Greeting }} {{ .Name }}</p>",
+		"data":    map[string]interface{}{"greeting": "Hi", "name": "friend"},
+		"recipients": []interface{}{
+			map[string]interface{}{"to": "tom@example.com", "data": map[string]interface{}{"name": "Tommy"}},
+			map[string]interface{}{"to": "not an email"},
+			map[string]interface{}{"to": "jane@example.com", "data": map[string]interface{}{"greeting": "Hello"}},
+		},
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]string{
+		"tom@example.com":  "<p>Hi Tommy</p>",
+		"jane@example.com": "<p>Hello friend</p>",
+	}
+	actual := make(map[string]string)
+	for _, m := range sender.messages {
+		if len(m.To) != 1 {
+			t.Errorf("expected a single recipient per message, got %v", m.To)
+		}
+		actual[m.To[0]] = m.Body
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected messages %v to match %v", actual, expected)
+	}
+}
+
+func TestEmailEvent_ErrorsWhenNoRecipientIsSent(t *testing.T) {
+	t.Parallel()
+	app := send.NewApp(send.AppWithDomainSender("example.com", &recordingSender{}))
+
+	err := send.EmailEvent(app)(context.Background(), newEvent(t, map[string]interface{}{
+		"sender":     "no-reply@example.com",
+		"subject":    "test",
+		"body":       "<p>{{ .Name }}</p>",
+		"recipients": []interface{}{map[string]interface{}{"to": "tom@example.com"}, map[string]interface{}{"to": "nope"}},
+	}))
+	var batchSendError send.BatchSendError
+	if !errors.As(err, &batchSendError) {
+		t.Fatalf("expected BatchSendError but got %v", err)
+	}
+	results := batchSendError.Results()
+	if len(results) != 2 || results[0].To != "tom@example.com" || results[0].Error == "" || results[1].Error == "" {
+		t.Errorf("expected both recipients to have failed, got %+v", results)
+	}
+}
+
+func TestEmailEvent_RejectsToWithRecipients(t *testing.T) {
+	t.Parallel()
+	sender := &recordingSender{}
+	app := send.NewApp(send.AppWithDomainSender("example.com", sender))
+
+	err := send.EmailEvent(app)(context.Background(), newEvent(t, map[string]interface{}{
+		"sender":     "no-reply@example.com",
+		"subject":    "test",
+		"body":       "hello",
+		"to":         "jane@example.com",
+		"recipients": []interface{}{map[string]interface{}{"to": "tom@example.com"}},
+	}))
+	if err == nil {
+		t.Errorf("expected an error")
+	}
+	if len(sender.messages) != 0 {
+		t.Errorf("expected no messages to be sent, got %d", len(sender.messages))
+	}
+}
+
+// editingSender edits a file in storage when it sends the first email.
+type editingSender struct {
+	recordingSender
+	bucket   *blob.Bucket
+	name     string
+	contents string
+}
+
+func (es *editingSender) Send(ctx context.Context, m send.Message) (string, error) {
+	if err := es.bucket.WriteAll(context.Background(), es.name, []byte(es.contents), nil); err != nil {
+		return "", err
+	}
+	return es.recordingSender.Send(ctx, m)
+}
+
+func TestEmailEvent_LoadsTemplateOncePerBatch(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	t.Cleanup(func() { _ = bucket.Close() })
+	if err := bucket.WriteAll(ctx, "emails/welcome.html", []byte("<p>Hi {{ .Name }}</p>"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := bucket.WriteAll(ctx, "emails/welcome.schema.json", []byte(`{"required": ["name"]}`), nil); err != nil {
+		t.Fatal(err)
+	}
+	sender := &editingSender{bucket: bucket, name: "emails/welcome.html", contents: "<p>Edited {{ .Name }}</p>"}
+	app := send.NewApp(
+		send.AppWithFileStorage(bucket),
+		send.AppWithDomainSender("example.com", sender),
+		send.AppWithBatchConcurrency(1),
+	)
+
+	err := send.EmailEvent(app)(ctx, newEvent(t, map[string]interface{}{
+		"sender":   "no-reply@example.com",
+		"subject":  "test",
+		"template": "emails/welcome.html",
+		"recipients": []interface{}{
+			map[string]interface{}{"to": "tom@example.com", "data": map[string]interface{}{"name": "Tommy"}},
+			map[string]interface{}{"to": "jane@example.com", "data": map[string]interface{}{"name": "Jane"}},
+		},
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(sender.messages) != 2 || sender.messages[1].Body != "<p>Hi Jane</p>" {
+		t.Errorf("expected every recipient to be sent the template read for the event, got %+v", sender.messages)
+	}
+}
+
+// cancelingSender cancels the context of the email when it sends the first email.
+type cancelingSender struct {
+	recordingSender
+	cancel context.CancelFunc
+}
+
+func (cs *cancelingSender) Send(ctx context.Context, m send.Message) (string, error) {
+	cs.cancel()
+	return cs.recordingSender.Send(ctx, m)
+}
+
+func TestApp_SendRecipientsStopsWhenCanceled(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sender := &cancelingSender{cancel: cancel}
+	app := send.NewApp(send.AppWithDomainSender("example.com", sender), send.AppWithBatchConcurrency(1))
+
+	result, err := app.Send(ctx, send.EventData{
+		Sender:  "no-reply@example.com",
+		Subject: "test",
+		Body:    "hello",
+		Recipients: []send.Recipient{
+			{To: "tom@example.com"},
+			{To: "jane@example.com"},
+			{To: "bob@example.com"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(sender.messages) != 1 {
+		t.Errorf("expected only the first recipient to be sent the email, got %d messages", len(sender.messages))
+	}
+	if len(result.Recipients) != 3 || result.Recipients[1].Error == "" || result.Recipients[2].Error == "" {
+		t.Errorf("expected the remaining recipients to fail, got %+v", result.Recipients)
+	}
+}
@@ -1,16 +1,26 @@
 package send
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	cloudevents "github.com/cloudevents/sdk-go/v2"
 	"net/mail"
+	"path"
 	"strings"
+	"time"
 )
 
 const pubSubType = "google.cloud.pubsub.topic.v1.messagePublished"
 
+// Pub/Sub message attributes which describe how the message data is encoded.
+const (
+	pubSubContentTypeAttribute    = "content-type"
+	pubSubSchemaNameAttribute     = "googclient_schemaname"
+	pubSubSchemaEncodingAttribute = "googclient_schemaencoding"
+)
+
 // PubSubPayload represents GCP pub/sub [MessagePublishedData format].
 //
 // [MessagePublishedData format]: https://googleapis.github.io/google-cloudevents/examples/binary/pubsub/MessagePublishedData-complex.json
@@ -43,6 +53,13 @@ type EventData struct {
 	//
 	// [Go HTML template]: https://pkg.go.dev/html/template
 	Body string `json:"body"`
+	// BodyMarkdown is the email body written in [Markdown]. It is bound to the variables provided by Data using
+	// [Go text templates], converted to sanitized HTML, and wrapped in the layout configured with
+	// [AppWithMarkdownLayout]. The markdown itself is sent as the plain text alternative.
+	//
+	// [Markdown]: https://commonmark.org/
+	// [Go text templates]: https://pkg.go.dev/text/template
+	BodyMarkdown string `json:"bodyMarkdown"`
 	// To represents who the email should go to and can be provided as an array of strings a string.
 	To MessageTo `json:"to"`
 	// Cc represents who will be carbon copied onto the email and can be provided as an array of string or a string.
@@ -55,6 +72,12 @@ type EventData struct {
 	// [EventData.Template] and [EventData.Body] at the same time as they are both meant to represent
 	// the email body.
 	//
+	// Templates may declare a JSON Schema for [EventData.Data] with a "schema" key in YAML front matter or with a
+	// sidecar file i.e. welcome.html -> welcome.schema.json.
+	//
+	// A published version of the template can be pinned with "@" i.e. "welcome.html@v3", or "welcome.html@latest" for
+	// the latest version in the template manifest, see [PublishTemplate]. Without a version the working copy is used.
+	//
 	// [Go HTML template]: https://pkg.go.dev/html/template
 	Template string `json:"template"`
 	// Data is an arbitrary map of variables to values that will be used in the [EventData.Template] or
@@ -62,6 +85,44 @@ type EventData struct {
 	//
 	// [Go HTML templates]: https://pkg.go.dev/html/template
 	Data map[string]interface{} `json:"data"`
+	// Engine is the name of the [TemplateEngine] used to render [EventData.Body] or [EventData.Template] i.e.
+	// "mustache". When empty the engine is chosen by the [EventData.Template] file extension and defaults to
+	// [Go HTML templates].
+	//
+	// [Go HTML templates]: https://pkg.go.dev/html/template
+	Engine string `json:"engine"`
+	// Recipients sends the email individually to each recipient instead of one email to [EventData.To], so recipients
+	// never see each other. Each recipient's Data is merged over [EventData.Data] and the body is rendered separately
+	// for every recipient. [EventData.To], [EventData.Cc], and [EventData.Bcc] must be empty when Recipients is used.
+	Recipients []Recipient `json:"recipients"`
+	// SendAt schedules the email to be sent at a later time, RFC 3339 formatted i.e. "2024-01-02T15:04:05Z". Emails
+	// due within a few seconds are sent immediately. Later emails are saved to the [ScheduleStore] configured with
+	// [AppWithScheduleStore] or, without one, scheduled with the email provider when the [Sender] is a
+	// [ScheduledSender].
+	SendAt *time.Time `json:"sendAt"`
+	// IdempotencyKey identifies the email so a scheduled email can be canceled with [CancelScheduledEmail], and an
+	// email with the same key is only sent once, see [AppWithIdempotencyStore]. Defaults to the Pub/Sub message id for
+	// Pub/Sub events, without one a scheduled email is canceled with the CloudEvent ID.
+	IdempotencyKey string `json:"idempotencyKey"`
+	// Category groups emails of the same kind i.e. "newsletter" so recipients can be suppressed from a category
+	// without being suppressed from every email, see [SuppressionScope].
+	Category string `json:"category"`
+	// Priority is "high", "normal", or "low" and is sent as the X-Priority and Importance headers.
+	Priority string `json:"priority"`
+	// Locale is the language of the email i.e. "fr-CA", it is sent as the Content-Language header and is available to
+	// templates as {{ .Locale }}.
+	Locale string `json:"locale"`
+	// Attributes are the message attributes of the envelope the email was delivered in i.e. Pub/Sub attributes. They
+	// are available to templates as {{ .Attributes.name }} and can set other fields, see [AppWithAttributeMapping].
+	Attributes map[string]string `json:"attributes"`
+}
+
+// Recipient is a single recipient of an email sent with [EventData.Recipients].
+type Recipient struct {
+	// To is the email address of the recipient.
+	To string `json:"to"`
+	// Data overrides variables in [EventData.Data] for this recipient only.
+	Data map[string]interface{} `json:"data"`
 }
 
 // MessageTo represents who an email should be sent to.
@@ -73,6 +134,10 @@ func (to *MessageTo) UnmarshalJSON(data []byte) error {
 		*to = []string{}
 		return nil
 	}
+	if rawTo == "null" {
+		*to = nil
+		return nil
+	}
 
 	if strings.HasPrefix(rawTo, "[") {
 		var emails []string
@@ -94,64 +159,173 @@ func (to *MessageTo) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
-// extractEventData unmarshals the event payload into our expected [EventData] format.
-func extractEventData(event cloudevents.Event) (EventData, error) {
-	// Handling GCP pub/sub format is a convenience for package users. Not sure if we want to handle every custom
-	// format, but we can cross that bridge if people start requesting them. It might not be a bad idea for this package
-	// to play nicely with the major event producers.
-	if event.Type() == pubSubType {
-		var pubSubPayload PubSubPayload
-		if err := event.DataAs(&pubSubPayload); err != nil {
+// extractEventData unmarshals the event payload into our expected [EventData] format. Envelopes of the major event
+// producers i.e. GCP Pub/Sub and AWS SNS are unwrapped by the [EventDecoder] registered for the CloudEvent type,
+// see [AppWithEventDecoder]. Event data with a [ContentTypeProtobuf] or [ContentTypeAvro] datacontenttype is decoded
+// from its binary form. [EventData.Attributes] are mapped to fields when the email is sent, see [send].
+func extractEventData(app *App, event cloudevents.Event) (EventData, error) {
+	var eventData EventData
+	if decoder := eventDecoder(app, event.Type()); decoder != nil {
+		decoded, err := decoder(event)
+		if err != nil {
 			return EventData{}, err
 		}
-		var eventData EventData
-		if err := json.Unmarshal(pubSubPayload.Message.Data, &eventData); err != nil {
+		eventData = decoded
+	} else if binary, ok := binaryDecoder(event.DataContentType()); ok {
+		decoded, err := binary(event.Data())
+		if err != nil {
 			return EventData{}, err
 		}
+		eventData = decoded
+	} else if err := event.DataAs(&eventData); err != nil {
+		return EventData{}, err
+	}
+
+	return eventData, nil
+}
+
+// DecodePubSub is the [EventDecoder] for GCP Pub/Sub events, [EventData] is the base64 encoded message data. The
+// message attributes become [EventData.Attributes] and the message id is the default [EventData.IdempotencyKey], as
+// the message id stays the same when Pub/Sub redelivers a message. A redelivered message is not sent again once it
+// was sent, and replaces the scheduled email rather than adding a second one, see [AppWithIdempotencyStore].
+//
+// The message data is JSON unless a "content-type" attribute or the schema attributes Pub/Sub adds to messages
+// published to a topic with a schema say otherwise, see [AppWithPubSubSchema].
+func DecodePubSub(event cloudevents.Event) (EventData, error) {
+	return decodePubSub(event, nil)
+}
 
-		return eventData, nil
+// pubSubSchemaDecoder is the [EventDecoder] for GCP Pub/Sub events which decodes binary encoded messages with the
+// content types of the schemas.
+func pubSubSchemaDecoder(schemas map[string]string) EventDecoder {
+	return func(event cloudevents.Event) (EventData, error) {
+		return decodePubSub(event, schemas)
 	}
+}
 
-	var eventData EventData
-	if err := event.DataAs(&eventData); err != nil {
+func decodePubSub(event cloudevents.Event, schemas map[string]string) (EventData, error) {
+	var pubSubPayload PubSubPayload
+	if err := event.DataAs(&pubSubPayload); err != nil {
+		return EventData{}, err
+	}
+	contentType, err := pubSubContentType(pubSubPayload.Message.Attributes, schemas)
+	if err != nil {
+		return EventData{}, err
+	}
+	eventData, err := decodeEventDataBytes(pubSubPayload.Message.Data, contentType)
+	if err != nil {
 		return EventData{}, err
 	}
+
+	if len(pubSubPayload.Message.Attributes) > 0 {
+		attributes := make(map[string]string, len(eventData.Attributes)+len(pubSubPayload.Message.Attributes))
+		for name, value := range eventData.Attributes {
+			attributes[name] = value
+		}
+		for name, value := range pubSubPayload.Message.Attributes {
+			attributes[name] = value
+		}
+		eventData.Attributes = attributes
+	}
+	if eventData.IdempotencyKey == "" {
+		eventData.IdempotencyKey = pubSubPayload.Message.MessageId
+	}
+
 	return eventData, nil
 }
 
+// pubSubContentType is the content type of the Pub/Sub message data from its "content-type" attribute or, for topics
+// with a schema, the "googclient_schemaencoding" and "googclient_schemaname" attributes. JSON encoded messages are
+// always [EventData] JSON, binary encoded messages use the content type the schema is configured with, matched by
+// the full schema name or its last path segment.
+func pubSubContentType(attributes map[string]string, schemas map[string]string) (string, error) {
+	if contentType, ok := attributes[pubSubContentTypeAttribute]; ok {
+		return contentType, nil
+	}
+	if attributes[pubSubSchemaEncodingAttribute] != "BINARY" {
+		return cloudevents.ApplicationJSON, nil
+	}
+
+	schemaName := attributes[pubSubSchemaNameAttribute]
+	if contentType, ok := schemas[schemaName]; ok {
+		return contentType, nil
+	}
+	if contentType, ok := schemas[path.Base(schemaName)]; ok {
+		return contentType, nil
+	}
+	return "", fmt.Errorf("unknown Pub/Sub schema \"%s\" for binary message data", schemaName)
+}
+
+// FieldError represents an error that occurs when a field of [EventData] is missing or invalid.
+type FieldError struct {
+	field string
+	err   error
+}
+
+func (fieldError FieldError) Error() string {
+	return fieldError.err.Error()
+}
+
+func (fieldError FieldError) Unwrap() error {
+	return fieldError.err
+}
+
+// Field is the JSON name of the invalid [EventData] field i.e. "to".
+func (fieldError FieldError) Field() string {
+	return fieldError.field
+}
+
 // validateEventData ensures that [EventData] contains appropriate values such as having a valid sender, subject, etc...
-func validateEventData(eventData EventData) error {
+// When the template declares a JSON Schema, or the CloudEvent has a dataschema attribute, [EventData.Data] is
+// validated against it before any rendering happens, see [validateTemplateData].
+func validateEventData(ctx context.Context, app *App, eventData EventData, dataSchema string) error {
 	if eventData.Sender == "" {
-		return errors.New("missing \"sender\"")
+		return FieldError{field: "sender", err: errors.New("missing \"sender\"")}
 	}
 	if _, err := mail.ParseAddress(eventData.Sender); err != nil {
-		return fmt.Errorf("invalid \"sender\" - %v", err)
+		return FieldError{field: "sender", err: fmt.Errorf("invalid \"sender\" - %v", err)}
 	}
 
 	if eventData.Subject == "" {
-		return errors.New("missing \"subject\"")
+		return FieldError{field: "subject", err: errors.New("missing \"subject\"")}
 	}
 
-	if eventData.Body == "" && eventData.Template == "" {
-		return errors.New("either \"body\" or \"template\" should be defined")
+	if eventData.Body == "" && eventData.BodyMarkdown == "" && eventData.Template == "" {
+		return FieldError{field: "body", err: errors.New("either \"body\", \"bodyMarkdown\", or \"template\" should be defined")}
+	}
+
+	if _, ok := priorityHeaders[eventData.Priority]; !ok {
+		return FieldError{
+			field: "priority",
+			err:   fmt.Errorf("invalid \"priority\": \"%s\", expected \"high\", \"normal\", or \"low\"", eventData.Priority),
+		}
+	}
+
+	if len(eventData.Recipients) > 0 {
+		if len(eventData.To) > 0 || len(eventData.Cc) > 0 || len(eventData.Bcc) > 0 {
+			return FieldError{field: "recipients", err: errors.New("\"to\", \"cc\", and \"bcc\" can not be used with \"recipients\"")}
+		}
+		// Recipient addresses and data are validated separately for each recipient so one bad recipient does not
+		// stop the rest from being sent.
+		return nil
 	}
 
 	if len(eventData.To) == 0 {
-		return errors.New("missing \"to\"")
+		return FieldError{field: "to", err: errors.New("missing \"to\" or \"recipients\"")}
 	}
 	if err := validateEmails(eventData.To); err != nil {
-		return fmt.Errorf("invalid \"to\" - %v", err)
+		return FieldError{field: "to", err: fmt.Errorf("invalid \"to\" - %v", err)}
 	}
 
 	if err := validateEmails(eventData.Cc); err != nil {
-		return fmt.Errorf("invalid \"cc\" - %v", err)
+		return FieldError{field: "cc", err: fmt.Errorf("invalid \"cc\" - %v", err)}
 	}
 
 	if err := validateEmails(eventData.Bcc); err != nil {
-		return fmt.Errorf("invalid \"bcc\" - %v", err)
+		return FieldError{field: "bcc", err: fmt.Errorf("invalid \"bcc\" - %v", err)}
 	}
 
-	return nil
+	return validateTemplateData(ctx, app, eventData, dataSchema)
 }
 
 // validateEmails loops over a slice of strings and checks if they are valid emails. This function fails fast so the
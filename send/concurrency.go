@@ -0,0 +1,35 @@
+package send
+
+import (
+	"context"
+	"sync"
+)
+
+// concurrently calls fn for every index from 0 to n-1, at most limit at a time, and waits for every call to return.
+// Once the context is done no more calls are started, skipped is called instead for each remaining index with the
+// context error.
+func concurrently(ctx context.Context, limit int, n int, fn func(i int), skipped func(i int, err error)) {
+	semaphore := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if err := ctx.Err(); err != nil {
+			skipped(i, err)
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,449 @@
+package send
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"path"
+	"sort"
+	"strings"
+)
+
+// dynamicPseudoClasses can never match in a static email so rules using them are kept in the head instead of inlined.
+var dynamicPseudoClasses = []string{":hover", ":active", ":focus", ":visited", ":target"}
+
+// cssRule is a single "selectors { declarations }" rule from a stylesheet.
+type cssRule struct {
+	// source is the original text of the rule, used when the rule has to be kept in the head.
+	source       string
+	selectors    string
+	declarations []cssDeclaration
+}
+
+// cssDeclaration is a single "property: value" pair.
+type cssDeclaration struct {
+	property  string
+	value     string
+	important bool
+}
+
+// cssMatch is a declaration which applies to an element along with everything needed to determine which declaration
+// wins when multiple declarations set the same property.
+type cssMatch struct {
+	declaration cssDeclaration
+	inline      bool
+	specificity cascadia.Specificity
+	order       int
+}
+
+// less reports whether m loses to other in the [cascade].
+//
+// [cascade]: https://developer.mozilla.org/en-US/docs/Web/CSS/Cascade
+func (m cssMatch) less(other cssMatch) bool {
+	if m.declaration.important != other.declaration.important {
+		return !m.declaration.important
+	}
+	if m.inline != other.inline {
+		return !m.inline
+	}
+	if m.specificity != other.specificity {
+		return m.specificity.Less(other.specificity)
+	}
+
+	return m.order < other.order
+}
+
+// InlineCSSError represents an error that occurs when CSS fails to be inlined into the email body.
+type InlineCSSError struct {
+	err error
+}
+
+func (inlineCSSError InlineCSSError) Error() string {
+	return fmt.Sprintf("failed to inline CSS - %v", inlineCSSError.err)
+}
+
+func (inlineCSSError InlineCSSError) Unwrap() error {
+	return inlineCSSError.err
+}
+
+// inlineCSS moves the rules from <style> elements, and stylesheets linked from the App.fileStorage, into the style
+// attribute of the elements they match. Many email clients, Gmail and Outlook included, strip <style> elements so
+// inlining is the only reliable way to style an email. Rules that can not be inlined, such as media queries and
+// :hover, are kept in a <style> element in the head for the email clients that do support them. Stylesheet links are
+// resolved relative to the template name, links to absolute URLs are left alone.
+func inlineCSS(ctx context.Context, app *App, templateName string, body string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return "", InlineCSSError{err: err}
+	}
+
+	var stylesheets []string
+	var remove []*html.Node
+	for _, n := range findElements(doc, atom.Style, atom.Link) {
+		if media := attr(n, "media"); media != "" && media != "all" && media != "screen" {
+			continue
+		}
+
+		switch n.DataAtom {
+		case atom.Style:
+			if n.FirstChild != nil {
+				stylesheets = append(stylesheets, n.FirstChild.Data)
+			}
+			remove = append(remove, n)
+		case atom.Link:
+			href := attr(n, "href")
+			if !isLinkedStylesheet(n) {
+				continue
+			}
+			contents, err := readTemplate(ctx, app, stylesheetName(templateName, href))
+			if err != nil {
+				return "", InlineCSSError{err: err}
+			}
+			stylesheets = append(stylesheets, contents)
+			remove = append(remove, n)
+		}
+	}
+	if len(remove) == 0 {
+		return body, nil
+	}
+	for _, n := range remove {
+		n.Parent.RemoveChild(n)
+	}
+
+	var rules []cssRule
+	var kept []string
+	for _, stylesheet := range stylesheets {
+		r, k := parseStylesheet(stylesheet)
+		rules = append(rules, r...)
+		kept = append(kept, k...)
+	}
+
+	matches := make(map[*html.Node][]cssMatch)
+	for order, rule := range rules {
+		inlinable := true
+		for _, selector := range strings.Split(rule.selectors, ",") {
+			sel, err := cascadia.ParseWithPseudoElement(strings.TrimSpace(selector))
+			if err != nil || sel.PseudoElement() != "" || hasDynamicPseudoClass(selector) {
+				inlinable = false
+				continue
+			}
+			for _, n := range cascadia.QueryAll(doc, sel) {
+				for _, declaration := range rule.declarations {
+					matches[n] = append(matches[n], cssMatch{
+						declaration: declaration,
+						specificity: sel.Specificity(),
+						order:       order,
+					})
+				}
+			}
+		}
+		if !inlinable {
+			kept = append(kept, rule.source)
+		}
+	}
+
+	for n, nodeMatches := range matches {
+		for _, declaration := range parseDeclarations(attr(n, "style")) {
+			nodeMatches = append(nodeMatches, cssMatch{declaration: declaration, inline: true})
+		}
+		setAttr(n, "style", cascadeDeclarations(nodeMatches))
+	}
+
+	if len(kept) > 0 {
+		if head := findElements(doc, atom.Head); len(head) > 0 {
+			style := &html.Node{Type: html.ElementNode, Data: "style", DataAtom: atom.Style}
+			style.AppendChild(&html.Node{Type: html.TextNode, Data: strings.Join(kept, "\n")})
+			head[0].AppendChild(style)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, doc); err != nil {
+		return "", InlineCSSError{err: err}
+	}
+	return buf.String(), nil
+}
+
+// cascadeDeclarations picks the winning declaration for each property and formats them as a style attribute value.
+// Properties are written in the order they were first declared.
+func cascadeDeclarations(matches []cssMatch) string {
+	winners := make(map[string]cssMatch)
+	var properties []string
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].less(matches[j])
+	})
+	for _, m := range matches {
+		if _, ok := winners[m.declaration.property]; !ok {
+			properties = append(properties, m.declaration.property)
+		}
+		winners[m.declaration.property] = m
+	}
+
+	var style []string
+	for _, property := range properties {
+		declaration := winners[property].declaration
+		value := declaration.value
+		if declaration.important {
+			value += " !important"
+		}
+		style = append(style, property+": "+value)
+	}
+
+	return strings.Join(style, "; ")
+}
+
+// parseStylesheet splits a stylesheet into rules which can be inlined and the source of at-rules, such as @media
+// and @font-face, which need to stay in a <style> element.
+func parseStylesheet(stylesheet string) ([]cssRule, []string) {
+	css := stripCSSComments(stylesheet)
+	var rules []cssRule
+	var kept []string
+
+	for i := 0; i < len(css); {
+		for i < len(css) && isCSSSpace(css[i]) {
+			i++
+		}
+		if i >= len(css) {
+			break
+		}
+
+		start := i
+		open := indexOutsideQuotes(css, i, '{')
+		if css[i] == '@' {
+			semicolon := indexOutsideQuotes(css, i, ';')
+			if semicolon != -1 && (open == -1 || semicolon < open) {
+				kept = append(kept, strings.TrimSpace(css[start:semicolon+1]))
+				i = semicolon + 1
+				continue
+			}
+		}
+		if open == -1 {
+			break
+		}
+		end := matchingBrace(css, open)
+		if end == -1 {
+			end = len(css) - 1
+		}
+
+		source := strings.TrimSpace(css[start : end+1])
+		if css[i] == '@' {
+			kept = append(kept, source)
+		} else {
+			rules = append(rules, cssRule{
+				source:       source,
+				selectors:    strings.TrimSpace(css[start:open]),
+				declarations: parseDeclarations(css[open+1 : end]),
+			})
+		}
+		i = end + 1
+	}
+
+	return rules, kept
+}
+
+// parseDeclarations parses "property: value; property: value" as found in a rule block or style attribute.
+func parseDeclarations(block string) []cssDeclaration {
+	var declarations []cssDeclaration
+	for _, raw := range splitOutsideQuotes(block, ';') {
+		colon := strings.Index(raw, ":")
+		if colon == -1 {
+			continue
+		}
+		property := strings.ToLower(strings.TrimSpace(raw[:colon]))
+		value := strings.TrimSpace(raw[colon+1:])
+		if property == "" || value == "" {
+			continue
+		}
+
+		important := false
+		if i := strings.LastIndex(strings.ToLower(value), "!important"); i != -1 {
+			important = true
+			value = strings.TrimSpace(value[:i])
+		}
+		declarations = append(declarations, cssDeclaration{property: property, value: value, important: important})
+	}
+
+	return declarations
+}
+
+// stripCSSComments removes /* comments */ from css.
+func stripCSSComments(css string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(css, "/*")
+		if start == -1 {
+			b.WriteString(css)
+			return b.String()
+		}
+		b.WriteString(css[:start])
+		end := strings.Index(css[start+2:], "*/")
+		if end == -1 {
+			return b.String()
+		}
+		css = css[start+2+end+2:]
+	}
+}
+
+// indexOutsideQuotes returns the index of the first c at or after start that is not inside a quoted string or -1.
+func indexOutsideQuotes(s string, start int, c byte) int {
+	var quote byte
+	for i := start; i < len(s); i++ {
+		switch {
+		case quote != 0:
+			if s[i] == '\\' {
+				i++
+			} else if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '"' || s[i] == '\'':
+			quote = s[i]
+		case s[i] == c:
+			return i
+		}
+	}
+
+	return -1
+}
+
+// matchingBrace returns the index of the "}" closing the "{" at open or -1.
+func matchingBrace(s string, open int) int {
+	var quote byte
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch {
+		case quote != 0:
+			if s[i] == '\\' {
+				i++
+			} else if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '"' || s[i] == '\'':
+			quote = s[i]
+		case s[i] == '{':
+			depth++
+		case s[i] == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// splitOutsideQuotes splits s on sep ignoring any sep inside quoted strings or parentheses i.e. url(data:...;...).
+func splitOutsideQuotes(s string, sep byte) []string {
+	var parts []string
+	var quote byte
+	depth := 0
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote != 0:
+			if s[i] == '\\' {
+				i++
+			} else if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '"' || s[i] == '\'':
+			quote = s[i]
+		case s[i] == '(':
+			depth++
+		case s[i] == ')':
+			depth--
+		case s[i] == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+func isCSSSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\t' || c == '\r' || c == '\f'
+}
+
+func hasDynamicPseudoClass(selector string) bool {
+	for _, pseudoClass := range dynamicPseudoClasses {
+		if strings.Contains(selector, pseudoClass) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findElements returns every element in document order matching one of the atoms.
+func findElements(n *html.Node, atoms ...atom.Atom) []*html.Node {
+	var found []*html.Node
+	if n.Type == html.ElementNode {
+		for _, a := range atoms {
+			if n.DataAtom == a {
+				found = append(found, n)
+				break
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		found = append(found, findElements(c, atoms...)...)
+	}
+
+	return found
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+
+	return ""
+}
+
+func setAttr(n *html.Node, key string, val string) {
+	for i, a := range n.Attr {
+		if a.Key == key {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
+
+// isLinkedStylesheet reports whether the element is a <link> to a stylesheet in file storage rather than at an
+// absolute URL.
+func isLinkedStylesheet(n *html.Node) bool {
+	href := attr(n, "href")
+	return strings.EqualFold(attr(n, "rel"), "stylesheet") && href != "" && !strings.Contains(href, "//")
+}
+
+// stylesheetName is the file storage location of a stylesheet linked from a template. Links are relative to the
+// template, or to the root of the file storage when they start with "/", which for a published template version is
+// the root the version was copied to.
+func stylesheetName(templateName string, href string) string {
+	if strings.HasPrefix(href, "/") {
+		return publishedRoot(templateName) + strings.TrimPrefix(href, "/")
+	}
+	return path.Join(path.Dir(templateName), href)
+}
+
+// linkedStylesheets returns the href of every stylesheet in file storage linked from the HTML.
+func linkedStylesheets(source string) []string {
+	doc, err := html.Parse(strings.NewReader(source))
+	if err != nil {
+		return nil
+	}
+	var hrefs []string
+	for _, n := range findElements(doc, atom.Link) {
+		if isLinkedStylesheet(n) {
+			hrefs = append(hrefs, attr(n, "href"))
+		}
+	}
+	return hrefs
+}
@@ -0,0 +1,111 @@
+package send_test
+
+import (
+	"context"
+	"github.com/itmayziii/email/send"
+	"gocloud.dev/blob/memblob"
+	"strings"
+	"testing"
+)
+
+func TestAppWithInlineCSS_InlinesStyles(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		contains []string
+		excludes []string
+	}{
+		{
+			"style element",
+			`<html><head><style>p { color: red; }</style></head><body><p>hi</p></body></html>`,
+			[]string{`<p style="color: red">hi</p>`},
+			[]string{"<style>"},
+		},
+		{
+			"specificity",
+			`<html><head><style>#a { color: blue } p.b { color: green } p { color: red; margin: 0 }</style></head>` +
+				`<body><p id="a" class="b">hi</p></body></html>`,
+			[]string{`<p id="a" class="b" style="color: blue; margin: 0">hi</p>`},
+			nil,
+		},
+		{
+			"source order breaks ties",
+			`<html><head><style>p { color: red } p { color: green }</style></head><body><p>hi</p></body></html>`,
+			[]string{`<p style="color: green">hi</p>`},
+			nil,
+		},
+		{
+			"inline style wins unless important",
+			`<html><head><style>p { color: red; font-size: 12px !important }</style></head>` +
+				`<body><p style="color: blue; font-size: 20px">hi</p></body></html>`,
+			[]string{`<p style="color: blue; font-size: 12px !important">hi</p>`},
+			nil,
+		},
+		{
+			"media queries and hover stay in head",
+			`<html><head><style>a { color: red } a:hover { color: blue } @media (max-width: 600px) { a { color: green } }` +
+				`</style></head><body><a href="#">hi</a></body></html>`,
+			[]string{
+				`<a href="#" style="color: red">hi</a>`,
+				"<head><style>@media (max-width: 600px) { a { color: green } }\na:hover { color: blue }</style></head>",
+			},
+			nil,
+		},
+		{
+			"linked stylesheet",
+			`<html><head><link rel="stylesheet" href="css/main.css"></head><body><h1>hi</h1></body></html>`,
+			[]string{`<h1 style="font-weight: bold">hi</h1>`},
+			[]string{"<link"},
+		},
+		{
+			"absolute stylesheet left alone",
+			`<html><head><link rel="stylesheet" href="https://example.com/main.css"></head><body><h1>hi</h1></body></html>`,
+			[]string{`<link rel="stylesheet" href="https://example.com/main.css">`, "<h1>hi</h1>"},
+			nil,
+		},
+	}
+
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	t.Cleanup(func() { _ = bucket.Close() })
+	if err := bucket.WriteAll(ctx, "emails/css/main.css", []byte("/* headings */ h1 { font-weight: bold; }"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		ttCopy := tt
+		t.Run(ttCopy.name, func(t *testing.T) {
+			t.Parallel()
+			if err := bucket.WriteAll(ctx, "emails/"+ttCopy.name+".html", []byte(ttCopy.body), nil); err != nil {
+				t.Fatal(err)
+			}
+			sender := &recordingSender{}
+			app := send.NewApp(
+				send.AppWithFileStorage(bucket),
+				send.AppWithDomainSender("example.com", sender),
+				send.AppWithInlineCSS(),
+			)
+
+			err := send.EmailEvent(app)(ctx, newEvent(t, map[string]interface{}{
+				"sender":   "no-reply@example.com",
+				"subject":  "test",
+				"to":       "tom@example.com",
+				"template": "emails/" + ttCopy.name + ".html",
+			}))
+			if err != nil {
+				t.Fatalf("case: \"%s\", unexpected error: %v", ttCopy.name, err)
+			}
+			body := sender.messages[0].Body
+			for _, expected := range ttCopy.contains {
+				if !strings.Contains(body, expected) {
+					t.Errorf("expected %q to contain %q", body, expected)
+				}
+			}
+			for _, unexpected := range ttCopy.excludes {
+				if strings.Contains(body, unexpected) {
+					t.Errorf("expected %q to not contain %q", body, unexpected)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package send
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DeliveryStatus is the state of an email sent to a single recipient.
+type DeliveryStatus string
+
+const (
+	// StatusSent means the email was accepted by the email provider.
+	StatusSent DeliveryStatus = "sent"
+	// StatusFailed means the email provider did not accept the email.
+	StatusFailed DeliveryStatus = "failed"
+	// StatusDelivered means the recipient's mail server accepted the email.
+	StatusDelivered DeliveryStatus = "delivered"
+	// StatusDeferred means delivery failed temporarily and the email provider will try again.
+	StatusDeferred DeliveryStatus = "deferred"
+	// StatusBounced means delivery failed permanently, the recipient is suppressed.
+	StatusBounced DeliveryStatus = "bounced"
+	// StatusComplained means the recipient marked the email as spam, the recipient is suppressed.
+	StatusComplained DeliveryStatus = "complained"
+	// StatusUnsubscribed means the recipient unsubscribed, the recipient is suppressed.
+	StatusUnsubscribed DeliveryStatus = "unsubscribed"
+	// StatusOpened means the recipient opened the email.
+	StatusOpened DeliveryStatus = "opened"
+	// StatusClicked means the recipient clicked a link in the email.
+	StatusClicked DeliveryStatus = "clicked"
+)
+
+// DeliveryEvent is a change in the [DeliveryStatus] of an email, recorded when the email is sent and when the email
+// provider reports what happened to it i.e. through a webhook.
+type DeliveryEvent struct {
+	// ID identifies the event with the email provider, it is empty for events recorded by this package.
+	ID string `json:"id,omitempty"`
+	// MessageID is the id returned by the [Sender] for the email without any surrounding "<>".
+	MessageID string         `json:"messageId"`
+	Recipient string         `json:"recipient"`
+	Status    DeliveryStatus `json:"status"`
+	// Reason describes failures i.e. the bounce message from the recipient's mail server.
+	Reason string `json:"reason,omitempty"`
+	// Provider is the email provider which reported the event i.e. "mailgun".
+	Provider        string    `json:"provider,omitempty"`
+	Sender          string    `json:"sender,omitempty"`
+	Subject         string    `json:"subject,omitempty"`
+	Category        string    `json:"category,omitempty"`
+	Template        string    `json:"template,omitempty"`
+	TemplateVersion string    `json:"templateVersion,omitempty"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+// SendLog records every [DeliveryEvent] so the history of an email can be looked up. Implementations must be safe
+// for concurrent use.
+type SendLog interface {
+	Record(ctx context.Context, event DeliveryEvent) error
+}
+
+// MemorySendLog is a [SendLog] which keeps events in memory, it is only suitable for testing.
+type MemorySendLog struct {
+	mu     sync.Mutex
+	events []DeliveryEvent
+}
+
+// NewMemorySendLog constructs a [MemorySendLog].
+func NewMemorySendLog() *MemorySendLog {
+	return &MemorySendLog{}
+}
+
+func (sendLog *MemorySendLog) Record(ctx context.Context, event DeliveryEvent) error {
+	sendLog.mu.Lock()
+	defer sendLog.mu.Unlock()
+	sendLog.events = append(sendLog.events, event)
+	return nil
+}
+
+// Events returns every recorded event in the order they were recorded.
+func (sendLog *MemorySendLog) Events() []DeliveryEvent {
+	sendLog.mu.Lock()
+	defer sendLog.mu.Unlock()
+	return append([]DeliveryEvent(nil), sendLog.events...)
+}
+
+// RecordDelivery records a [DeliveryEvent] reported by an email provider in the [SendLog] configured with
+// [AppWithSendLog] and suppresses the recipient in the [SuppressionStore] configured with [AppWithSuppressionStore]
+// when the email bounced, the recipient complained, or the recipient unsubscribed. Bounces and complaints are
+// suppressed globally, unsubscribes are suppressed for the event Category, or the sender domain when there is none.
+func RecordDelivery(ctx context.Context, app *App, event DeliveryEvent) error {
+	event.MessageID = normalizeMessageID(event.MessageID)
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+	app.infoLogger.Printf(
+		"email %s: message id: %s, recipient: %s, reason: %s\n",
+		event.Status,
+		event.MessageID,
+		event.Recipient,
+		event.Reason,
+	)
+
+	if app.sendLog != nil {
+		if err := app.sendLog.Record(ctx, event); err != nil {
+			return err
+		}
+	}
+
+	suppression := Suppression{Email: event.Recipient, CreatedAt: event.Timestamp}
+	switch event.Status {
+	case StatusBounced:
+		suppression.Reason = SuppressionBounce
+	case StatusComplained:
+		suppression.Reason = SuppressionComplaint
+	case StatusUnsubscribed:
+		suppression.Reason = SuppressionUnsubscribe
+		suppression.Scope.Category = event.Category
+		if event.Category == "" {
+			suppression.Scope.Domain, _ = extractEmailDomain(normalizeEmail(event.Sender))
+		}
+	default:
+		return nil
+	}
+	if app.suppressionStore == nil {
+		return nil
+	}
+	return Suppress(ctx, app, suppression)
+}
+
+// recordSend records that an email was sent, or failed to send, to every [EventData.To] in the [SendLog].
+func recordSend(ctx context.Context, app *App, eventData EventData, version string, id string, sendErr error) {
+	if app.sendLog == nil || dryRunFrom(ctx) != nil {
+		return
+	}
+
+	event := DeliveryEvent{
+		MessageID:       normalizeMessageID(id),
+		Status:          StatusSent,
+		Sender:          eventData.Sender,
+		Subject:         eventData.Subject,
+		Category:        eventData.Category,
+		Template:        eventData.Template,
+		TemplateVersion: version,
+		Timestamp:       time.Now().UTC(),
+	}
+	if sendErr != nil {
+		event.Status = StatusFailed
+		event.Reason = sendErr.Error()
+	}
+	for _, recipient := range eventData.To {
+		event.Recipient = recipient
+		if err := app.sendLog.Record(ctx, event); err != nil {
+			app.errorLogger.Printf("failed to record %s email in the send log - %v", event.Status, err)
+		}
+	}
+}
+
+// normalizeMessageID removes the "<>" some email providers wrap message ids in.
+func normalizeMessageID(id string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(id), "<"), ">")
+}
@@ -0,0 +1,61 @@
+package send_test
+
+import (
+	"context"
+	"github.com/itmayziii/email/send"
+	"testing"
+)
+
+func TestEmailEvent_RecordsSendLog(t *testing.T) {
+	t.Parallel()
+	sendLog := send.NewMemorySendLog()
+	app := send.NewApp(send.AppWithDomainSender("example.com", &recordingSender{}), send.AppWithSendLog(sendLog))
+
+	err := send.EmailEvent(app)(context.Background(), newEvent(t, map[string]interface{}{
+		"sender":   "no-reply@example.com",
+		"subject":  "test",
+		"to":       []string{"tom@example.com", "jane@example.com"},
+		"body":     "hello",
+		"category": "receipts",
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	events := sendLog.Events()
+	if len(events) != 2 {
+		t.Fatalf("expected an event per recipient, got %+v", events)
+	}
+	for i, recipient := range []string{"tom@example.com", "jane@example.com"} {
+		event := events[i]
+		if event.Recipient != recipient || event.Status != send.StatusSent || event.MessageID != "id" || event.Category != "receipts" {
+			t.Errorf("unexpected event %+v", event)
+		}
+	}
+}
+
+func TestRecordDelivery_SuppressesUnsubscribeByCategory(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	store := send.NewMemorySuppressionStore()
+	app := send.NewApp(send.AppWithSuppressionStore(store))
+
+	err := send.RecordDelivery(ctx, app, send.DeliveryEvent{
+		MessageID: "<id@example.com>",
+		Recipient: "Tom@example.com",
+		Status:    send.StatusUnsubscribed,
+		Sender:    "Example <no-reply@example.com>",
+		Category:  "newsletter",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := store.Find(ctx, []string{"tom@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Scope != (send.SuppressionScope{Category: "newsletter"}) {
+		t.Errorf("expected a newsletter suppression, got %+v", found)
+	}
+}
@@ -0,0 +1,84 @@
+package send
+
+import (
+	"context"
+	"encoding/json"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/types"
+	"sync"
+)
+
+// DryRunExtension is the CloudEvent extension attribute which, when "true", handles a single event as a dry run, see
+// [AppWithDryRun].
+const DryRunExtension = "dryrun"
+
+// DryRunResult is an email which would have been sent if it was not a dry run.
+type DryRunResult struct {
+	// Message is the fully rendered email, after suppressions and the [Sandbox] were applied.
+	Message Message
+	// Sender is the [Sender] registered for the sender domain which would have sent the Message.
+	Sender Sender
+	// Domain is the sender domain the Sender was chosen by.
+	Domain string
+}
+
+// dryRunKey is the context key of the dryRun collecting the results of a dry run.
+type dryRunKey struct{}
+
+// dryRun collects the emails which would have been sent, batches are sent concurrently so it is safe for concurrent
+// use.
+type dryRun struct {
+	mu      sync.Mutex
+	results []DryRunResult
+}
+
+func (dryRun *dryRun) add(result DryRunResult) {
+	dryRun.mu.Lock()
+	defer dryRun.mu.Unlock()
+	dryRun.results = append(dryRun.results, result)
+}
+
+// withDryRun returns a context which makes every email sent with it a dry run.
+func withDryRun(ctx context.Context) (context.Context, *dryRun) {
+	run := &dryRun{}
+	return context.WithValue(ctx, dryRunKey{}, run), run
+}
+
+// dryRunFrom returns the dry run of the context, it is nil when emails should be sent.
+func dryRunFrom(ctx context.Context) *dryRun {
+	run, _ := ctx.Value(dryRunKey{}).(*dryRun)
+	return run
+}
+
+// isDryRunEvent reports whether the CloudEvent has the [DryRunExtension] set to true.
+func isDryRunEvent(event cloudevents.Event) bool {
+	value, ok := event.Extensions()[DryRunExtension]
+	if !ok {
+		return false
+	}
+	dryRun, err := types.ToBool(value)
+	return err == nil && dryRun
+}
+
+// recordDryRun logs the email which would have been sent and adds it to the dry run results.
+func recordDryRun(app *App, run *dryRun, result DryRunResult) {
+	message, err := json.Marshal(result.Message)
+	if err != nil {
+		app.errorLogger.Printf("failed to log dry run message - %v", err)
+	}
+	app.infoLogger.Printf("dry run, email not sent: domain: %s, sender: %T, message: %s\n", result.Domain, result.Sender, message)
+	run.add(result)
+}
+
+// DryRun handles a CloudEvent the same way as [EmailEvent], extracting, validating, rendering, and choosing the
+// [Sender] for the email, without sending it. Emails are not scheduled, recorded in the [SendLog], or published with
+// the [ResultPublisher] either. The emails which would have been sent are returned, an email to
+// [EventData.Recipients] returns a result per recipient.
+func DryRun(ctx context.Context, app *App, event cloudevents.Event) ([]DryRunResult, error) {
+	ctx, run := withDryRun(ctx)
+	if err := handleEmailEvent(ctx, app, event); err != nil {
+		return nil, err
+	}
+
+	return run.results, nil
+}
@@ -0,0 +1,132 @@
+package send_test
+
+import (
+	"bytes"
+	"context"
+	"github.com/itmayziii/email/send"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEmailEvent_DryRun(t *testing.T) {
+	tests := []struct {
+		name      string
+		appDryRun bool
+		extension interface{}
+		expectRun bool
+	}{
+		{"app dry run", true, nil, true},
+		{"event extension", false, "true", true},
+		{"event extension bool", false, true, true},
+		{"event extension false", false, "false", false},
+		{"no dry run", false, nil, false},
+	}
+
+	for _, tt := range tests {
+		ttCopy := tt
+		t.Run(ttCopy.name, func(t *testing.T) {
+			t.Parallel()
+			var logs bytes.Buffer
+			sender := &recordingSender{}
+			sendLog := send.NewMemorySendLog()
+			publisher := &recordingPublisher{}
+			opts := []send.AppOption{
+				send.AppWithDomainSender("example.com", sender),
+				send.AppWithSendLog(sendLog),
+				send.AppWithResultPublisher(publisher, "test"),
+				send.AppWithInfoLogger(log.New(&logs, "", 0)),
+			}
+			if ttCopy.appDryRun {
+				opts = append(opts, send.AppWithDryRun())
+			}
+			app := send.NewApp(opts...)
+
+			event := newEvent(t, map[string]interface{}{
+				"sender":  "no-reply@example.com",
+				"subject": "test",
+				"to":      "tom@example.com",
+				"body":    "hello {{ .Name }}",
+				"data":    map[string]interface{}{"name": "Tom"},
+			})
+			if ttCopy.extension != nil {
+				event.SetExtension(send.DryRunExtension, ttCopy.extension)
+			}
+			if err := send.EmailEvent(app)(context.Background(), event); err != nil {
+				t.Fatalf("case: \"%s\", unexpected error: %v", ttCopy.name, err)
+			}
+
+			dryRunLogged := strings.Contains(logs.String(), "dry run, email not sent") && strings.Contains(logs.String(), "hello Tom")
+			if !ttCopy.expectRun {
+				if len(sender.messages) != 1 || dryRunLogged {
+					t.Errorf("case: \"%s\", expected the email to be sent, got %d messages", ttCopy.name, len(sender.messages))
+				}
+				return
+			}
+			if len(sender.messages) != 0 || len(sendLog.Events()) != 0 || len(publisher.events) != 0 {
+				t.Errorf("case: \"%s\", expected no side effects from a dry run", ttCopy.name)
+			}
+			if !dryRunLogged {
+				t.Errorf("case: \"%s\", expected the rendered message to be logged, got %s", ttCopy.name, logs.String())
+			}
+		})
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	t.Parallel()
+	sender := &recordingSender{}
+	store := send.NewMemoryScheduleStore()
+	app := send.NewApp(send.AppWithDomainSender("example.com", sender), send.AppWithScheduleStore(store))
+
+	results, err := send.DryRun(context.Background(), app, newEvent(t, map[string]interface{}{
+		"sender":  "no-reply@example.com",
+		"subject": "test",
+		"body":    "hello {{ .Name }}",
+		"sendAt":  time.Now().Add(time.Hour).Format(time.RFC3339),
+		"recipients": []map[string]interface{}{
+			{"to": "tom@example.com", "data": map[string]interface{}{"name": "Tom"}},
+			{"to": "jane@example.com", "data": map[string]interface{}{"name": "Jane"}},
+		},
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sender.messages) != 0 {
+		t.Errorf("expected no messages to be sent, got %+v", sender.messages)
+	}
+	due, err := store.Due(context.Background(), time.Now().Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 0 {
+		t.Errorf("expected a dry run not to schedule the email, got %+v", due)
+	}
+
+	bodies := make(map[string]string)
+	for _, result := range results {
+		if result.Sender != sender || result.Domain != "example.com" {
+			t.Errorf("unexpected sender %+v", result)
+		}
+		bodies[result.Message.To[0]] = result.Message.Body
+	}
+	if bodies["tom@example.com"] != "hello Tom" || bodies["jane@example.com"] != "hello Jane" {
+		t.Errorf("expected a rendered message per recipient, got %+v", bodies)
+	}
+}
+
+func TestDryRun_InvalidEvent(t *testing.T) {
+	t.Parallel()
+	app := send.NewApp(send.AppWithDomainSender("example.com", &recordingSender{}))
+
+	_, err := send.DryRun(context.Background(), app, newEvent(t, map[string]interface{}{
+		"sender":  "no-reply@example.com",
+		"subject": "test",
+		"to":      "not an email",
+		"body":    "hello",
+	}))
+	if err == nil {
+		t.Fatal("expected a validation error")
+	}
+}
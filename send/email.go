@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 )
 
 // Sender sends an email with the provided Message and returns the ID identifying the request. It should be noted
@@ -16,10 +17,29 @@ type Sender interface {
 type Message struct {
 	Sender  string
 	Subject string
-	Body    string
-	To      []string
-	Cc      []string
-	Bcc     []string
+	// Body is the HTML body of the email.
+	Body string
+	// Text is the plain text body of the email, it may be provided alongside Body as an alternative.
+	Text string
+	To   []string
+	Cc   []string
+	Bcc  []string
+	// Category is the [EventData.Category] of the email, providers which support it should attach it to the email so
+	// it is included in webhooks.
+	Category string
+	// SendAt is when the email should be delivered, the zero value means immediately. It is only set for a
+	// [ScheduledSender].
+	SendAt time.Time
+	// Headers are additional email headers i.e. List-Unsubscribe.
+	Headers map[string]string
+}
+
+// ScheduledSender is a [Sender] which can have the email provider deliver an email at a later time, see
+// [Message.SendAt].
+type ScheduledSender interface {
+	Sender
+	// MaxScheduleDelay is how far in the future the provider accepts [Message.SendAt].
+	MaxScheduleDelay() time.Duration
 }
 
 // NoopSender implements the [Sender] interface but doesn't actually send any emails which is helpful for testing
@@ -30,27 +50,70 @@ func (ns NoopSender) Send(ctx context.Context, m Message) (string, error) {
 	return "", nil
 }
 
-// determineEmailBody takes the [EventData.Body] or [EventData.Template] and executes them as
-// Go HTML templates with variables being provided by [EventData.Data]. The result should be HTML appropriate to
-// use as an email body.
+// Body is the rendered content of an email, at least one of HTML or Text will be populated.
+type Body struct {
+	HTML string
+	Text string
+}
+
+// determineEmailBody takes the [EventData.Body], [EventData.BodyMarkdown], or [EventData.Template] and executes them
+// with the chosen [TemplateEngine], by default as [Go HTML templates], with variables being provided by
+// [EventData.Data]. The result is HTML and/or plain text appropriate to use as an email body depending on the engine.
 //
 // [Go HTML templates]: https://pkg.go.dev/html/template
-func determineEmailBody(ctx context.Context, app *App, msgData EventData) (string, error) {
+func determineEmailBody(ctx context.Context, app *App, msgData EventData) (Body, error) {
+	engine, err := chooseTemplateEngine(app, msgData)
+	if err != nil {
+		return Body{}, err
+	}
+
+	name := "body"
 	unparsedBody := msgData.Body
+	if unparsedBody == "" {
+		unparsedBody = msgData.BodyMarkdown
+	}
 	if unparsedBody == "" {
 		templateBody, err := readTemplate(ctx, app, msgData.Template)
 		if err != nil {
-			return "", err
+			return Body{}, err
 		}
-		unparsedBody = templateBody
+		name = msgData.Template
+		_, unparsedBody = splitFrontMatter(templateBody)
 	}
 
-	body, err := executeTemplate(unparsedBody, msgData.Data)
+	body, err := engine.Execute(ctx, TemplateInput{
+		Name:        name,
+		Source:      unparsedBody,
+		Data:        templateData(msgData),
+		Funcs:       messageTemplateFuncs(app, msgData),
+		FileStorage: app.fileStorage,
+	})
 	if err != nil {
-		return "", err
+		return Body{}, err
+	}
+
+	var rendered Body
+	switch engine.ContentType() {
+	case contentTypeText:
+		return Body{Text: body}, nil
+	case contentTypeMarkdown:
+		html, err := renderMarkdown(ctx, app, msgData, body)
+		if err != nil {
+			return Body{}, err
+		}
+		name = app.markdownLayout
+		rendered = Body{HTML: html, Text: body}
+	default:
+		rendered = Body{HTML: body}
 	}
 
-	return body, nil
+	if app.inlineCSS {
+		rendered.HTML, err = inlineCSS(ctx, app, name, rendered.HTML)
+		if err != nil {
+			return Body{}, err
+		}
+	}
+	return rendered, nil
 }
 
 // extractEmailDomain returns the email domain and gives an error if no domain was found
@@ -0,0 +1,10 @@
+// Package emailpb is the Protobuf form of [github.com/itmayziii/email/send.EventData], defined by event_data.proto,
+// for producers which publish binary Protobuf. Convert to and from the event data with
+// [github.com/itmayziii/email/send.MarshalProtobuf] and [github.com/itmayziii/email/send.UnmarshalProtobuf].
+//
+// It is also the EmailService gRPC service, defined by email_service.proto and served by
+// [github.com/itmayziii/email/send.RegisterEmailService].
+package emailpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative event_data.proto
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative email_service.proto
@@ -0,0 +1,331 @@
+package send
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"github.com/itmayziii/email/send/emailpb"
+	"github.com/linkedin/goavro/v2"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"mime"
+	"time"
+)
+
+// Content types of the binary forms of [EventData], set as the CloudEvent datacontenttype.
+const (
+	ContentTypeProtobuf = "application/protobuf"
+	ContentTypeAvro     = "avro/binary"
+)
+
+// AvroSchema is the Avro schema of [EventData]. Data variables are a JSON object encoded as a string because Avro
+// can not represent arbitrary JSON.
+//
+//go:embed event_data.avsc
+var AvroSchema string
+
+var avroCodec = mustAvroCodec()
+
+func mustAvroCodec() *goavro.Codec {
+	codec, err := goavro.NewCodec(AvroSchema)
+	if err != nil {
+		panic(fmt.Sprintf("invalid Avro schema - %v", err))
+	}
+	return codec
+}
+
+// binaryContentTypes maps the content types of binary [EventData] forms to their decoders, other content types are
+// decoded as JSON.
+var binaryContentTypes = map[string]func([]byte) (EventData, error){
+	ContentTypeProtobuf:      UnmarshalProtobuf,
+	"application/x-protobuf": UnmarshalProtobuf,
+	ContentTypeAvro:          UnmarshalAvro,
+	"application/avro":       UnmarshalAvro,
+}
+
+// binaryDecoder returns the decoder for the content type when it is a binary [EventData] form.
+func binaryDecoder(contentType string) (func([]byte) (EventData, error), bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	decoder, ok := binaryContentTypes[mediaType]
+	return decoder, ok
+}
+
+// decodeEventDataBytes decodes the Protobuf, Avro, or JSON form of [EventData] based on the content type.
+func decodeEventDataBytes(data []byte, contentType string) (EventData, error) {
+	if decoder, ok := binaryDecoder(contentType); ok {
+		return decoder(data)
+	}
+
+	var eventData EventData
+	if err := json.Unmarshal(data, &eventData); err != nil {
+		return EventData{}, err
+	}
+	return eventData, nil
+}
+
+// MarshalProtobuf encodes the event data as the [emailpb.EventData] Protobuf message.
+func MarshalProtobuf(eventData EventData) ([]byte, error) {
+	message, err := eventDataToProto(eventData)
+	if err != nil {
+		return nil, err
+	}
+
+	return proto.Marshal(message)
+}
+
+// UnmarshalProtobuf decodes event data encoded as the [emailpb.EventData] Protobuf message.
+func UnmarshalProtobuf(data []byte) (EventData, error) {
+	var message emailpb.EventData
+	if err := proto.Unmarshal(data, &message); err != nil {
+		return EventData{}, err
+	}
+
+	return eventDataFromProto(&message), nil
+}
+
+// eventDataToProto converts the event data to the [emailpb.EventData] Protobuf message.
+func eventDataToProto(eventData EventData) (*emailpb.EventData, error) {
+	data, err := structFromMap(eventData.Data)
+	if err != nil {
+		return nil, err
+	}
+	message := &emailpb.EventData{
+		Sender:         eventData.Sender,
+		Subject:        eventData.Subject,
+		Body:           eventData.Body,
+		BodyMarkdown:   eventData.BodyMarkdown,
+		To:             eventData.To,
+		Cc:             eventData.Cc,
+		Bcc:            eventData.Bcc,
+		Template:       eventData.Template,
+		Data:           data,
+		Engine:         eventData.Engine,
+		IdempotencyKey: eventData.IdempotencyKey,
+		Category:       eventData.Category,
+		Priority:       eventData.Priority,
+		Locale:         eventData.Locale,
+		Attributes:     eventData.Attributes,
+	}
+	for _, recipient := range eventData.Recipients {
+		recipientData, err := structFromMap(recipient.Data)
+		if err != nil {
+			return nil, err
+		}
+		message.Recipients = append(message.Recipients, &emailpb.Recipient{To: recipient.To, Data: recipientData})
+	}
+	if eventData.SendAt != nil {
+		message.SendAt = timestamppb.New(*eventData.SendAt)
+	}
+
+	return message, nil
+}
+
+// eventDataFromProto converts the [emailpb.EventData] Protobuf message to event data, a nil message is empty event
+// data.
+func eventDataFromProto(message *emailpb.EventData) EventData {
+	if message == nil {
+		return EventData{}
+	}
+
+	eventData := EventData{
+		Sender:         message.Sender,
+		Subject:        message.Subject,
+		Body:           message.Body,
+		BodyMarkdown:   message.BodyMarkdown,
+		To:             nilIfEmpty(message.To),
+		Cc:             nilIfEmpty(message.Cc),
+		Bcc:            nilIfEmpty(message.Bcc),
+		Template:       message.Template,
+		Engine:         message.Engine,
+		IdempotencyKey: message.IdempotencyKey,
+		Category:       message.Category,
+		Priority:       message.Priority,
+		Locale:         message.Locale,
+	}
+	if message.Data != nil {
+		eventData.Data = message.Data.AsMap()
+	}
+	if len(message.Attributes) > 0 {
+		eventData.Attributes = message.Attributes
+	}
+	for _, recipient := range message.Recipients {
+		eventData.Recipients = append(eventData.Recipients, Recipient{
+			To:   recipient.To,
+			Data: recipient.Data.AsMap(),
+		})
+	}
+	if message.SendAt != nil {
+		sendAt := message.SendAt.AsTime()
+		eventData.SendAt = &sendAt
+	}
+
+	return eventData
+}
+
+// MarshalAvro encodes the event data with the [AvroSchema].
+func MarshalAvro(eventData EventData) ([]byte, error) {
+	data, err := avroJSON(eventData.Data)
+	if err != nil {
+		return nil, err
+	}
+	recipients := make([]interface{}, 0, len(eventData.Recipients))
+	for _, recipient := range eventData.Recipients {
+		recipientData, err := avroJSON(recipient.Data)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, map[string]interface{}{"to": recipient.To, "data": recipientData})
+	}
+	attributes := make(map[string]interface{}, len(eventData.Attributes))
+	for name, value := range eventData.Attributes {
+		attributes[name] = value
+	}
+	var sendAt interface{}
+	if eventData.SendAt != nil {
+		sendAt = goavro.Union("long.timestamp-millis", *eventData.SendAt)
+	}
+
+	return avroCodec.BinaryFromNative(nil, map[string]interface{}{
+		"sender":         eventData.Sender,
+		"subject":        eventData.Subject,
+		"body":           eventData.Body,
+		"bodyMarkdown":   eventData.BodyMarkdown,
+		"to":             avroStrings(eventData.To),
+		"cc":             avroStrings(eventData.Cc),
+		"bcc":            avroStrings(eventData.Bcc),
+		"template":       eventData.Template,
+		"data":           data,
+		"engine":         eventData.Engine,
+		"recipients":     recipients,
+		"sendAt":         sendAt,
+		"idempotencyKey": eventData.IdempotencyKey,
+		"category":       eventData.Category,
+		"priority":       eventData.Priority,
+		"locale":         eventData.Locale,
+		"attributes":     attributes,
+	})
+}
+
+// UnmarshalAvro decodes event data encoded with the [AvroSchema].
+func UnmarshalAvro(data []byte) (EventData, error) {
+	native, _, err := avroCodec.NativeFromBinary(data)
+	if err != nil {
+		return EventData{}, err
+	}
+	record, ok := native.(map[string]interface{})
+	if !ok {
+		return EventData{}, fmt.Errorf("expected an Avro record, got %T", native)
+	}
+
+	eventData := EventData{
+		Sender:         avroString(record["sender"]),
+		Subject:        avroString(record["subject"]),
+		Body:           avroString(record["body"]),
+		BodyMarkdown:   avroString(record["bodyMarkdown"]),
+		To:             fromAvroStrings(record["to"]),
+		Cc:             fromAvroStrings(record["cc"]),
+		Bcc:            fromAvroStrings(record["bcc"]),
+		Template:       avroString(record["template"]),
+		Engine:         avroString(record["engine"]),
+		IdempotencyKey: avroString(record["idempotencyKey"]),
+		Category:       avroString(record["category"]),
+		Priority:       avroString(record["priority"]),
+		Locale:         avroString(record["locale"]),
+	}
+	if eventData.Data, err = fromAvroJSON(record["data"]); err != nil {
+		return EventData{}, err
+	}
+	recipients, _ := record["recipients"].([]interface{})
+	for _, nativeRecipient := range recipients {
+		recipient, _ := nativeRecipient.(map[string]interface{})
+		recipientData, err := fromAvroJSON(recipient["data"])
+		if err != nil {
+			return EventData{}, err
+		}
+		eventData.Recipients = append(eventData.Recipients, Recipient{To: avroString(recipient["to"]), Data: recipientData})
+	}
+	if union, ok := record["sendAt"].(map[string]interface{}); ok {
+		if sendAt, ok := union["long.timestamp-millis"].(time.Time); ok {
+			sendAt = sendAt.UTC()
+			eventData.SendAt = &sendAt
+		}
+	}
+	if attributes, ok := record["attributes"].(map[string]interface{}); ok && len(attributes) > 0 {
+		eventData.Attributes = make(map[string]string, len(attributes))
+		for name, value := range attributes {
+			eventData.Attributes[name] = avroString(value)
+		}
+	}
+
+	return eventData, nil
+}
+
+// structFromMap converts template data to a Protobuf Struct, nil data is a nil Struct.
+func structFromMap(data map[string]interface{}) (*structpb.Struct, error) {
+	if data == nil {
+		return nil, nil
+	}
+	return structpb.NewStruct(data)
+}
+
+// nilIfEmpty returns nil for an empty list so decoded event data matches the JSON form where the field is absent.
+func nilIfEmpty(values []string) MessageTo {
+	if len(values) == 0 {
+		return nil
+	}
+	return values
+}
+
+// avroJSON encodes template data as the JSON string of the Avro ["null", "string"] union.
+func avroJSON(data map[string]interface{}) (interface{}, error) {
+	if data == nil {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return goavro.Union("string", string(encoded)), nil
+}
+
+// fromAvroJSON decodes template data from the JSON string of the Avro ["null", "string"] union.
+func fromAvroJSON(native interface{}) (map[string]interface{}, error) {
+	union, ok := native.(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(avroString(union["string"])), &data); err != nil {
+		return nil, fmt.Errorf("invalid Avro \"data\" - %v", err)
+	}
+	return data, nil
+}
+
+func avroString(native interface{}) string {
+	value, _ := native.(string)
+	return value
+}
+
+func avroStrings(values []string) []interface{} {
+	natives := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		natives = append(natives, value)
+	}
+	return natives
+}
+
+func fromAvroStrings(native interface{}) MessageTo {
+	natives, _ := native.([]interface{})
+	if len(natives) == 0 {
+		return nil
+	}
+	values := make(MessageTo, 0, len(natives))
+	for _, value := range natives {
+		values = append(values, avroString(value))
+	}
+	return values
+}
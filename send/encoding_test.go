@@ -0,0 +1,229 @@
+package send_test
+
+import (
+	"context"
+	"encoding/json"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/itmayziii/email/send"
+	"testing"
+)
+
+// eventDataJSON is every [send.EventData] field in its JSON form.
+const eventDataJSON = `{
+	"sender": "no-reply@example.com",
+	"subject": "Your order has shipped",
+	"body": "<p>Order {{ .Order }}</p>",
+	"bodyMarkdown": "Order **{{ .Order }}**",
+	"to": ["tom@example.com", "jane@example.com"],
+	"cc": ["sales@example.com"],
+	"bcc": ["audit@example.com"],
+	"template": "shipped.html",
+	"data": {"order": 1234, "items": ["book", "pen"], "gift": true, "address": {"city": "Denver"}},
+	"engine": "html",
+	"recipients": [{"to": "ann@example.com", "data": {"name": "Ann"}}],
+	"sendAt": "2030-01-02T15:04:05Z",
+	"idempotencyKey": "order-1234",
+	"category": "orders",
+	"priority": "high",
+	"locale": "en-US",
+	"attributes": {"tenant": "contoso"}
+}`
+
+func TestEncoding_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		eventData string
+		marshal   func(send.EventData) ([]byte, error)
+		unmarshal func([]byte) (send.EventData, error)
+	}{
+		{"protobuf every field", eventDataJSON, send.MarshalProtobuf, send.UnmarshalProtobuf},
+		{"protobuf required fields", `{"sender":"no-reply@example.com","subject":"test","to":"tom@example.com","body":"hello"}`, send.MarshalProtobuf, send.UnmarshalProtobuf},
+		{"avro every field", eventDataJSON, send.MarshalAvro, send.UnmarshalAvro},
+		{"avro required fields", `{"sender":"no-reply@example.com","subject":"test","to":"tom@example.com","body":"hello"}`, send.MarshalAvro, send.UnmarshalAvro},
+	}
+
+	for _, tt := range tests {
+		ttCopy := tt
+		t.Run(ttCopy.name, func(t *testing.T) {
+			t.Parallel()
+			var eventData send.EventData
+			if err := json.Unmarshal([]byte(ttCopy.eventData), &eventData); err != nil {
+				t.Fatal(err)
+			}
+
+			encoded, err := ttCopy.marshal(eventData)
+			if err != nil {
+				t.Fatalf("case: \"%s\", unexpected marshal error: %v", ttCopy.name, err)
+			}
+			decoded, err := ttCopy.unmarshal(encoded)
+			if err != nil {
+				t.Fatalf("case: \"%s\", unexpected unmarshal error: %v", ttCopy.name, err)
+			}
+
+			expected, err := json.Marshal(eventData)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual, err := json.Marshal(decoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(actual) != string(expected) {
+				t.Errorf("case: \"%s\", expected %s, got %s", ttCopy.name, expected, actual)
+			}
+		})
+	}
+}
+
+func TestEncoding_InvalidData(t *testing.T) {
+	t.Parallel()
+	if _, err := send.UnmarshalProtobuf([]byte{0xff, 0xff}); err == nil {
+		t.Errorf("expected an error decoding invalid Protobuf")
+	}
+	if _, err := send.UnmarshalAvro([]byte{0xff}); err == nil {
+		t.Errorf("expected an error decoding invalid Avro")
+	}
+}
+
+// binaryEmail is the event data of the binary encoding tests.
+var binaryEmail = send.EventData{
+	Sender:  "no-reply@example.com",
+	Subject: "Your order has shipped",
+	To:      send.MessageTo{"tom@example.com"},
+	Body:    "Order {{ .Order }} is on its way.",
+	Data:    map[string]interface{}{"order": 1234},
+}
+
+func TestEmailEvent_DataContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		marshal     func(send.EventData) ([]byte, error)
+	}{
+		{"protobuf", send.ContentTypeProtobuf, send.MarshalProtobuf},
+		{"x-protobuf", "application/x-protobuf", send.MarshalProtobuf},
+		{"avro", send.ContentTypeAvro, send.MarshalAvro},
+		{"avro with parameters", "application/avro; charset=binary", send.MarshalAvro},
+	}
+
+	for _, tt := range tests {
+		ttCopy := tt
+		t.Run(ttCopy.name, func(t *testing.T) {
+			t.Parallel()
+			sender := &recordingSender{}
+			app := send.NewApp(send.AppWithDomainSender("example.com", sender))
+			data, err := ttCopy.marshal(binaryEmail)
+			if err != nil {
+				t.Fatal(err)
+			}
+			event := cloudevents.NewEvent()
+			event.SetID("1")
+			event.SetSource("example/orders")
+			event.SetType("com.example.order.shipped")
+			if err := event.SetData(ttCopy.contentType, data); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := send.EmailEvent(app)(context.Background(), event); err != nil {
+				t.Fatalf("case: \"%s\", unexpected error: %v", ttCopy.name, err)
+			}
+			if len(sender.messages) != 1 || sender.messages[0].Body != "Order 1234 is on its way." {
+				t.Errorf("case: \"%s\", expected the decoded email to be sent, got %+v", ttCopy.name, sender.messages)
+			}
+		})
+	}
+}
+
+func TestEmailEvent_PubSubSchema(t *testing.T) {
+	tests := []struct {
+		name        string
+		options     []send.AppOption
+		marshal     func(send.EventData) ([]byte, error)
+		attributes  map[string]string
+		expectError bool
+	}{
+		{
+			name:       "content type attribute",
+			marshal:    send.MarshalAvro,
+			attributes: map[string]string{"content-type": send.ContentTypeAvro},
+		},
+		{
+			name:    "JSON schema encoding",
+			marshal: func(eventData send.EventData) ([]byte, error) { return json.Marshal(eventData) },
+			attributes: map[string]string{
+				"googclient_schemaname":     "projects/example-project/schemas/email",
+				"googclient_schemaencoding": "JSON",
+			},
+		},
+		{
+			name:    "binary schema encoding by full name",
+			options: []send.AppOption{send.AppWithPubSubSchema("projects/example-project/schemas/email", send.ContentTypeProtobuf)},
+			marshal: send.MarshalProtobuf,
+			attributes: map[string]string{
+				"googclient_schemaname":     "projects/example-project/schemas/email",
+				"googclient_schemaencoding": "BINARY",
+			},
+		},
+		{
+			name:    "binary schema encoding by schema id",
+			options: []send.AppOption{send.AppWithPubSubSchema("email", send.ContentTypeAvro)},
+			marshal: send.MarshalAvro,
+			attributes: map[string]string{
+				"googclient_schemaname":     "projects/example-project/schemas/email",
+				"googclient_schemaencoding": "BINARY",
+			},
+		},
+		{
+			name:    "unknown binary schema",
+			marshal: send.MarshalAvro,
+			attributes: map[string]string{
+				"googclient_schemaname":     "projects/example-project/schemas/email",
+				"googclient_schemaencoding": "BINARY",
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		ttCopy := tt
+		t.Run(ttCopy.name, func(t *testing.T) {
+			t.Parallel()
+			sender := &recordingSender{}
+			app := send.NewApp(append(ttCopy.options, send.AppWithDomainSender("example.com", sender))...)
+			data, err := ttCopy.marshal(binaryEmail)
+			if err != nil {
+				t.Fatal(err)
+			}
+			event := cloudevents.NewEvent()
+			event.SetID("1")
+			event.SetSource("//pubsub.googleapis.com/projects/example-project/topics/email")
+			event.SetType("google.cloud.pubsub.topic.v1.messagePublished")
+			err = event.SetData(cloudevents.ApplicationJSON, send.PubSubPayload{
+				Subscription: "projects/example-project/subscriptions/email",
+				Message: send.PubSubMessage{
+					Attributes:  ttCopy.attributes,
+					MessageId:   "2070443601311540",
+					PublishTime: "2021-02-26T19:13:55.749Z",
+					Data:        data,
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = send.EmailEvent(app)(context.Background(), event)
+			if ttCopy.expectError {
+				if err == nil || len(sender.messages) != 0 {
+					t.Errorf("case: \"%s\", expected an error and no messages, got %v", ttCopy.name, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("case: \"%s\", unexpected error: %v", ttCopy.name, err)
+			}
+			if len(sender.messages) != 1 || sender.messages[0].Body != "Order 1234 is on its way." {
+				t.Errorf("case: \"%s\", expected the decoded email to be sent, got %+v", ttCopy.name, sender.messages)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package send
+
+import (
+	"context"
+	"fmt"
+	"github.com/cbroglie/mustache"
+	"gocloud.dev/blob"
+	htmlTemplate "html/template"
+	"path"
+	"strings"
+)
+
+const (
+	// HTMLEngine is the name of the [HTMLTemplateEngine] and is used when no other engine matches.
+	HTMLEngine = "html"
+	// TextEngine is the name of the [TextTemplateEngine].
+	TextEngine = "text"
+	// MustacheEngine is the name of the [MustacheTemplateEngine].
+	MustacheEngine = "mustache"
+)
+
+const (
+	contentTypeHTML = "text/html"
+	contentTypeText = "text/plain"
+)
+
+// TemplateEngine renders an email body from a template. Engines are registered with [AppWithTemplateEngine] and are
+// chosen by the [EventData.Engine] field or by the file extension of [EventData.Template].
+type TemplateEngine interface {
+	// Execute renders the template source bound to the template data.
+	Execute(ctx context.Context, input TemplateInput) (string, error)
+	// ContentType is the MIME type of the rendered output, either "text/html", "text/plain", or "text/markdown".
+	// Markdown is converted to HTML and also used as the plain text alternative.
+	ContentType() string
+}
+
+// TemplateInspector is implemented by engines which can parse a template without rendering it and report the
+// variables and partials it references. It is used by [LintTemplates], engines which do not implement it are only
+// checked by rendering them.
+type TemplateInspector interface {
+	// Inspect parses the template source, a syntax error is returned when the template can not be parsed.
+	Inspect(ctx context.Context, input TemplateInput) (TemplateInfo, error)
+}
+
+// TemplateInfo describes what a template references.
+type TemplateInfo struct {
+	// Variables are the top level template variables the template references, named the same way they are named in
+	// the template i.e. "Name" for {{ .Name }} in Go templates and "name" for {{name}} in Mustache.
+	Variables []string
+	// UndefinedPartials are partials, or Go sub templates, the template includes which could not be found.
+	UndefinedPartials []string
+}
+
+// TemplateInput is everything a [TemplateEngine] needs to render an email body.
+type TemplateInput struct {
+	// Name is the path of the template in file storage or "body" when the template came from [EventData.Body] or
+	// [EventData.BodyMarkdown].
+	Name string
+	// Source is the unparsed template.
+	Source string
+	// Data is [EventData.Data], the variables to bind to the template.
+	Data map[string]interface{}
+	// Funcs are the template functions configured on the [App]. Engines that do not support functions ignore them.
+	Funcs htmlTemplate.FuncMap
+	// FileStorage is the [App] file storage which engines can use to resolve other files such as partials.
+	FileStorage *blob.Bucket
+}
+
+// HTMLTemplateEngine renders templates with [Go HTML templates], output is escaped appropriately for HTML. Template
+// variables are expected to be title case i.e. {{ .Title }}.
+//
+// [Go HTML templates]: https://pkg.go.dev/html/template
+type HTMLTemplateEngine struct{}
+
+func (e HTMLTemplateEngine) Execute(ctx context.Context, input TemplateInput) (string, error) {
+	return executeTemplate(input.Source, input.Data, input.Funcs)
+}
+
+func (e HTMLTemplateEngine) Inspect(ctx context.Context, input TemplateInput) (TemplateInfo, error) {
+	return inspectGoTemplate(input.Source, input.Funcs)
+}
+
+func (e HTMLTemplateEngine) ContentType() string {
+	return contentTypeHTML
+}
+
+// TextTemplateEngine renders plain text templates with [Go text templates]. Template variables are expected to be
+// title case i.e. {{ .Title }}.
+//
+// [Go text templates]: https://pkg.go.dev/text/template
+type TextTemplateEngine struct{}
+
+func (e TextTemplateEngine) Execute(ctx context.Context, input TemplateInput) (string, error) {
+	return executeTextTemplate(input.Source, input.Data, input.Funcs)
+}
+
+func (e TextTemplateEngine) Inspect(ctx context.Context, input TemplateInput) (TemplateInfo, error) {
+	return inspectGoTemplate(input.Source, input.Funcs)
+}
+
+func (e TextTemplateEngine) ContentType() string {
+	return contentTypeText
+}
+
+// MustacheTemplateEngine renders HTML with [Mustache templates], this is also compatible with simple Handlebars
+// templates. Template variables keep the same case they were given in [EventData.Data]. Partials i.e. {{> header}}
+// are read from file storage relative to the template, "header" and then "header.<template extension>" are tried.
+//
+// [Mustache templates]: https://mustache.github.io/mustache.5.html
+type MustacheTemplateEngine struct{}
+
+func (e MustacheTemplateEngine) Execute(ctx context.Context, input TemplateInput) (string, error) {
+	partials := &bucketPartialProvider{ctx: ctx, fileStorage: input.FileStorage, template: input.Name}
+	return mustache.RenderPartials(input.Source, partials, input.Data)
+}
+
+func (e MustacheTemplateEngine) Inspect(ctx context.Context, input TemplateInput) (TemplateInfo, error) {
+	t, err := mustache.ParseString(input.Source)
+	if err != nil {
+		return TemplateInfo{}, err
+	}
+
+	var info TemplateInfo
+	seen := make(map[string]bool)
+	for _, tag := range t.Tags() {
+		if tag.Type() == mustache.Partial || tag.Name() == "." {
+			continue
+		}
+		name := strings.Split(tag.Name(), ".")[0]
+		if !seen[name] {
+			seen[name] = true
+			info.Variables = append(info.Variables, name)
+		}
+	}
+
+	partials := &bucketPartialProvider{ctx: ctx, fileStorage: input.FileStorage, template: input.Name}
+	for _, name := range mustachePartials(t.Tags()) {
+		if _, err := partials.Get(name); err != nil {
+			info.UndefinedPartials = append(info.UndefinedPartials, name)
+		}
+	}
+	return info, nil
+}
+
+func (e MustacheTemplateEngine) ContentType() string {
+	return contentTypeHTML
+}
+
+// mustachePartials returns the names of every partial included by the tags, including partials nested in sections.
+func mustachePartials(tags []mustache.Tag) []string {
+	var partials []string
+	for _, tag := range tags {
+		switch tag.Type() {
+		case mustache.Partial:
+			partials = append(partials, tag.Name())
+		case mustache.Section, mustache.InvertedSection:
+			partials = append(partials, mustachePartials(tag.Tags())...)
+		}
+	}
+
+	return partials
+}
+
+// bucketPartialProvider implements [mustache.PartialProvider] by reading partials from file storage.
+type bucketPartialProvider struct {
+	ctx         context.Context
+	fileStorage *blob.Bucket
+	// template is the name of the template the partials are being included in.
+	template string
+}
+
+func (p *bucketPartialProvider) Get(name string) (string, error) {
+	_, contents, err := p.find(name)
+	return contents, err
+}
+
+// find returns the file storage location and contents of a partial, relative to the template, with the extension of
+// the template when the partial name has none.
+func (p *bucketPartialProvider) find(name string) (string, string, error) {
+	dir := path.Dir(p.template)
+	candidates := []string{path.Join(dir, name)}
+	if ext := path.Ext(p.template); ext != "" && path.Ext(name) == "" {
+		candidates = append(candidates, path.Join(dir, name+ext))
+	}
+
+	var lastErr error
+	for _, candidate := range candidates {
+		data, err := readFile(p.ctx, p.fileStorage, candidate)
+		if err == nil {
+			return candidate, string(data), nil
+		}
+		lastErr = err
+	}
+
+	return "", "", ReadTemplateError{templateName: name, err: lastErr}
+}
+
+// defaultTemplateEngines are the engines registered on every [App].
+func defaultTemplateEngines() map[string]TemplateEngine {
+	return map[string]TemplateEngine{
+		HTMLEngine:     HTMLTemplateEngine{},
+		TextEngine:     TextTemplateEngine{},
+		MustacheEngine: MustacheTemplateEngine{},
+		MarkdownEngine: MarkdownTemplateEngine{},
+	}
+}
+
+// defaultTemplateExtensions maps template file extensions to the default engine names.
+func defaultTemplateExtensions() map[string]string {
+	return map[string]string{
+		".html":       HTMLEngine,
+		".htm":        HTMLEngine,
+		".gohtml":     HTMLEngine,
+		".tmpl":       HTMLEngine,
+		".txt":        TextEngine,
+		".gotxt":      TextEngine,
+		".mustache":   MustacheEngine,
+		".hbs":        MustacheEngine,
+		".handlebars": MustacheEngine,
+		".md":         MarkdownEngine,
+		".markdown":   MarkdownEngine,
+	}
+}
+
+// chooseTemplateEngine returns the engine to use for the event. [EventData.Engine] takes priority followed by the
+// [MarkdownEngine] for [EventData.BodyMarkdown], the extension of [EventData.Template], and finally the [HTMLEngine].
+func chooseTemplateEngine(app *App, eventData EventData) (TemplateEngine, error) {
+	name := eventData.Engine
+	if name == "" && eventData.Body == "" && eventData.BodyMarkdown != "" {
+		name = MarkdownEngine
+	}
+	if name == "" && eventData.Body == "" && eventData.BodyMarkdown == "" && eventData.Template != "" {
+		name = app.templateExtensions[strings.ToLower(path.Ext(eventData.Template))]
+	}
+	if name == "" {
+		name = HTMLEngine
+	}
+
+	engine, ok := app.templateEngines[name]
+	if !ok {
+		return nil, UnknownEngineError{engine: name}
+	}
+
+	return engine, nil
+}
+
+// UnknownEngineError represents an error that occurs when an event asks for a template engine that is not registered.
+type UnknownEngineError struct {
+	engine string
+}
+
+func (unknownEngineError UnknownEngineError) Error() string {
+	return fmt.Sprintf("unknown template engine \"%s\"", unknownEngineError.engine)
+}
@@ -0,0 +1,126 @@
+package send_test
+
+import (
+	"context"
+	"errors"
+	"github.com/itmayziii/email/send"
+	"gocloud.dev/blob/memblob"
+	"testing"
+)
+
+func TestEmailEvent_ChoosesTemplateEngine(t *testing.T) {
+	tests := []struct {
+		name         string
+		template     string
+		engine       string
+		expectedHTML string
+		expectedText string
+	}{
+		{"html by default", "emails/welcome.html", "", "<p>Hi &lt;b&gt;Tommy&lt;/b&gt;</p>", ""},
+		{"text by extension", "emails/welcome.txt", "", "", "Hi <b>Tommy</b>"},
+		{"mustache by extension", "emails/welcome.mustache", "", "<header><b>Tommy</b></header><p>Hi &lt;b&gt;Tommy&lt;/b&gt;</p>", ""},
+		{"handlebars by extension", "emails/welcome.hbs", "", "<p>Hi <b>Tommy</b></p>", ""},
+		{"engine field overrides extension", "emails/welcome-text.html", "text", "", "Hi <b>Tommy</b>"},
+	}
+
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	t.Cleanup(func() { _ = bucket.Close() })
+	files := map[string]string{
+		"emails/welcome.html":      "<p>Hi {{ .Name }}</p>",
+		"emails/welcome.txt":       "Hi {{ .Name }}",
+		"emails/welcome-text.html": "Hi {{ .Name }}",
+		"emails/welcome.mustache":  "{{> header}}<p>Hi {{name}}</p>",
+		"emails/header.mustache":   "<header>{{{name}}}</header>",
+		"emails/welcome.hbs":       "<p>Hi {{{name}}}</p>",
+	}
+	for name, contents := range files {
+		if err := bucket.WriteAll(ctx, name, []byte(contents), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range tests {
+		ttCopy := tt
+		t.Run(ttCopy.name, func(t *testing.T) {
+			t.Parallel()
+			sender := &recordingSender{}
+			app := send.NewApp(send.AppWithFileStorage(bucket), send.AppWithDomainSender("example.com", sender))
+
+			err := send.EmailEvent(app)(ctx, newEvent(t, map[string]interface{}{
+				"sender":   "no-reply@example.com",
+				"subject":  "test",
+				"to":       "tom@example.com",
+				"template": ttCopy.template,
+				"engine":   ttCopy.engine,
+				"data":     map[string]interface{}{"name": "<b>Tommy</b>"},
+			}))
+			if err != nil {
+				t.Fatalf("case: \"%s\", unexpected error: %v", ttCopy.name, err)
+			}
+			if sender.messages[0].Body != ttCopy.expectedHTML {
+				t.Errorf("expected body %q to match %q", sender.messages[0].Body, ttCopy.expectedHTML)
+			}
+			if sender.messages[0].Text != ttCopy.expectedText {
+				t.Errorf("expected text %q to match %q", sender.messages[0].Text, ttCopy.expectedText)
+			}
+		})
+	}
+}
+
+func TestEmailEvent_ErrorsOnUnknownTemplateEngine(t *testing.T) {
+	t.Parallel()
+	app := send.NewApp(send.AppWithDomainSender("example.com", &recordingSender{}))
+
+	err := send.EmailEvent(app)(context.Background(), newEvent(t, map[string]interface{}{
+		"sender":  "no-reply@example.com",
+		"subject": "test",
+		"to":      "tom@example.com",
+		"body":    "hello",
+		"engine":  "jinja",
+	}))
+	var unknownEngineError send.UnknownEngineError
+	if !errors.As(err, &unknownEngineError) {
+		t.Errorf("expected UnknownEngineError but got %v", err)
+	}
+}
+
+// upperEngine is a [send.TemplateEngine] that upper cases the template source.
+type upperEngine struct{}
+
+func (e upperEngine) Execute(ctx context.Context, input send.TemplateInput) (string, error) {
+	return "UPPER " + input.Source, nil
+}
+
+func (e upperEngine) ContentType() string {
+	return "text/html"
+}
+
+func TestAppWithTemplateEngine_RegistersEngineByExtension(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	t.Cleanup(func() { _ = bucket.Close() })
+	if err := bucket.WriteAll(ctx, "welcome.up", []byte("hello"), nil); err != nil {
+		t.Fatal(err)
+	}
+	sender := &recordingSender{}
+	app := send.NewApp(
+		send.AppWithFileStorage(bucket),
+		send.AppWithDomainSender("example.com", sender),
+		send.AppWithTemplateEngine("upper", upperEngine{}, "up"),
+	)
+
+	err := send.EmailEvent(app)(ctx, newEvent(t, map[string]interface{}{
+		"sender":   "no-reply@example.com",
+		"subject":  "test",
+		"to":       "tom@example.com",
+		"template": "welcome.up",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sender.messages[0].Body != "UPPER hello" {
+		t.Errorf("expected %q to match %q", sender.messages[0].Body, "UPPER hello")
+	}
+}
@@ -0,0 +1,214 @@
+package send
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"strings"
+)
+
+// CloudEvent types of AWS events, bridges which convert AWS events to CloudEvents use different types so register the
+// decoders for the types your bridge uses with [AppWithEventDecoder] i.e.
+// AppWithEventDecoder("my.sns.type", DecodeSNS).
+const (
+	SNSNotificationType  = "com.amazonaws.sns.notification"
+	SQSMessageType       = "com.amazonaws.sqs.message"
+	EventBridgeEventType = "com.amazonaws.events.event"
+)
+
+// maxEnvelopeDepth is how many envelopes are unwrapped before giving up i.e. EventBridge -> SNS -> SQS is 3.
+const maxEnvelopeDepth = 5
+
+// EventDecoder extracts [EventData] from the data of a CloudEvent which wraps it in an envelope specific to the event
+// producer, see [AppWithEventDecoder].
+type EventDecoder func(event cloudevents.Event) (EventData, error)
+
+// eventTypeWildcard ends an event type registered with [AppWithEventDecoder] to match every type with the prefix.
+const eventTypeWildcard = "*"
+
+// defaultEventDecoders are the [EventDecoder] for the envelopes of the major event producers.
+func defaultEventDecoders() map[string]EventDecoder {
+	return map[string]EventDecoder{
+		pubSubType:                                DecodePubSub,
+		SNSNotificationType:                       DecodeSNS,
+		SQSMessageType:                            DecodeSQS,
+		EventBridgeEventType:                      DecodeEventBridge,
+		azureTypePrefix + eventTypeWildcard:       DecodeAzure,
+		azureBridgeTypePrefix + eventTypeWildcard: DecodeAzure,
+	}
+}
+
+// eventDecoder finds the [EventDecoder] registered for the event type, an exact match is preferred over the longest
+// matching prefix. It is nil when the event data is the [EventData] itself.
+func eventDecoder(app *App, eventType string) EventDecoder {
+	if decoder, ok := app.eventDecoders[eventType]; ok {
+		return decoder
+	}
+
+	var decoder EventDecoder
+	longest := -1
+	for registered, registeredDecoder := range app.eventDecoders {
+		prefix, isPrefix := strings.CutSuffix(registered, eventTypeWildcard)
+		if isPrefix && strings.HasPrefix(eventType, prefix) && len(prefix) > longest {
+			decoder = registeredDecoder
+			longest = len(prefix)
+		}
+	}
+
+	return decoder
+}
+
+// SNSNotification is the [Amazon SNS message format] of a notification.
+//
+// [Amazon SNS message format]: https://docs.aws.amazon.com/sns/latest/dg/sns-message-and-json-formats.html
+type SNSNotification struct {
+	Type      string `json:"Type"`
+	MessageID string `json:"MessageId"`
+	TopicArn  string `json:"TopicArn"`
+	Subject   string `json:"Subject"`
+	// Message is the published message, for emails it is the [EventData] JSON encoded as a string.
+	Message           string                         `json:"Message"`
+	Timestamp         string                         `json:"Timestamp"`
+	MessageAttributes map[string]SNSMessageAttribute `json:"MessageAttributes"`
+}
+
+// SNSMessageAttribute is an attribute of an [SNSNotification].
+type SNSMessageAttribute struct {
+	Type  string `json:"Type"`
+	Value string `json:"Value"`
+}
+
+// SQSMessage is an [Amazon SQS message] as delivered by SQS integrations i.e. AWS Lambda. The Body is a
+// [SNSNotification] when an SNS topic delivers to the queue without raw message delivery.
+//
+// [Amazon SQS message]: https://docs.aws.amazon.com/AWSSimpleQueueService/latest/APIReference/API_Message.html
+type SQSMessage struct {
+	MessageID         string            `json:"messageId"`
+	ReceiptHandle     string            `json:"receiptHandle"`
+	Body              string            `json:"body"`
+	Attributes        map[string]string `json:"attributes"`
+	MessageAttributes map[string]struct {
+		StringValue string `json:"stringValue"`
+		DataType    string `json:"dataType"`
+	} `json:"messageAttributes"`
+	EventSourceARN string `json:"eventSourceARN"`
+}
+
+// EventBridgeEvent is an [Amazon EventBridge event], the Detail is the [EventData].
+//
+// [Amazon EventBridge event]: https://docs.aws.amazon.com/eventbridge/latest/ref/overiew-event-structure.html
+type EventBridgeEvent struct {
+	Version    string          `json:"version"`
+	ID         string          `json:"id"`
+	DetailType string          `json:"detail-type"`
+	Source     string          `json:"source"`
+	Account    string          `json:"account"`
+	Time       string          `json:"time"`
+	Region     string          `json:"region"`
+	Resources  []string        `json:"resources"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+// DecodeSNS is the [EventDecoder] for a CloudEvent with an [SNSNotification] as its data.
+func DecodeSNS(event cloudevents.Event) (EventData, error) {
+	var notification SNSNotification
+	if err := json.Unmarshal(event.Data(), &notification); err != nil {
+		return EventData{}, err
+	}
+	payload, err := unwrapSNS(notification)
+	if err != nil {
+		return EventData{}, err
+	}
+
+	return decodeAWSPayload(payload)
+}
+
+// DecodeSQS is the [EventDecoder] for a CloudEvent with an [SQSMessage] as its data. The message body is unwrapped
+// when it is an [SNSNotification] or [EventBridgeEvent].
+func DecodeSQS(event cloudevents.Event) (EventData, error) {
+	var message SQSMessage
+	if err := json.Unmarshal(event.Data(), &message); err != nil {
+		return EventData{}, err
+	}
+	if message.Body == "" {
+		return EventData{}, errors.New("SQS message has no body")
+	}
+
+	return decodeAWSPayload([]byte(message.Body))
+}
+
+// DecodeEventBridge is the [EventDecoder] for a CloudEvent with an [EventBridgeEvent] as its data.
+func DecodeEventBridge(event cloudevents.Event) (EventData, error) {
+	var bridgeEvent EventBridgeEvent
+	if err := json.Unmarshal(event.Data(), &bridgeEvent); err != nil {
+		return EventData{}, err
+	}
+	if len(bridgeEvent.Detail) == 0 {
+		return EventData{}, errors.New("EventBridge event has no detail")
+	}
+
+	return decodeAWSPayload(bridgeEvent.Detail)
+}
+
+// unwrapSNS returns the message of an SNS notification.
+func unwrapSNS(notification SNSNotification) ([]byte, error) {
+	if notification.Type != "" && notification.Type != "Notification" {
+		return nil, fmt.Errorf("SNS message type \"%s\" is not a notification", notification.Type)
+	}
+	if notification.Message == "" {
+		return nil, errors.New("SNS notification has no message")
+	}
+
+	return []byte(notification.Message), nil
+}
+
+// awsEnvelope has the fields which identify an SNS notification or EventBridge event wrapping another payload.
+type awsEnvelope struct {
+	Type       string          `json:"Type"`
+	TopicArn   string          `json:"TopicArn"`
+	Message    *string         `json:"Message"`
+	DetailType string          `json:"detail-type"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+// decodeAWSPayload unmarshals [EventData] from a payload after unwrapping any SNS notifications or EventBridge events
+// it is nested in, AWS services are commonly chained i.e. EventBridge to SNS to SQS.
+func decodeAWSPayload(payload []byte) (EventData, error) {
+	for depth := 0; depth < maxEnvelopeDepth; depth++ {
+		payload = bytes.TrimSpace(payload)
+		if len(payload) > 0 && payload[0] == '"' {
+			// Some producers JSON encode the message a second time.
+			var unquoted string
+			if err := json.Unmarshal(payload, &unquoted); err != nil {
+				return EventData{}, err
+			}
+			payload = []byte(unquoted)
+			continue
+		}
+
+		var envelope awsEnvelope
+		if err := json.Unmarshal(payload, &envelope); err != nil {
+			return EventData{}, err
+		}
+		switch {
+		case envelope.TopicArn != "" && envelope.Message != nil:
+			unwrapped, err := unwrapSNS(SNSNotification{Type: envelope.Type, Message: *envelope.Message})
+			if err != nil {
+				return EventData{}, err
+			}
+			payload = unwrapped
+		case envelope.DetailType != "" && len(envelope.Detail) > 0:
+			payload = envelope.Detail
+		default:
+			var eventData EventData
+			if err := json.Unmarshal(payload, &eventData); err != nil {
+				return EventData{}, err
+			}
+			return eventData, nil
+		}
+	}
+
+	return EventData{}, fmt.Errorf("more than %d nested envelopes", maxEnvelopeDepth)
+}
@@ -0,0 +1,175 @@
+package send_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/itmayziii/email/send"
+	"testing"
+)
+
+const emailJSON = `{"sender":"no-reply@example.com","subject":"hello world","body":"some body","to":["tom@example.com"]}`
+
+// snsNotification wraps a message the way SNS delivers it.
+func snsNotification(t *testing.T, message string) string {
+	t.Helper()
+	notification, err := json.Marshal(map[string]interface{}{
+		"Type":             "Notification",
+		"MessageId":        "22b80b92-fdea-4c2c-8f9d-bdfb0c7bf324",
+		"TopicArn":         "arn:aws:sns:us-west-2:123456789012:email",
+		"Subject":          "email",
+		"Message":          message,
+		"Timestamp":        "2012-05-02T00:54:06.655Z",
+		"SignatureVersion": "1",
+		"MessageAttributes": map[string]interface{}{
+			"priority": map[string]interface{}{"Type": "String", "Value": "high"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(notification)
+}
+
+// sqsMessage wraps a body the way SQS integrations deliver it.
+func sqsMessage(t *testing.T, body string) string {
+	t.Helper()
+	message, err := json.Marshal(map[string]interface{}{
+		"messageId":      "059f36b4-87a3-44ab-83d2-661975830a7d",
+		"receiptHandle":  "AQEBwJnKyrHigUMZj6rYigCgxlaS3SLy0a",
+		"body":           body,
+		"attributes":     map[string]interface{}{"ApproximateReceiveCount": "1"},
+		"eventSource":    "aws:sqs",
+		"eventSourceARN": "arn:aws:sqs:us-east-2:123456789012:email",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(message)
+}
+
+func eventBridgeEvent(detail string) string {
+	return `{
+		"version": "0",
+		"id": "6a7e8feb-b491-4cf7-a9f1-bf3703467718",
+		"detail-type": "Email Requested",
+		"source": "com.example.orders",
+		"account": "111122223333",
+		"time": "2017-12-22T18:43:48Z",
+		"region": "us-west-1",
+		"resources": [],
+		"detail": ` + detail + `
+	}`
+}
+
+func TestEmailEvent_AWSEnvelopes(t *testing.T) {
+	tests := []struct {
+		name      string
+		eventType string
+		data      string
+	}{
+		{"SNS", send.SNSNotificationType, snsNotification(t, emailJSON)},
+		{"SQS", send.SQSMessageType, sqsMessage(t, emailJSON)},
+		{"SNS delivered by SQS", send.SQSMessageType, sqsMessage(t, snsNotification(t, emailJSON))},
+		{"EventBridge", send.EventBridgeEventType, eventBridgeEvent(emailJSON)},
+		{"EventBridge delivered by SQS", send.SQSMessageType, sqsMessage(t, eventBridgeEvent(emailJSON))},
+		{
+			"EventBridge to SNS to SQS",
+			send.SQSMessageType,
+			sqsMessage(t, snsNotification(t, eventBridgeEvent(emailJSON))),
+		},
+	}
+
+	for _, tt := range tests {
+		ttCopy := tt
+		t.Run(ttCopy.name, func(t *testing.T) {
+			t.Parallel()
+			sender := &recordingSender{}
+			app := send.NewApp(send.AppWithDomainSender("example.com", sender))
+			event := cloudevents.NewEvent()
+			event.SetID("1")
+			event.SetSource("test")
+			event.SetType(ttCopy.eventType)
+			if err := event.SetData(cloudevents.ApplicationJSON, []byte(ttCopy.data)); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := send.EmailEvent(app)(context.Background(), event); err != nil {
+				t.Fatalf("case: \"%s\", unexpected error: %v", ttCopy.name, err)
+			}
+			if len(sender.messages) != 1 {
+				t.Fatalf("case: \"%s\", expected 1 message, got %d", ttCopy.name, len(sender.messages))
+			}
+			message := sender.messages[0]
+			if message.Subject != "hello world" || message.Body != "some body" || message.To[0] != "tom@example.com" {
+				t.Errorf("case: \"%s\", unexpected message %+v", ttCopy.name, message)
+			}
+		})
+	}
+}
+
+func TestEmailEvent_SNSSubscriptionConfirmation(t *testing.T) {
+	t.Parallel()
+	app := send.NewApp(send.AppWithDomainSender("example.com", &recordingSender{}))
+	event := cloudevents.NewEvent()
+	event.SetID("1")
+	event.SetSource("test")
+	event.SetType(send.SNSNotificationType)
+	data := `{"Type":"SubscriptionConfirmation","TopicArn":"arn:aws:sns:us-west-2:123456789012:email","Message":"You have chosen to subscribe"}`
+	if err := event.SetData(cloudevents.ApplicationJSON, []byte(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := send.EmailEvent(app)(context.Background(), event); err == nil {
+		t.Fatal("expected an error for a subscription confirmation")
+	}
+}
+
+func TestAppWithEventDecoder(t *testing.T) {
+	t.Parallel()
+	sender := &recordingSender{}
+	app := send.NewApp(
+		send.AppWithDomainSender("example.com", sender),
+		send.AppWithEventDecoder("com.example.envelope", func(event cloudevents.Event) (send.EventData, error) {
+			var envelope struct {
+				Email send.EventData `json:"email"`
+			}
+			if err := event.DataAs(&envelope); err != nil {
+				return send.EventData{}, err
+			}
+			return envelope.Email, nil
+		}),
+		// Custom bridges can reuse the built-in decoders for their own types.
+		send.AppWithEventDecoder("my.sns.type", send.DecodeSNS),
+		send.AppWithEventDecoder("com.example.rejected", func(event cloudevents.Event) (send.EventData, error) {
+			return send.EventData{}, errors.New("rejected")
+		}),
+	)
+
+	tests := []struct {
+		eventType   string
+		data        string
+		expectError bool
+	}{
+		{"com.example.envelope", `{"email":` + emailJSON + `}`, false},
+		{"my.sns.type", snsNotification(t, emailJSON), false},
+		{"com.example.rejected", emailJSON, true},
+	}
+	for _, tt := range tests {
+		event := cloudevents.NewEvent()
+		event.SetID("1")
+		event.SetSource("test")
+		event.SetType(tt.eventType)
+		if err := event.SetData(cloudevents.ApplicationJSON, []byte(tt.data)); err != nil {
+			t.Fatal(err)
+		}
+		err := send.EmailEvent(app)(context.Background(), event)
+		if (err != nil) != tt.expectError {
+			t.Errorf("type: \"%s\", expected error: %t, got %v", tt.eventType, tt.expectError, err)
+		}
+	}
+	if len(sender.messages) != 2 {
+		t.Errorf("expected 2 messages, got %d", len(sender.messages))
+	}
+}
@@ -0,0 +1,145 @@
+package send
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"net/http"
+)
+
+// defaultEventConcurrency is how many events of a batch are handled at the same time unless configured with
+// [AppWithEventConcurrency].
+const defaultEventConcurrency = 4
+
+// EventStatus is whether an event of a batch was handled, see [EventResult].
+type EventStatus string
+
+const (
+	// EventStatusOK means the email was sent, scheduled, or skipped because every recipient is suppressed.
+	EventStatusOK EventStatus = "ok"
+	// EventStatusFailed means the email was not sent, the [EventResult] has the error.
+	EventStatusFailed EventStatus = "failed"
+)
+
+// EventResult is the outcome of handling a single CloudEvent of a batch.
+type EventResult struct {
+	// ID is the id of the CloudEvent.
+	ID     string      `json:"id"`
+	Source string      `json:"source"`
+	Status EventStatus `json:"status"`
+	// Error describes why the email was not sent.
+	Error string `json:"error,omitempty"`
+	// ErrorClass is why the email was not sent, only [ErrorClassTimeout] and [ErrorClassProvider] are worth retrying.
+	ErrorClass ErrorClass `json:"errorClass,omitempty"`
+	// Recipients are the results for every recipient when sending to [EventData.Recipients] failed.
+	Recipients []RecipientResult `json:"recipients,omitempty"`
+}
+
+// EventBatchResponse is the body of the response to a batch of CloudEvents.
+type EventBatchResponse struct {
+	// Results are the outcome for every event, in the same order as the batch.
+	Results []EventResult `json:"results"`
+	// Failed is how many events failed.
+	Failed int `json:"failed"`
+}
+
+// batchErrorResponse is the body of the response to a request which is not a valid batch of CloudEvents.
+type batchErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// EmailEvents creates a function to send the emails of a batch of [CloudEvents], at most [App.eventConcurrency] at a
+// time, each handled the same way as [EmailEvent]. Every event has a result in the same order as the batch, a failed
+// event does not stop the others from being handled. Once the context is done the remaining events fail with an
+// [ErrorClassTimeout] without being handled.
+//
+// [CloudEvents]: https://cloudevents.io/
+func EmailEvents(app *App) func(context.Context, []cloudevents.Event) []EventResult {
+	return func(ctx context.Context, events []cloudevents.Event) []EventResult {
+		defer flush(app)
+
+		results := make([]EventResult, len(events))
+		concurrently(ctx, app.eventConcurrency, len(events), func(i int) {
+			results[i] = handleBatchEvent(ctx, app, events[i])
+		}, func(i int, err error) {
+			results[i] = EventResult{
+				ID:         events[i].ID(),
+				Source:     events[i].Source(),
+				Status:     EventStatusFailed,
+				Error:      err.Error(),
+				ErrorClass: ClassifyError(err),
+			}
+		})
+
+		return results
+	}
+}
+
+// handleBatchEvent handles a single event of a batch, the same as [EmailEvent] without flushing.
+func handleBatchEvent(ctx context.Context, app *App, event cloudevents.Event) EventResult {
+	result := EventResult{ID: event.ID(), Source: event.Source(), Status: EventStatusOK}
+	err := event.Validate()
+	if err != nil {
+		err = sendError{class: ErrorClassValidation, err: err}
+	} else {
+		if app.dryRun || isDryRunEvent(event) {
+			ctx, _ = withDryRun(ctx)
+		}
+		err = handleEmailEvent(ctx, app, event)
+	}
+	if err == nil {
+		return result
+	}
+
+	result.Status = EventStatusFailed
+	result.Error = err.Error()
+	result.ErrorClass = ClassifyError(err)
+	var batchSendError BatchSendError
+	if errors.As(err, &batchSendError) {
+		result.Recipients = batchSendError.Results()
+	}
+	return result
+}
+
+// EventBatchHandler creates an [http.Handler] which sends the emails of a batch of CloudEvents POSTed in the
+// [CloudEvents HTTP batched content mode], a single event in the binary or structured content mode is a batch of one.
+// The response is an [EventBatchResponse] with a result for every event. Partial failures are reported in the results
+// with a 200 status rather than failing the whole batch, as retrying the batch would send the successful emails
+// again. A request which is not a batch of CloudEvents is a 400.
+//
+// [CloudEvents HTTP batched content mode]: https://github.com/cloudevents/spec/blob/main/cloudevents/bindings/http-protocol-binding.md#33-batched-content-mode
+func EventBatchHandler(app *App) http.Handler {
+	emailEvents := EmailEvents(app)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeBatchJSON(app, w, http.StatusMethodNotAllowed, batchErrorResponse{Error: "method not allowed"})
+			return
+		}
+
+		events, err := cehttp.NewEventsFromHTTPRequest(r)
+		if err != nil {
+			writeBatchJSON(app, w, http.StatusBadRequest, batchErrorResponse{Error: err.Error()})
+			return
+		}
+
+		response := EventBatchResponse{Results: emailEvents(r.Context(), events)}
+		for _, result := range response.Results {
+			if result.Status == EventStatusFailed {
+				response.Failed++
+			}
+		}
+		app.infoLogger.Printf("event batch handled: events: %d, failed: %d\n", len(response.Results), response.Failed)
+		writeBatchJSON(app, w, http.StatusOK, response)
+	})
+}
+
+func writeBatchJSON(app *App, w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		app.errorLogger.Printf("failed to write event batch response - %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package send_test
+
+import (
+	"context"
+	"encoding/json"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"github.com/itmayziii/email/send"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// concurrencySender records the most emails it was sending at the same time.
+type concurrencySender struct {
+	mu      sync.Mutex
+	current int
+	max     int
+}
+
+func (cs *concurrencySender) Send(ctx context.Context, m send.Message) (string, error) {
+	cs.mu.Lock()
+	cs.current++
+	if cs.current > cs.max {
+		cs.max = cs.current
+	}
+	cs.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	cs.mu.Lock()
+	cs.current--
+	cs.mu.Unlock()
+	return "id", nil
+}
+
+// newBatchEvent creates a CloudEvent with the id for a batch.
+func newBatchEvent(t *testing.T, id string, data map[string]interface{}) cloudevents.Event {
+	t.Helper()
+	event := newEvent(t, data)
+	event.SetID(id)
+	return event
+}
+
+func TestEventBatchHandler(t *testing.T) {
+	t.Parallel()
+	sender := &recordingSender{}
+	app := send.NewApp(send.AppWithDomainSender("example.com", sender))
+	email := func(senderEmail string, to interface{}) map[string]interface{} {
+		return map[string]interface{}{"sender": senderEmail, "subject": "test", "body": "hello", "to": to}
+	}
+	events := []cloudevents.Event{
+		newBatchEvent(t, "1", email("no-reply@example.com", "tom@example.com")),
+		newBatchEvent(t, "2", email("no-reply@example.com", "not an email")),
+		newBatchEvent(t, "3", email("no-reply@example.org", "tom@example.com")),
+		newBatchEvent(t, "4", email("no-reply@example.com", "jane@example.com")),
+	}
+	request, err := cehttp.NewHTTPRequestFromEvents(context.Background(), "/", events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+
+	send.EventBatchHandler(app).ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body)
+	}
+	var response send.EventBatchResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		id         string
+		status     send.EventStatus
+		errorClass send.ErrorClass
+	}{
+		{"1", send.EventStatusOK, ""},
+		{"2", send.EventStatusFailed, send.ErrorClassValidation},
+		{"3", send.EventStatusFailed, send.ErrorClassConfiguration},
+		{"4", send.EventStatusOK, ""},
+	}
+	if len(response.Results) != len(expected) || response.Failed != 2 {
+		t.Fatalf("expected %d results with 2 failed, got %+v", len(expected), response)
+	}
+	for i, result := range response.Results {
+		if result.ID != expected[i].id || result.Status != expected[i].status || result.ErrorClass != expected[i].errorClass {
+			t.Errorf("expected result %d to be %+v, got %+v", i, expected[i], result)
+		}
+		if result.Status == send.EventStatusFailed && result.Error == "" {
+			t.Errorf("expected result %d to have an error", i)
+		}
+	}
+	if len(sender.messages) != 2 {
+		t.Errorf("expected 2 messages, got %d", len(sender.messages))
+	}
+}
+
+func TestEventBatchHandler_InvalidRequests(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		contentType    string
+		body           string
+		expectedStatus int
+	}{
+		{"not a POST", http.MethodGet, cloudevents.ApplicationCloudEventsBatchJSON, "[]", http.StatusMethodNotAllowed},
+		{"invalid JSON", http.MethodPost, cloudevents.ApplicationCloudEventsBatchJSON, "[{", http.StatusBadRequest},
+		{"not CloudEvents", http.MethodPost, "text/plain", "hello", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		ttCopy := tt
+		t.Run(ttCopy.name, func(t *testing.T) {
+			t.Parallel()
+			app := send.NewApp(send.AppWithDomainSender("example.com", &recordingSender{}))
+			request := httptest.NewRequest(ttCopy.method, "/", strings.NewReader(ttCopy.body))
+			request.Header.Set("Content-Type", ttCopy.contentType)
+			recorder := httptest.NewRecorder()
+
+			send.EventBatchHandler(app).ServeHTTP(recorder, request)
+
+			if recorder.Code != ttCopy.expectedStatus {
+				t.Errorf("case: \"%s\", expected status %d, got %d", ttCopy.name, ttCopy.expectedStatus, recorder.Code)
+			}
+			var response map[string]interface{}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil || response["error"] == "" {
+				t.Errorf("case: \"%s\", expected a JSON error, got %s", ttCopy.name, recorder.Body)
+			}
+		})
+	}
+}
+
+func TestEmailEvents_BoundedConcurrency(t *testing.T) {
+	t.Parallel()
+	sender := &concurrencySender{}
+	app := send.NewApp(send.AppWithDomainSender("example.com", sender), send.AppWithEventConcurrency(2))
+	var events []cloudevents.Event
+	for i := 0; i < 6; i++ {
+		events = append(events, newEvent(t, map[string]interface{}{
+			"sender":  "no-reply@example.com",
+			"subject": "test",
+			"body":    "hello",
+			"to":      "tom@example.com",
+		}))
+	}
+
+	results := send.EmailEvents(app)(context.Background(), events)
+
+	for i, result := range results {
+		if result.Status != send.EventStatusOK {
+			t.Errorf("expected result %d to be ok, got %+v", i, result)
+		}
+	}
+	if sender.max > 2 {
+		t.Errorf("expected at most 2 emails sent at the same time, got %d", sender.max)
+	}
+}
@@ -0,0 +1,184 @@
+package send
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// EventMapping declares how a business event, i.e. "com.acme.user.signup", becomes an email so producers can publish
+// their own payloads without knowing anything about email. Fields ending in "Path" are [JSONPath] expressions
+// evaluated against the CloudEvent data i.e. "$.user.email" or "$.attendees[*].email", see [AppWithEventMapping].
+//
+// [JSONPath]: https://datatracker.ietf.org/doc/html/rfc9535
+type EventMapping struct {
+	Sender string `json:"sender" yaml:"sender"`
+	// Subject is the subject of every email, SubjectPath selects it from the event data instead.
+	Subject     string `json:"subject" yaml:"subject"`
+	SubjectPath string `json:"subjectPath" yaml:"subjectPath"`
+	Template    string `json:"template" yaml:"template"`
+	Engine      string `json:"engine" yaml:"engine"`
+	Category    string `json:"category" yaml:"category"`
+	// ToPath selects the recipients, either email addresses or arrays of them, every selected address is sent the same
+	// email.
+	ToPath  string `json:"toPath" yaml:"toPath"`
+	CcPath  string `json:"ccPath" yaml:"ccPath"`
+	BccPath string `json:"bccPath" yaml:"bccPath"`
+	// DataPath selects the object the template is rendered with, the whole event data when empty.
+	DataPath string `json:"dataPath" yaml:"dataPath"`
+}
+
+// ParseEventMappings parses a YAML, or JSON, document of [EventMapping] keyed by CloudEvent type and checks every
+// JSONPath expression is valid so mistakes are found on startup rather than when an event arrives.
+//
+//	com.acme.user.signup:
+//	  sender: no-reply@acme.com
+//	  subject: Welcome to Acme
+//	  template: welcome.html
+//	  toPath: $.user.email
+//	  dataPath: $.user
+func ParseEventMappings(document []byte) (map[string]EventMapping, error) {
+	var mappings map[string]EventMapping
+	if err := yaml.Unmarshal(document, &mappings); err != nil {
+		return nil, err
+	}
+	for eventType, mapping := range mappings {
+		if err := mapping.validate(); err != nil {
+			return nil, fmt.Errorf("invalid event mapping for \"%s\" - %v", eventType, err)
+		}
+	}
+
+	return mappings, nil
+}
+
+// validate ensures the mapping selects recipients and every JSONPath expression parses.
+func (mapping EventMapping) validate() error {
+	if mapping.ToPath == "" {
+		return errors.New("missing \"toPath\"")
+	}
+	for _, expression := range []string{mapping.SubjectPath, mapping.ToPath, mapping.CcPath, mapping.BccPath, mapping.DataPath} {
+		if expression == "" {
+			continue
+		}
+		if _, err := parseJSONPath(expression); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decode is the [EventDecoder] for the mapped CloudEvent type.
+func (mapping EventMapping) decode(event cloudevents.Event) (EventData, error) {
+	if err := mapping.validate(); err != nil {
+		return EventData{}, err
+	}
+	var document interface{}
+	if err := json.Unmarshal(event.Data(), &document); err != nil {
+		return EventData{}, err
+	}
+
+	eventData := EventData{
+		Sender:   mapping.Sender,
+		Subject:  mapping.Subject,
+		Template: mapping.Template,
+		Engine:   mapping.Engine,
+		Category: mapping.Category,
+	}
+	var err error
+	if mapping.SubjectPath != "" {
+		if eventData.Subject, err = selectString(document, mapping.SubjectPath); err != nil {
+			return EventData{}, err
+		}
+	}
+	if eventData.To, err = selectAddresses(document, mapping.ToPath); err != nil {
+		return EventData{}, err
+	}
+	if len(eventData.To) == 0 {
+		return EventData{}, fmt.Errorf("no recipients at \"%s\"", mapping.ToPath)
+	}
+	if eventData.Cc, err = selectAddresses(document, mapping.CcPath); err != nil {
+		return EventData{}, err
+	}
+	if eventData.Bcc, err = selectAddresses(document, mapping.BccPath); err != nil {
+		return EventData{}, err
+	}
+	if eventData.Data, err = selectData(document, mapping.DataPath); err != nil {
+		return EventData{}, err
+	}
+
+	return eventData, nil
+}
+
+// selectString selects a single string from the document.
+func selectString(document interface{}, expression string) (string, error) {
+	path, err := parseJSONPath(expression)
+	if err != nil {
+		return "", err
+	}
+	values := path.evaluate(document)
+	if len(values) != 1 {
+		return "", fmt.Errorf("expected a single value at \"%s\", got %d", expression, len(values))
+	}
+	value, ok := values[0].(string)
+	if !ok {
+		return "", fmt.Errorf("expected a string at \"%s\", got %T", expression, values[0])
+	}
+
+	return value, nil
+}
+
+// selectAddresses selects email addresses from the document, arrays of addresses are flattened. An empty expression
+// selects nothing.
+func selectAddresses(document interface{}, expression string) (MessageTo, error) {
+	if expression == "" {
+		return nil, nil
+	}
+	path, err := parseJSONPath(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	var addresses MessageTo
+	for _, value := range path.evaluate(document) {
+		switch address := value.(type) {
+		case string:
+			addresses = append(addresses, address)
+		case []interface{}:
+			for _, element := range address {
+				elementAddress, ok := element.(string)
+				if !ok {
+					return nil, fmt.Errorf("expected email addresses at \"%s\", got %T", expression, element)
+				}
+				addresses = append(addresses, elementAddress)
+			}
+		default:
+			return nil, fmt.Errorf("expected email addresses at \"%s\", got %T", expression, value)
+		}
+	}
+
+	return addresses, nil
+}
+
+// selectData selects the template data object from the document, the whole document when the expression is empty.
+func selectData(document interface{}, expression string) (map[string]interface{}, error) {
+	if expression == "" {
+		expression = "$"
+	}
+	path, err := parseJSONPath(expression)
+	if err != nil {
+		return nil, err
+	}
+	values := path.evaluate(document)
+	if len(values) == 0 {
+		return nil, nil
+	}
+	data, ok := values[0].(map[string]interface{})
+	if len(values) != 1 || !ok {
+		return nil, fmt.Errorf("expected a single object at \"%s\"", expression)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,188 @@
+package send_test
+
+import (
+	"context"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/itmayziii/email/send"
+	"gocloud.dev/blob/memblob"
+	"reflect"
+	"testing"
+)
+
+// newTypedEvent creates a CloudEvent of the event type with the provided data.
+func newTypedEvent(t *testing.T, eventType string, data interface{}) cloudevents.Event {
+	t.Helper()
+	event := newEvent(t, data)
+	event.SetType(eventType)
+	return event
+}
+
+// signupEvent is the data of a business event which knows nothing about email.
+var signupEvent = map[string]interface{}{
+	"user": map[string]interface{}{
+		"name":  "Tom",
+		"email": "tom@example.com",
+		"plan":  "pro",
+	},
+	"team": map[string]interface{}{
+		"name":   "Acme",
+		"admins": []interface{}{"jane@example.com", "ann@example.com"},
+	},
+	"attendees": []interface{}{
+		map[string]interface{}{"email": "bob@example.com"},
+		map[string]interface{}{"email": "sue@example.com"},
+	},
+}
+
+func TestEmailEvent_EventMapping(t *testing.T) {
+	tests := []struct {
+		name        string
+		mapping     send.EventMapping
+		expectedTo  []string
+		expectedCc  []string
+		subject     string
+		body        string
+		expectError bool
+	}{
+		{
+			name:       "single recipient",
+			mapping:    send.EventMapping{Subject: "Welcome", ToPath: "$.user.email", DataPath: "$.user"},
+			expectedTo: []string{"tom@example.com"},
+			subject:    "Welcome",
+			body:       "Welcome Tom to the pro plan",
+		},
+		{
+			name:       "array of recipients",
+			mapping:    send.EventMapping{Subject: "New member", ToPath: "$.team.admins", DataPath: "$.user"},
+			expectedTo: []string{"jane@example.com", "ann@example.com"},
+			subject:    "New member",
+			body:       "Welcome Tom to the pro plan",
+		},
+		{
+			name:       "wildcard recipients and cc",
+			mapping:    send.EventMapping{SubjectPath: "$['team'].name", ToPath: "$.attendees[*].email", CcPath: "$.team.admins[0]", DataPath: "$.user"},
+			expectedTo: []string{"bob@example.com", "sue@example.com"},
+			expectedCc: []string{"jane@example.com"},
+			subject:    "Acme",
+			body:       "Welcome Tom to the pro plan",
+		},
+		{
+			name:        "no recipients",
+			mapping:     send.EventMapping{Subject: "Welcome", ToPath: "$.user.phone"},
+			expectError: true,
+		},
+		{
+			name:        "recipient is not an address",
+			mapping:     send.EventMapping{Subject: "Welcome", ToPath: "$.user"},
+			expectError: true,
+		},
+		{
+			name:        "invalid JSONPath",
+			mapping:     send.EventMapping{Subject: "Welcome", ToPath: "user.email"},
+			expectError: true,
+		},
+		{
+			name:        "data is not an object",
+			mapping:     send.EventMapping{Subject: "Welcome", ToPath: "$.user.email", DataPath: "$.user.name"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		ttCopy := tt
+		t.Run(ttCopy.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			sender := &recordingSender{}
+			bucket := memblob.OpenBucket(nil)
+			t.Cleanup(func() { _ = bucket.Close() })
+			if err := bucket.WriteAll(ctx, "welcome.html", []byte("Welcome {{ .Name }} to the {{ .Plan }} plan"), nil); err != nil {
+				t.Fatal(err)
+			}
+			mapping := ttCopy.mapping
+			mapping.Sender = "no-reply@example.com"
+			mapping.Template = "welcome.html"
+			app := send.NewApp(
+				send.AppWithFileStorage(bucket),
+				send.AppWithDomainSender("example.com", sender),
+				send.AppWithEventMapping("com.acme.user.*", mapping),
+			)
+
+			err := send.EmailEvent(app)(ctx, newTypedEvent(t, "com.acme.user.signup", signupEvent))
+			if ttCopy.expectError {
+				if err == nil || len(sender.messages) != 0 {
+					t.Errorf("case: \"%s\", expected an error and no messages, got %v", ttCopy.name, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("case: \"%s\", unexpected error: %v", ttCopy.name, err)
+			}
+			if len(sender.messages) != 1 {
+				t.Fatalf("case: \"%s\", expected 1 message, got %d", ttCopy.name, len(sender.messages))
+			}
+			message := sender.messages[0]
+			if !reflect.DeepEqual([]string(message.To), ttCopy.expectedTo) || !reflect.DeepEqual([]string(message.Cc), ttCopy.expectedCc) {
+				t.Errorf("case: \"%s\", expected to %v and cc %v, got %v and %v", ttCopy.name, ttCopy.expectedTo, ttCopy.expectedCc, message.To, message.Cc)
+			}
+			if message.Subject != ttCopy.subject || message.Body != ttCopy.body {
+				t.Errorf("case: \"%s\", expected subject %q and body %q, got %q and %q", ttCopy.name, ttCopy.subject, ttCopy.body, message.Subject, message.Body)
+			}
+		})
+	}
+}
+
+func TestParseEventMappings(t *testing.T) {
+	tests := []struct {
+		name        string
+		document    string
+		expected    map[string]send.EventMapping
+		expectError bool
+	}{
+		{
+			name: "YAML",
+			document: `
+com.acme.user.signup:
+  sender: no-reply@acme.com
+  subject: Welcome to Acme
+  template: welcome.html
+  toPath: $.user.email
+  dataPath: $.user
+`,
+			expected: map[string]send.EventMapping{"com.acme.user.signup": {
+				Sender:   "no-reply@acme.com",
+				Subject:  "Welcome to Acme",
+				Template: "welcome.html",
+				ToPath:   "$.user.email",
+				DataPath: "$.user",
+			}},
+		},
+		{
+			name:     "JSON",
+			document: `{"com.acme.order.*": {"subjectPath": "$.title", "toPath": "$.customer.emails[*]"}}`,
+			expected: map[string]send.EventMapping{"com.acme.order.*": {SubjectPath: "$.title", ToPath: "$.customer.emails[*]"}},
+		},
+		{"missing toPath", `com.acme.user.signup: {subject: Welcome}`, nil, true},
+		{"invalid JSONPath", `com.acme.user.signup: {toPath: "$.user[email"}`, nil, true},
+	}
+
+	for _, tt := range tests {
+		ttCopy := tt
+		t.Run(ttCopy.name, func(t *testing.T) {
+			t.Parallel()
+			mappings, err := send.ParseEventMappings([]byte(ttCopy.document))
+			if ttCopy.expectError {
+				if err == nil {
+					t.Errorf("case: \"%s\", expected an error", ttCopy.name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("case: \"%s\", unexpected error: %v", ttCopy.name, err)
+			}
+			if !reflect.DeepEqual(mappings, ttCopy.expected) {
+				t.Errorf("case: \"%s\", expected %+v, got %+v", ttCopy.name, ttCopy.expected, mappings)
+			}
+		})
+	}
+}
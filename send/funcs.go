@@ -0,0 +1,239 @@
+package send
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	htmlTemplate "html/template"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// defaultTemplateFuncs returns the functions available to every email template. Functions are defined so that the
+// value being operated on comes last, this allows them to be used in pipelines i.e. {{ .Name | default "friend" }}.
+//
+//   - date: formats a time, RFC 3339 string, or unix timestamp with a [Go time layout] in UTC or the time's own zone.
+//     {{ date "Jan 2, 2006" .CreatedAt }}
+//   - dateInZone: same as date but converts the time to an [IANA time zone] first.
+//     {{ dateInZone "Jan 2, 2006 3:04 PM MST" "America/New_York" .CreatedAt }}
+//   - currency: formats an amount using an ISO 4217 currency code. {{ currency "USD" .Total }} -> $1,234.50
+//   - pluralize: chooses the singular or plural word based on a count. {{ pluralize "item" "items" .Count }}
+//   - default: returns the default value when the given value is empty. {{ .Name | default "friend" }}
+//   - coalesce: returns the first non-empty value. {{ coalesce .Nickname .FirstName "friend" }}
+//   - truncate: shortens a string to the given number of characters adding "..." if it was shortened.
+//     {{ .Description | truncate 100 }}
+//   - url: builds a http, https, or mailto URL with query parameters provided as key value pairs.
+//     {{ url "https://example.com/orders" "id" .OrderId "utm_source" "email" }}
+//   - markdown: converts markdown to sanitized HTML. {{ markdown .Announcement }}
+//   - unsubscribeURL: the signed unsubscribe link for the recipient, see [AppWithUnsubscribe].
+//     <a href="{{ unsubscribeURL }}">Unsubscribe</a>
+//
+// [Go time layout]: https://pkg.go.dev/time#pkg-constants
+// [IANA time zone]: https://www.iana.org/time-zones
+func defaultTemplateFuncs() htmlTemplate.FuncMap {
+	return htmlTemplate.FuncMap{
+		"date":       formatDate,
+		"dateInZone": formatDateInZone,
+		"currency":   formatCurrency,
+		"pluralize":  pluralize,
+		"default":    defaultValue,
+		"coalesce":   coalesce,
+		"truncate":   truncate,
+		"url":        buildURL,
+		"markdown":   markdownToHTML,
+		// Replaced with the link for the recipient when an email is rendered, see messageTemplateFuncs.
+		"unsubscribeURL": previewUnsubscribe,
+	}
+}
+
+// formatDate formats the provided value with the layout, see [toTime] for the supported values.
+func formatDate(layout string, value interface{}) (string, error) {
+	t, err := toTime(value)
+	if err != nil {
+		return "", err
+	}
+
+	return t.Format(layout), nil
+}
+
+// formatDateInZone formats the provided value with the layout after converting it to the provided time zone.
+func formatDateInZone(layout string, zone string, value interface{}) (string, error) {
+	t, err := toTime(value)
+	if err != nil {
+		return "", err
+	}
+	location, err := time.LoadLocation(zone)
+	if err != nil {
+		return "", err
+	}
+
+	return t.In(location).Format(layout), nil
+}
+
+// toTime converts a [time.Time], RFC 3339 string, or unix timestamp (in seconds) to a [time.Time]. Values that do
+// not carry their own time zone are in UTC.
+func toTime(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case *time.Time:
+		if v == nil {
+			return time.Time{}, errors.New("time is nil")
+		}
+		return *v, nil
+	case string:
+		return time.Parse(time.RFC3339, v)
+	}
+
+	seconds, err := toFloat(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to convert %v to a time", value)
+	}
+	return time.Unix(int64(seconds), 0).UTC(), nil
+}
+
+// formatCurrency formats an amount using the symbol and decimal places of the ISO 4217 currency code.
+func formatCurrency(code string, amount interface{}) (string, error) {
+	unit, err := currency.ParseISO(code)
+	if err != nil {
+		return "", err
+	}
+	value, err := toFloat(amount)
+	if err != nil {
+		return "", err
+	}
+
+	printer := message.NewPrinter(language.AmericanEnglish)
+	scale, _ := currency.Standard.Rounding(unit)
+	sign := ""
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+
+	return fmt.Sprintf("%s%s%s", sign, printer.Sprint(currency.Symbol(unit)), printer.Sprintf("%.*f", scale, value)), nil
+}
+
+// pluralize returns singular when count is 1 and plural otherwise.
+func pluralize(singular string, plural string, count interface{}) (string, error) {
+	n, err := toFloat(count)
+	if err != nil {
+		return "", err
+	}
+	if n == 1 {
+		return singular, nil
+	}
+
+	return plural, nil
+}
+
+// defaultValue returns def when value is empty, see [isEmpty] for what is considered empty.
+func defaultValue(def interface{}, value interface{}) interface{} {
+	if isEmpty(value) {
+		return def
+	}
+
+	return value
+}
+
+// coalesce returns the first value that is not empty or nil if all the values are empty.
+func coalesce(values ...interface{}) interface{} {
+	for _, v := range values {
+		if !isEmpty(v) {
+			return v
+		}
+	}
+
+	return nil
+}
+
+// truncate shortens s to length characters, "..." is appended when s was shortened.
+func truncate(length int, s string) string {
+	if length < 0 || utf8.RuneCountInString(s) <= length {
+		return s
+	}
+
+	return string([]rune(s)[:length]) + "..."
+}
+
+// buildURL parses rawURL and adds the query parameters provided as key value pairs. Only http, https, and mailto URLs
+// are allowed since the result is trusted by the template as a safe URL.
+func buildURL(rawURL string, pairs ...interface{}) (htmlTemplate.URL, error) {
+	if len(pairs)%2 != 0 {
+		return "", errors.New("url query parameters must be provided as key value pairs")
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "mailto":
+	default:
+		return "", fmt.Errorf("url scheme \"%s\" is not allowed", u.Scheme)
+	}
+
+	query := u.Query()
+	for i := 0; i < len(pairs); i += 2 {
+		query.Add(fmt.Sprint(pairs[i]), fmt.Sprint(pairs[i+1]))
+	}
+	u.RawQuery = query.Encode()
+
+	return htmlTemplate.URL(u.String()), nil
+}
+
+// markdownToHTML converts markdown to HTML. The HTML is sanitized which makes the output safe to trust.
+func markdownToHTML(markdown string) (htmlTemplate.HTML, error) {
+	content, err := markdownToSafeHTML(markdown)
+	if err != nil {
+		return "", err
+	}
+
+	return htmlTemplate.HTML(content), nil
+}
+
+// toFloat converts the numeric types and numeric strings to a float64. JSON numbers are decoded as float64 while
+// numbers written in templates are ints so both need to be supported.
+func toFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case string:
+		return strconv.ParseFloat(v, 64)
+	case nil:
+		return 0, errors.New("unable to convert nil to a number")
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	}
+
+	return 0, fmt.Errorf("unable to convert %v to a number", value)
+}
+
+// isEmpty reports whether value is nil or the zero value of its type. Empty slices and maps are also empty.
+func isEmpty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		return rv.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return rv.IsNil()
+	}
+
+	return rv.IsZero()
+}
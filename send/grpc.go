@@ -0,0 +1,164 @@
+package send
+
+import (
+	"context"
+	"errors"
+	"github.com/itmayziii/email/send/emailpb"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/runtime/protoiface"
+	"strings"
+)
+
+// grpcErrorDomain is the domain of the google.rpc.ErrorInfo detail of gRPC errors.
+const grpcErrorDomain = "github.com/itmayziii/email"
+
+// grpcMessageStatuses maps a [MessageStatus] to its Protobuf enum.
+var grpcMessageStatuses = map[MessageStatus]emailpb.MessageStatus{
+	MessageStatusSent:       emailpb.MessageStatus_MESSAGE_STATUS_SENT,
+	MessageStatusScheduled:  emailpb.MessageStatus_MESSAGE_STATUS_SCHEDULED,
+	MessageStatusSuppressed: emailpb.MessageStatus_MESSAGE_STATUS_SUPPRESSED,
+	MessageStatusDryRun:     emailpb.MessageStatus_MESSAGE_STATUS_DRY_RUN,
+	MessageStatusSandboxed:  emailpb.MessageStatus_MESSAGE_STATUS_SANDBOXED,
+}
+
+// grpcCodes maps the [ErrorClass] of an email which failed to send to a gRPC status code.
+var grpcCodes = map[ErrorClass]codes.Code{
+	ErrorClassValidation:    codes.InvalidArgument,
+	ErrorClassTemplate:      codes.FailedPrecondition,
+	ErrorClassConfiguration: codes.Internal,
+	ErrorClassProvider:      codes.Unavailable,
+	ErrorClassTimeout:       codes.DeadlineExceeded,
+	ErrorClassStorage:       codes.Unavailable,
+}
+
+// emailService is the [emailpb.EmailServiceServer] which sends emails with an [App].
+type emailService struct {
+	emailpb.UnimplementedEmailServiceServer
+	app *App
+}
+
+// RegisterEmailService registers the EmailService gRPC service, defined in emailpb/email_service.proto, with the
+// server. Emails are sent with [App.Send] and previewed with [App.Render]. The deadline of a call is the deadline for
+// sending the email, and validation errors are an INVALID_ARGUMENT status with a google.rpc.BadRequest detail listing
+// the invalid fields.
+func RegisterEmailService(server grpc.ServiceRegistrar, app *App) {
+	emailpb.RegisterEmailServiceServer(server, &emailService{app: app})
+}
+
+func (service *emailService) Send(ctx context.Context, request *emailpb.SendRequest) (*emailpb.SendResponse, error) {
+	response, err := service.send(ctx, request)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return response, nil
+}
+
+func (service *emailService) SendBatch(ctx context.Context, request *emailpb.SendBatchRequest) (*emailpb.SendBatchResponse, error) {
+	results := make([]*emailpb.SendBatchResult, len(request.GetRequests()))
+	concurrently(ctx, service.app.eventConcurrency, len(results), func(i int) {
+		response, err := service.send(ctx, request.GetRequests()[i])
+		if err != nil {
+			results[i] = &emailpb.SendBatchResult{Result: &emailpb.SendBatchResult_Error{Error: batchError(err)}}
+			return
+		}
+		results[i] = &emailpb.SendBatchResult{Result: &emailpb.SendBatchResult_Response{Response: response}}
+	}, func(i int, err error) {
+		results[i] = &emailpb.SendBatchResult{Result: &emailpb.SendBatchResult_Error{Error: batchError(err)}}
+	})
+
+	response := &emailpb.SendBatchResponse{Results: results}
+	for _, result := range results {
+		if result.GetError() != nil {
+			response.Failed++
+		}
+	}
+	return response, nil
+}
+
+func (service *emailService) RenderPreview(ctx context.Context, request *emailpb.RenderPreviewRequest) (*emailpb.RenderPreviewResponse, error) {
+	results, err := service.app.Render(ctx, eventDataFromProto(request.GetEmail()))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	response := &emailpb.RenderPreviewResponse{}
+	for _, result := range results {
+		response.Messages = append(response.Messages, &emailpb.RenderedMessage{
+			Sender:  result.Message.Sender,
+			Subject: result.Message.Subject,
+			Html:    result.Message.Body,
+			Text:    result.Message.Text,
+			To:      result.Message.To,
+			Cc:      result.Message.Cc,
+			Bcc:     result.Message.Bcc,
+			Headers: result.Message.Headers,
+			Domain:  result.Domain,
+		})
+	}
+	return response, nil
+}
+
+// send sends the email of a single request with [App.Send].
+func (service *emailService) send(ctx context.Context, request *emailpb.SendRequest) (*emailpb.SendResponse, error) {
+	result, err := service.app.Send(ctx, eventDataFromProto(request.GetEmail()))
+	if err != nil {
+		return nil, err
+	}
+
+	response := &emailpb.SendResponse{
+		Id:          result.ID,
+		Status:      grpcMessageStatuses[result.Status],
+		ScheduleKey: result.ScheduleKey,
+	}
+	for _, recipient := range result.Recipients {
+		response.Recipients = append(response.Recipients, &emailpb.RecipientResult{
+			To:     recipient.To,
+			Id:     recipient.ID,
+			Error:  recipient.Error,
+			Status: grpcMessageStatuses[recipient.Status],
+		})
+	}
+	return response, nil
+}
+
+// grpcError converts an error from sending an email to a gRPC status with the [ErrorClass] as a google.rpc.ErrorInfo
+// detail and, for validation errors, the invalid fields as a google.rpc.BadRequest detail.
+func grpcError(err error) error {
+	class := ClassifyError(err)
+	code := grpcCodes[class]
+	if errors.Is(err, context.Canceled) {
+		code = codes.Canceled
+	}
+
+	details := []protoiface.MessageV1{
+		&errdetails.ErrorInfo{Reason: strings.ToUpper(string(class)), Domain: grpcErrorDomain},
+	}
+	if violations := fieldViolations(err); len(violations) > 0 {
+		badRequest := &errdetails.BadRequest{}
+		for _, violation := range violations {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       violation.Field,
+				Description: violation.Description,
+			})
+		}
+		details = append(details, badRequest)
+	}
+
+	grpcStatus := status.New(code, err.Error())
+	if detailed, detailErr := grpcStatus.WithDetails(details...); detailErr == nil {
+		grpcStatus = detailed
+	}
+	return grpcStatus.Err()
+}
+
+// batchError describes why an email of a SendBatch call failed.
+func batchError(err error) *emailpb.Error {
+	batchErr := &emailpb.Error{Code: string(ClassifyError(err)), Message: err.Error()}
+	for _, violation := range fieldViolations(err) {
+		batchErr.Violations = append(batchErr.Violations, &emailpb.FieldViolation{Field: violation.Field, Description: violation.Description})
+	}
+	return batchErr
+}
@@ -0,0 +1,224 @@
+package send_test
+
+import (
+	"context"
+	"github.com/itmayziii/email/send"
+	"github.com/itmayziii/email/send/emailpb"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// deadlineSender records the deadline of the context each email is sent with.
+type deadlineSender struct {
+	mu        sync.Mutex
+	deadlines []time.Time
+}
+
+func (ds *deadlineSender) Send(ctx context.Context, m send.Message) (string, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	deadline, _ := ctx.Deadline()
+	ds.deadlines = append(ds.deadlines, deadline)
+	return "id", nil
+}
+
+// newEmailServiceClient serves the EmailService for the app in memory and returns a client connected to it.
+func newEmailServiceClient(t *testing.T, app *send.App) emailpb.EmailServiceClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	send.RegisterEmailService(server, app)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.DialContext(
+		context.Background(),
+		"bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return emailpb.NewEmailServiceClient(conn)
+}
+
+func TestEmailService_Send(t *testing.T) {
+	tests := []struct {
+		name            string
+		email           *emailpb.EventData
+		expectedCode    codes.Code
+		expectedField   string
+		expectedReason  string
+		expectedMessage int
+	}{
+		{
+			name:            "sent",
+			email:           &emailpb.EventData{Sender: "no-reply@example.com", Subject: "test", To: []string{"tom@example.com"}, Body: "hello"},
+			expectedCode:    codes.OK,
+			expectedMessage: 1,
+		},
+		{
+			name:           "missing sender",
+			email:          &emailpb.EventData{Subject: "test", To: []string{"tom@example.com"}, Body: "hello"},
+			expectedCode:   codes.InvalidArgument,
+			expectedField:  "sender",
+			expectedReason: "VALIDATION",
+		},
+		{
+			name:           "invalid cc",
+			email:          &emailpb.EventData{Sender: "no-reply@example.com", Subject: "test", To: []string{"tom@example.com"}, Cc: []string{"nope"}, Body: "hello"},
+			expectedCode:   codes.InvalidArgument,
+			expectedField:  "cc",
+			expectedReason: "VALIDATION",
+		},
+		{
+			name:           "unregistered sender domain",
+			email:          &emailpb.EventData{Sender: "no-reply@example.org", Subject: "test", To: []string{"tom@example.com"}, Body: "hello"},
+			expectedCode:   codes.Internal,
+			expectedReason: "CONFIGURATION",
+		},
+	}
+
+	for _, tt := range tests {
+		ttCopy := tt
+		t.Run(ttCopy.name, func(t *testing.T) {
+			t.Parallel()
+			sender := &recordingSender{}
+			client := newEmailServiceClient(t, send.NewApp(send.AppWithDomainSender("example.com", sender)))
+
+			response, err := client.Send(context.Background(), &emailpb.SendRequest{Email: ttCopy.email})
+
+			grpcStatus := status.Convert(err)
+			if grpcStatus.Code() != ttCopy.expectedCode {
+				t.Fatalf("case: \"%s\", expected code %s, got %s: %s", ttCopy.name, ttCopy.expectedCode, grpcStatus.Code(), grpcStatus.Message())
+			}
+			if len(sender.messages) != ttCopy.expectedMessage {
+				t.Errorf("case: \"%s\", expected %d messages, got %d", ttCopy.name, ttCopy.expectedMessage, len(sender.messages))
+			}
+			if err == nil {
+				if response.Id != "id" || response.Status != emailpb.MessageStatus_MESSAGE_STATUS_SENT {
+					t.Errorf("case: \"%s\", unexpected response %v", ttCopy.name, response)
+				}
+				return
+			}
+
+			var reason string
+			var fields []string
+			for _, detail := range grpcStatus.Details() {
+				switch detail := detail.(type) {
+				case *errdetails.ErrorInfo:
+					reason = detail.Reason
+				case *errdetails.BadRequest:
+					for _, violation := range detail.FieldViolations {
+						fields = append(fields, violation.Field)
+					}
+				}
+			}
+			if reason != ttCopy.expectedReason {
+				t.Errorf("case: \"%s\", expected reason %s, got %s", ttCopy.name, ttCopy.expectedReason, reason)
+			}
+			if ttCopy.expectedField != "" && (len(fields) != 1 || fields[0] != ttCopy.expectedField) {
+				t.Errorf("case: \"%s\", expected a violation of %s, got %v", ttCopy.name, ttCopy.expectedField, fields)
+			}
+		})
+	}
+}
+
+func TestEmailService_SendDeadline(t *testing.T) {
+	t.Parallel()
+	sender := &deadlineSender{}
+	client := newEmailServiceClient(t, send.NewApp(send.AppWithDomainSender("example.com", sender)))
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+
+	_, err := client.Send(ctx, &emailpb.SendRequest{
+		Email: &emailpb.EventData{Sender: "no-reply@example.com", Subject: "test", To: []string{"tom@example.com"}, Body: "hello"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The server computes the deadline from the timeout sent by the client, so it can be slightly later.
+	if len(sender.deadlines) != 1 || sender.deadlines[0].IsZero() || sender.deadlines[0].After(deadline.Add(100*time.Millisecond)) {
+		t.Errorf("expected the sender deadline to be the call deadline %s, got %v", deadline, sender.deadlines)
+	}
+}
+
+func TestEmailService_SendBatch(t *testing.T) {
+	t.Parallel()
+	sender := &recordingSender{}
+	client := newEmailServiceClient(t, send.NewApp(send.AppWithDomainSender("example.com", sender)))
+	email := func(to string) *emailpb.SendRequest {
+		return &emailpb.SendRequest{Email: &emailpb.EventData{Sender: "no-reply@example.com", Subject: "test", To: []string{to}, Body: "hello"}}
+	}
+
+	response, err := client.SendBatch(context.Background(), &emailpb.SendBatchRequest{
+		Requests: []*emailpb.SendRequest{email("tom@example.com"), email("not an email"), email("jane@example.com")},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(response.Results) != 3 || response.Failed != 1 {
+		t.Fatalf("expected 3 results with 1 failed, got %v", response)
+	}
+	if response.Results[0].GetResponse().GetId() != "id" || response.Results[2].GetResponse().GetId() != "id" {
+		t.Errorf("expected the first and last emails to be sent, got %v", response.Results)
+	}
+	batchErr := response.Results[1].GetError()
+	if batchErr.GetCode() != string(send.ErrorClassValidation) || len(batchErr.GetViolations()) != 1 || batchErr.GetViolations()[0].Field != "to" {
+		t.Errorf("expected a validation error for \"to\", got %v", batchErr)
+	}
+	if len(sender.messages) != 2 {
+		t.Errorf("expected 2 messages, got %d", len(sender.messages))
+	}
+}
+
+func TestEmailService_RenderPreview(t *testing.T) {
+	t.Parallel()
+	sender := &recordingSender{}
+	client := newEmailServiceClient(t, send.NewApp(send.AppWithDomainSender("example.com", sender)))
+	data, err := structpb.NewStruct(map[string]interface{}{"name": "Tom"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := client.RenderPreview(context.Background(), &emailpb.RenderPreviewRequest{
+		Email: &emailpb.EventData{
+			Sender:  "no-reply@example.com",
+			Subject: "test",
+			To:      []string{"tom@example.com"},
+			Body:    "<p>Hello {{ .Name }}</p>",
+			Data:    data,
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(response.Messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(response.Messages))
+	}
+	message := response.Messages[0]
+	if message.Html != "<p>Hello Tom</p>" || message.Domain != "example.com" || message.To[0] != "tom@example.com" {
+		t.Errorf("unexpected rendered message %v", message)
+	}
+	if len(sender.messages) != 0 {
+		t.Errorf("expected nothing to be sent, got %d messages", len(sender.messages))
+	}
+}
@@ -0,0 +1,85 @@
+package send
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// sentKeyPrefix namespaces the [EventData.IdempotencyKey] of sent emails in the [IdempotencyStore] so they do not
+// collide with the Idempotency-Keys of [MessagesHandler] responses.
+const sentKeyPrefix = "sent:"
+
+// sendClaims are the [EventData.IdempotencyKey]s of emails being sent, so an event redelivered while the first
+// delivery is still sending is not sent twice. It is safe for concurrent use.
+type sendClaims struct {
+	mu     sync.Mutex
+	claims map[string]struct{}
+}
+
+func newSendClaims() *sendClaims {
+	return &sendClaims{claims: make(map[string]struct{})}
+}
+
+// claimSend claims the [EventData.IdempotencyKey] of an email which is about to be sent. The result saved for the
+// key is returned, with false, when the email was already sent and should be skipped. Otherwise the returned
+// function must be called with the outcome of sending the email, it saves a successful result to the
+// [IdempotencyStore] and releases the claim so a failed email can be retried.
+func claimSend(ctx context.Context, app *App, eventData EventData) (Result, func(Result, error), bool, error) {
+	complete := func(Result, error) {}
+	if eventData.IdempotencyKey == "" || dryRunFrom(ctx) != nil {
+		return Result{}, complete, true, nil
+	}
+
+	key := sentKeyPrefix + eventData.IdempotencyKey
+	app.sendClaims.mu.Lock()
+	_, inFlight := app.sendClaims.claims[key]
+	if !inFlight {
+		app.sendClaims.claims[key] = struct{}{}
+	}
+	app.sendClaims.mu.Unlock()
+	if inFlight {
+		return Result{}, complete, false, sendError{
+			class: ErrorClassStorage,
+			err:   fmt.Errorf("email with idempotency key \"%s\" is already being sent", eventData.IdempotencyKey),
+		}
+	}
+	release := func() {
+		app.sendClaims.mu.Lock()
+		defer app.sendClaims.mu.Unlock()
+		delete(app.sendClaims.claims, key)
+	}
+
+	saved, ok, err := app.idempotencyStore.Load(ctx, key)
+	if err != nil {
+		release()
+		return Result{}, complete, false, sendError{
+			class: ErrorClassStorage,
+			err:   fmt.Errorf("failed to load idempotency key \"%s\" - %v", eventData.IdempotencyKey, err),
+		}
+	}
+	if ok {
+		release()
+		var result Result
+		if err := json.Unmarshal(saved.Body, &result); err != nil {
+			app.errorLogger.Printf("failed to decode sent result %s - %v", eventData.IdempotencyKey, err)
+		}
+		return result, complete, false, nil
+	}
+
+	return Result{}, func(result Result, sendErr error) {
+		defer release()
+		if sendErr != nil {
+			return
+		}
+		body, err := json.Marshal(result)
+		if err == nil {
+			err = app.idempotencyStore.Save(ctx, key, IdempotentResponse{StatusCode: http.StatusOK, Body: body})
+		}
+		if err != nil {
+			app.errorLogger.Printf("failed to save idempotency key \"%s\" - %v", eventData.IdempotencyKey, err)
+		}
+	}, true, nil
+}
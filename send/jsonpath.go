@@ -0,0 +1,134 @@
+package send
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonPathSegment selects the children of a JSON value, an object member by key, an array element by index, or every
+// child with a wildcard.
+type jsonPathSegment struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// jsonPath is a parsed JSONPath expression, the subset supported is the root "$" followed by ".key", "['key']",
+// "[0]", "[-1]", ".*", and "[*]" segments.
+type jsonPath []jsonPathSegment
+
+// parseJSONPath parses a JSONPath expression i.e. "$.user.emails[0]" or "$.attendees[*].email".
+func parseJSONPath(expression string) (jsonPath, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(expression), "$")
+	if !ok {
+		return nil, fmt.Errorf("JSONPath \"%s\" must start with \"$\"", expression)
+	}
+
+	var path jsonPath
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+			key := rest[:end]
+			rest = rest[end:]
+			if key == "" {
+				return nil, fmt.Errorf("JSONPath \"%s\" has an empty key", expression)
+			}
+			if key == "*" {
+				path = append(path, jsonPathSegment{wildcard: true})
+				continue
+			}
+			path = append(path, jsonPathSegment{key: key})
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("JSONPath \"%s\" has an unclosed \"[\"", expression)
+			}
+			segment, err := parseJSONPathBracket(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("JSONPath \"%s\" - %v", expression, err)
+			}
+			path = append(path, segment)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("JSONPath \"%s\" has an unexpected \"%c\"", expression, rest[0])
+		}
+	}
+
+	return path, nil
+}
+
+// parseJSONPathBracket parses the contents of a bracketed segment, a quoted key, an index, or "*".
+func parseJSONPathBracket(contents string) (jsonPathSegment, error) {
+	contents = strings.TrimSpace(contents)
+	if contents == "*" {
+		return jsonPathSegment{wildcard: true}, nil
+	}
+	if len(contents) >= 2 && (contents[0] == '\'' || contents[0] == '"') && contents[len(contents)-1] == contents[0] {
+		return jsonPathSegment{key: contents[1 : len(contents)-1]}, nil
+	}
+	index, err := strconv.Atoi(contents)
+	if err != nil {
+		return jsonPathSegment{}, fmt.Errorf("invalid index \"%s\"", contents)
+	}
+
+	return jsonPathSegment{index: index, isIndex: true}, nil
+}
+
+// evaluate returns every value the path selects from the decoded JSON document. Missing keys and out of range indexes
+// select nothing rather than being an error.
+func (path jsonPath) evaluate(document interface{}) []interface{} {
+	nodes := []interface{}{document}
+	for _, segment := range path {
+		var next []interface{}
+		for _, node := range nodes {
+			next = append(next, segment.children(node)...)
+		}
+		nodes = next
+	}
+
+	return nodes
+}
+
+// children returns the values the segment selects from a single JSON value.
+func (segment jsonPathSegment) children(node interface{}) []interface{} {
+	switch value := node.(type) {
+	case map[string]interface{}:
+		if segment.wildcard {
+			// Members are selected in key order so the same document always selects values in the same order.
+			keys := make([]string, 0, len(value))
+			for key := range value {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			children := make([]interface{}, 0, len(value))
+			for _, key := range keys {
+				children = append(children, value[key])
+			}
+			return children
+		}
+		if child, ok := value[segment.key]; ok && !segment.isIndex {
+			return []interface{}{child}
+		}
+	case []interface{}:
+		if segment.wildcard {
+			return value
+		}
+		index := segment.index
+		if index < 0 {
+			index += len(value)
+		}
+		if segment.isIndex && index >= 0 && index < len(value) {
+			return []interface{}{value[index]}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,336 @@
+package send
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// fixtureSuffix is appended to a template name, without its extension, to find the sample data used to lint the
+// template i.e. emails/welcome.html -> emails/welcome.fixture.json.
+const fixtureSuffix = ".fixture.json"
+
+// Lint issue severities, only [LintSeverityError] issues should fail a build.
+const (
+	LintSeverityError   = "error"
+	LintSeverityWarning = "warning"
+)
+
+// Lint issue codes.
+const (
+	LintReadError        = "read-error"
+	LintSyntaxError      = "syntax-error"
+	LintUndefinedPartial = "undefined-partial"
+	LintMissingVariable  = "missing-variable"
+	LintUnusedVariable   = "unused-variable"
+	LintRenderError      = "render-error"
+	LintBrokenLink       = "broken-link"
+	LintInvalidFixture   = "invalid-fixture"
+)
+
+// LintOptions configures [LintTemplates].
+type LintOptions struct {
+	// Prefix limits linting to templates in file storage that start with the prefix i.e. "emails/".
+	Prefix string
+	// CheckRemoteLinks makes an HTTP request to every http(s) href and src, otherwise only links to files in file
+	// storage are checked.
+	CheckRemoteLinks bool
+	// HTTPClient is used to check remote links, [http.DefaultClient] is used when nil.
+	HTTPClient *http.Client
+}
+
+// LintIssue is a single problem found with a template.
+type LintIssue struct {
+	Template string `json:"template"`
+	Severity string `json:"severity"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+}
+
+// LintReport is the result of linting every template.
+type LintReport struct {
+	// Templates are the names of the templates that were linted.
+	Templates []string    `json:"templates"`
+	Issues    []LintIssue `json:"issues"`
+}
+
+// HasErrors reports whether any issue has [LintSeverityError].
+func (report LintReport) HasErrors() bool {
+	for _, issue := range report.Issues {
+		if issue.Severity == LintSeverityError {
+			return true
+		}
+	}
+
+	return false
+}
+
+// LintTemplates walks every template in the App file storage, any file with an extension registered to a
+// [TemplateEngine], and checks it with the same engine and template functions used to send emails. Templates are
+// checked for:
+//
+//   - Syntax errors and undefined partials, for engines implementing [TemplateInspector].
+//   - Missing and unused variables when a sample data fixture exists next to the template
+//     i.e. emails/welcome.html -> emails/welcome.fixture.json.
+//   - Errors rendering the template with the fixture.
+//   - Broken href and src links in the rendered HTML. Relative links must exist in file storage, remote links are
+//     only checked with [LintOptions.CheckRemoteLinks].
+//
+// An error is only returned when linting could not be performed i.e. file storage could not be listed.
+func LintTemplates(ctx context.Context, app *App, opts LintOptions) (LintReport, error) {
+	report := LintReport{Templates: []string{}, Issues: []LintIssue{}}
+	iter := app.fileStorage.List(&blob.ListOptions{Prefix: opts.Prefix})
+	for {
+		obj, err := iter.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return report, err
+		}
+		if obj.IsDir || !isTemplate(app, obj.Key) {
+			continue
+		}
+
+		report.Templates = append(report.Templates, obj.Key)
+		report.Issues = append(report.Issues, lintTemplate(ctx, app, opts, obj.Key)...)
+	}
+
+	return report, nil
+}
+
+// isTemplate reports whether the file is a template based on its extension, sidecar files and published versions are
+// not linted.
+func isTemplate(app *App, name string) bool {
+	if strings.HasSuffix(name, schemaSuffix) || strings.HasSuffix(name, fixtureSuffix) || isVersionedName(name) {
+		return false
+	}
+	_, ok := app.templateExtensions[strings.ToLower(path.Ext(name))]
+	return ok
+}
+
+// lintTemplate returns every issue found with a single template.
+func lintTemplate(ctx context.Context, app *App, opts LintOptions, name string) []LintIssue {
+	var issues []LintIssue
+	issue := func(severity string, code string, message string) {
+		issues = append(issues, LintIssue{Template: name, Severity: severity, Code: code, Message: message})
+	}
+
+	engine, err := chooseTemplateEngine(app, EventData{Template: name})
+	if err != nil {
+		issue(LintSeverityError, LintReadError, err.Error())
+		return issues
+	}
+	source, err := readTemplate(ctx, app, name)
+	if err != nil {
+		issue(LintSeverityError, LintReadError, err.Error())
+		return issues
+	}
+	_, source = splitFrontMatter(source)
+
+	fixture, hasFixture, err := readFixture(ctx, app, name)
+	if err != nil {
+		issue(LintSeverityError, LintInvalidFixture, err.Error())
+		return issues
+	}
+	input := TemplateInput{
+		Name:        name,
+		Source:      source,
+		Data:        fixture,
+		Funcs:       app.templateFuncs,
+		FileStorage: app.fileStorage,
+	}
+
+	if inspector, ok := engine.(TemplateInspector); ok {
+		info, err := inspector.Inspect(ctx, input)
+		if err != nil {
+			issue(LintSeverityError, LintSyntaxError, err.Error())
+			return issues
+		}
+		for _, partial := range info.UndefinedPartials {
+			issue(LintSeverityError, LintUndefinedPartial, fmt.Sprintf("partial \"%s\" is not defined", partial))
+		}
+		if hasFixture {
+			missing, unused := compareVariables(engine, info.Variables, fixture)
+			for _, variable := range missing {
+				issue(LintSeverityError, LintMissingVariable, fmt.Sprintf("variable \"%s\" is not in the fixture", variable))
+			}
+			for _, variable := range unused {
+				issue(LintSeverityWarning, LintUnusedVariable, fmt.Sprintf("fixture variable \"%s\" is never used", variable))
+			}
+			// Rendering would only fail on the first missing variable again.
+			if len(missing) > 0 {
+				return issues
+			}
+		}
+	}
+
+	if !hasFixture {
+		return issues
+	}
+	body, err := determineEmailBody(ctx, app, EventData{Template: name, Data: fixture})
+	if err != nil {
+		issue(LintSeverityError, LintRenderError, err.Error())
+		return issues
+	}
+	for _, link := range brokenLinks(ctx, app, opts, name, body.HTML) {
+		issue(LintSeverityError, LintBrokenLink, link)
+	}
+
+	return issues
+}
+
+// readFixture reads the sample data for a template, a missing fixture is not an error.
+func readFixture(ctx context.Context, app *App, name string) (map[string]interface{}, bool, error) {
+	location := strings.TrimSuffix(name, path.Ext(name)) + fixtureSuffix
+	contents, err := app.fileStorage.ReadAll(ctx, location)
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read fixture %s - %v", location, err)
+	}
+
+	var fixture map[string]interface{}
+	if err := json.Unmarshal(contents, &fixture); err != nil {
+		return nil, false, fmt.Errorf("failed to unmarshal fixture %s - %v", location, err)
+	}
+	return fixture, true, nil
+}
+
+// compareVariables returns the variables the template references that are missing from the fixture and the fixture
+// variables the template never references. Go template engines title case the fixture keys before comparing.
+func compareVariables(engine TemplateEngine, variables []string, fixture map[string]interface{}) ([]string, []string) {
+	// keys maps the variable name used in the template to the fixture key.
+	keys := make(map[string]string, len(fixture))
+	_, caseSensitive := engine.(MustacheTemplateEngine)
+	for k := range fixture {
+		if caseSensitive {
+			keys[k] = k
+			continue
+		}
+		keys[titleCase(k)] = k
+	}
+
+	used := make(map[string]bool)
+	var missing []string
+	for _, variable := range variables {
+		if _, ok := keys[variable]; !ok {
+			missing = append(missing, variable)
+			continue
+		}
+		used[keys[variable]] = true
+	}
+
+	var unused []string
+	for k := range fixture {
+		if !used[k] {
+			unused = append(unused, k)
+		}
+	}
+	sort.Strings(unused)
+
+	return missing, unused
+}
+
+// brokenLinks returns a message for every href and src in the HTML which does not resolve.
+func brokenLinks(ctx context.Context, app *App, opts LintOptions, name string, body string) []string {
+	if body == "" {
+		return nil
+	}
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	var broken []string
+	for _, n := range findElements(doc, atom.A, atom.Img, atom.Link, atom.Script, atom.Source, atom.Area) {
+		for _, key := range []string{"href", "src"} {
+			link := strings.TrimSpace(attr(n, key))
+			if link == "" || strings.HasPrefix(link, "#") {
+				continue
+			}
+			if err := checkLink(ctx, app, opts, name, link); err != nil {
+				broken = append(broken, fmt.Sprintf("%s \"%s\" is broken - %v", key, link, err))
+			}
+		}
+	}
+
+	return broken
+}
+
+// checkLink checks a single link. Links without a scheme are relative to the template in file storage.
+func checkLink(ctx context.Context, app *App, opts LintOptions, name string, link string) error {
+	u, err := url.Parse(link)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "":
+		if u.Host != "" {
+			return nil
+		}
+		key := strings.TrimPrefix(u.Path, "/")
+		if !strings.HasPrefix(u.Path, "/") {
+			key = path.Join(path.Dir(name), u.Path)
+		}
+		exists, err := app.fileStorage.Exists(ctx, key)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("%s does not exist", key)
+		}
+		return nil
+	case "http", "https":
+		if !opts.CheckRemoteLinks {
+			return nil
+		}
+		return checkRemoteLink(ctx, opts, link)
+	case "mailto", "tel", "cid", "data":
+		return nil
+	}
+
+	return fmt.Errorf("scheme \"%s\" is not allowed", u.Scheme)
+}
+
+// checkRemoteLink makes a HEAD request to the link falling back to GET for servers which do not support HEAD.
+func checkRemoteLink(ctx context.Context, opts LintOptions, link string) error {
+	client := opts.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	var status int
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequestWithContext(ctx, method, link, nil)
+		if err != nil {
+			return err
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		_ = res.Body.Close()
+		status = res.StatusCode
+		if status < 400 {
+			return nil
+		}
+		if status != http.StatusMethodNotAllowed {
+			break
+		}
+	}
+
+	return fmt.Errorf("status %d", status)
+}
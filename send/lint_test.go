@@ -0,0 +1,89 @@
+package send_test
+
+import (
+	"context"
+	"github.com/itmayziii/email/send"
+	"gocloud.dev/blob/memblob"
+	"reflect"
+	"testing"
+)
+
+func TestLintTemplates_ReportsIssues(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	t.Cleanup(func() { _ = bucket.Close() })
+	files := map[string]string{
+		"emails/ok.html":                   `<a href="terms.html">{{ .Name }}</a>{{ range .Items }}{{ .Price }}{{ end }}`,
+		"emails/ok.fixture.json":           `{"name": "Tommy", "items": [{"Price": 1}]}`,
+		"emails/terms.html":                `terms`,
+		"emails/syntax.html":               `{{ .Name `,
+		"emails/variables.html":            `{{ .Name }} {{ $.Total }}`,
+		"emails/variables.fixture.json":    `{"name": "Tommy", "extra": true}`,
+		"emails/partial.mustache":          `{{> missing}}{{#items}}{{> row}}{{/items}}`,
+		"emails/row.mustache":              `{{price}}`,
+		"emails/links.html":                `<img src="logo.png"><a href="javascript:alert(1)">x</a><a href="mailto:a@b.c">y</a>`,
+		"emails/links.fixture.json":        `{}`,
+		"emails/sub.html":                  `{{ template "footer" . }}`,
+		"emails/render.html":               `{{ currency "NOPE" .Total }}`,
+		"emails/render.fixture.json":       `{"total": 1}`,
+		"emails/welcome.schema.json":       `{}`,
+		"emails/invalid.html":              `hi`,
+		"emails/invalid.fixture.json":      `{`,
+		"other/ignored.html":               `{{ .Name `,
+		"emails/styles.css":                `p { color: red }`,
+		"emails/announcement.md":           `# {{ .Title }}`,
+		"emails/announcement.fixture.json": `{"title": "Hi"}`,
+		"emails/promo@2024.html":           `promo`,
+		"emails/welcome@v3.html":           `{{ .Name `,
+	}
+	for name, contents := range files {
+		if err := bucket.WriteAll(ctx, name, []byte(contents), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app := send.NewApp(send.AppWithFileStorage(bucket))
+
+	report, err := send.LintTemplates(ctx, app, send.LintOptions{Prefix: "emails/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedTemplates := []string{
+		"emails/announcement.md",
+		"emails/invalid.html",
+		"emails/links.html",
+		"emails/ok.html",
+		"emails/partial.mustache",
+		"emails/promo@2024.html",
+		"emails/render.html",
+		"emails/row.mustache",
+		"emails/sub.html",
+		"emails/syntax.html",
+		"emails/terms.html",
+		"emails/variables.html",
+	}
+	if !reflect.DeepEqual(report.Templates, expectedTemplates) {
+		t.Errorf("expected templates %v to match %v", report.Templates, expectedTemplates)
+	}
+
+	expectedCodes := map[string][]string{
+		"emails/invalid.html":     {send.LintInvalidFixture},
+		"emails/links.html":       {send.LintBrokenLink, send.LintBrokenLink},
+		"emails/partial.mustache": {send.LintUndefinedPartial},
+		"emails/render.html":      {send.LintRenderError},
+		"emails/sub.html":         {send.LintUndefinedPartial},
+		"emails/syntax.html":      {send.LintSyntaxError},
+		"emails/variables.html":   {send.LintMissingVariable, send.LintUnusedVariable},
+	}
+	actualCodes := make(map[string][]string)
+	for _, issue := range report.Issues {
+		actualCodes[issue.Template] = append(actualCodes[issue.Template], issue.Code)
+	}
+	if !reflect.DeepEqual(actualCodes, expectedCodes) {
+		t.Errorf("expected issues %v to match %v", report.Issues, expectedCodes)
+	}
+	if !report.HasErrors() {
+		t.Errorf("expected report to have errors")
+	}
+}
@@ -3,16 +3,22 @@ package send
 import (
 	"context"
 	"github.com/mailgun/mailgun-go/v4"
+	"time"
 )
 
+// mailgunMaxScheduleDelay is how far in the future Mailgun accepts a delivery time.
+const mailgunMaxScheduleDelay = 72 * time.Hour
+
 // MailgunSenderAdapter allows a mailgun.Mailgun interface to become compatible with the Sender interface.
 type MailgunSenderAdapter struct {
 	mailgun mailgun.Mailgun
 }
 
 func (adapter MailgunSenderAdapter) Send(ctx context.Context, m Message) (string, error) {
-	message := adapter.mailgun.NewMessage(m.Sender, m.Subject, "", m.To...)
-	message.SetHtml(m.Body)
+	message := adapter.mailgun.NewMessage(m.Sender, m.Subject, m.Text, m.To...)
+	if m.Body != "" {
+		message.SetHtml(m.Body)
+	}
 
 	for _, cc := range m.Cc {
 		message.AddCC(cc)
@@ -22,10 +28,28 @@ func (adapter MailgunSenderAdapter) Send(ctx context.Context, m Message) (string
 		message.AddCC(bcc)
 	}
 
+	if m.Category != "" {
+		// Exposed to webhooks as "user-variables".
+		if err := message.AddVariable("category", m.Category); err != nil {
+			return "", err
+		}
+	}
+	for name, value := range m.Headers {
+		message.AddHeader(name, value)
+	}
+	if !m.SendAt.IsZero() {
+		message.SetDeliveryTime(m.SendAt)
+	}
+
 	_, id, err := adapter.mailgun.Send(ctx, message)
 	return id, err
 }
 
+// MaxScheduleDelay implements [ScheduledSender], Mailgun accepts a delivery time up to 3 days in the future.
+func (adapter MailgunSenderAdapter) MaxScheduleDelay() time.Duration {
+	return mailgunMaxScheduleDelay
+}
+
 // NewMailgunSender constructs a MailgunSenderAdapter
 func NewMailgunSender(mailgun mailgun.Mailgun) Sender {
 	return MailgunSenderAdapter{mailgun: mailgun}
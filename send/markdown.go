@@ -0,0 +1,82 @@
+package send
+
+import (
+	"bytes"
+	"context"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	htmlTemplate "html/template"
+)
+
+// MarkdownEngine is the name of the [MarkdownTemplateEngine].
+const MarkdownEngine = "markdown"
+
+const contentTypeMarkdown = "text/markdown"
+
+// markdownSanitizer only allows the HTML that is safe for user generated content. Raw HTML in markdown is already
+// omitted by goldmark but the sanitizer is a second line of defense against anything like a javascript: link.
+var markdownSanitizer = bluemonday.UGCPolicy()
+
+// markdownRenderer converts markdown to HTML with support for GitHub flavored markdown i.e. tables.
+var markdownRenderer = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// MarkdownTemplateEngine renders [Markdown] bound to the template variables with [Go text templates]. The rendered
+// markdown is converted to sanitized HTML and wrapped in the layout configured with [AppWithMarkdownLayout], the
+// markdown itself is used as the plain text alternative. Template variables are expected to be title case
+// i.e. {{ .Title }}.
+//
+// [Markdown]: https://commonmark.org/
+// [Go text templates]: https://pkg.go.dev/text/template
+type MarkdownTemplateEngine struct{}
+
+func (e MarkdownTemplateEngine) Execute(ctx context.Context, input TemplateInput) (string, error) {
+	return executeTextTemplate(input.Source, input.Data, input.Funcs)
+}
+
+func (e MarkdownTemplateEngine) Inspect(ctx context.Context, input TemplateInput) (TemplateInfo, error) {
+	return inspectGoTemplate(input.Source, input.Funcs)
+}
+
+func (e MarkdownTemplateEngine) ContentType() string {
+	return contentTypeMarkdown
+}
+
+// renderMarkdown converts markdown to sanitized HTML and wraps it in the App.markdownLayout when one is configured.
+// The layout is a [Go HTML template] which has access to the HTML as {{ .Content }}, the email subject as
+// {{ .Subject }}, and the same variables as the template.
+//
+// [Go HTML template]: https://pkg.go.dev/html/template
+func renderMarkdown(ctx context.Context, app *App, msgData EventData, markdown string) (string, error) {
+	content, err := markdownToSafeHTML(markdown)
+	if err != nil {
+		return "", err
+	}
+	if app.markdownLayout == "" {
+		return content, nil
+	}
+
+	layout, err := readTemplate(ctx, app, app.markdownLayout)
+	if err != nil {
+		return "", err
+	}
+	msgTemplateData := templateData(msgData)
+	data := make(map[string]interface{}, len(msgTemplateData)+2)
+	for k, v := range msgTemplateData {
+		data[k] = v
+	}
+	data["content"] = htmlTemplate.HTML(content)
+	data["subject"] = msgData.Subject
+
+	return executeTemplate(layout, data, messageTemplateFuncs(app, msgData))
+}
+
+// markdownToSafeHTML converts markdown to sanitized HTML.
+func markdownToSafeHTML(markdown string) (string, error) {
+	var buf bytes.Buffer
+	if err := markdownRenderer.Convert([]byte(markdown), &buf); err != nil {
+		return "", err
+	}
+
+	return markdownSanitizer.Sanitize(buf.String()), nil
+}
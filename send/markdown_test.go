@@ -0,0 +1,93 @@
+package send_test
+
+import (
+	"context"
+	"github.com/itmayziii/email/send"
+	"gocloud.dev/blob/memblob"
+	"testing"
+)
+
+func TestEmailEvent_RendersMarkdown(t *testing.T) {
+	tests := []struct {
+		name         string
+		layout       string
+		data         map[string]interface{}
+		expectedHTML string
+		expectedText string
+	}{
+		{
+			"body markdown",
+			"",
+			map[string]interface{}{"bodyMarkdown": "# Hi {{ .Name }}\n\n[docs](https://example.com)"},
+			"<h1>Hi Tommy</h1>\n<p><a href=\"https://example.com\" rel=\"nofollow\">docs</a></p>\n",
+			"# Hi Tommy\n\n[docs](https://example.com)",
+		},
+		{
+			"markdown template",
+			"",
+			map[string]interface{}{"template": "announcement.md"},
+			"<p><strong>New</strong> for Tommy</p>\n",
+			"**New** for Tommy",
+		},
+		{
+			"sanitized",
+			"",
+			map[string]interface{}{"bodyMarkdown": "[click](javascript:alert(1)) <script>alert(1)</script>"},
+			"<p>click alert(1)</p>\n",
+			"[click](javascript:alert(1)) <script>alert(1)</script>",
+		},
+		{
+			"layout",
+			"layout.html",
+			map[string]interface{}{"bodyMarkdown": "Hi {{ .Name }}"},
+			"<html><title>test</title><body><p>Hi Tommy</p>\n</body></html>",
+			"Hi Tommy",
+		},
+	}
+
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	t.Cleanup(func() { _ = bucket.Close() })
+	files := map[string]string{
+		"announcement.md": "**New** for {{ .Name }}",
+		"layout.html":     "<html><title>{{ .Subject }}</title><body>{{ .Content }}</body></html>",
+	}
+	for name, contents := range files {
+		if err := bucket.WriteAll(ctx, name, []byte(contents), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range tests {
+		ttCopy := tt
+		t.Run(ttCopy.name, func(t *testing.T) {
+			t.Parallel()
+			sender := &recordingSender{}
+			app := send.NewApp(
+				send.AppWithFileStorage(bucket),
+				send.AppWithDomainSender("example.com", sender),
+				send.AppWithMarkdownLayout(ttCopy.layout),
+			)
+
+			data := map[string]interface{}{
+				"sender":  "no-reply@example.com",
+				"subject": "test",
+				"to":      "tom@example.com",
+				"data":    map[string]interface{}{"name": "Tommy"},
+			}
+			for k, v := range ttCopy.data {
+				data[k] = v
+			}
+			err := send.EmailEvent(app)(ctx, newEvent(t, data))
+			if err != nil {
+				t.Fatalf("case: \"%s\", unexpected error: %v", ttCopy.name, err)
+			}
+			if sender.messages[0].Body != ttCopy.expectedHTML {
+				t.Errorf("expected body %q to match %q", sender.messages[0].Body, ttCopy.expectedHTML)
+			}
+			if sender.messages[0].Text != ttCopy.expectedText {
+				t.Errorf("expected text %q to match %q", sender.messages[0].Text, ttCopy.expectedText)
+			}
+		})
+	}
+}
@@ -0,0 +1,340 @@
+package send
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MessagesPath is the path of the JSON API served by [MessagesHandler].
+const MessagesPath = "/v1/messages"
+
+// IdempotencyKeyHeader is the request header which makes retrying a request to [MessagesHandler] safe.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength is the longest Idempotency-Key accepted.
+const maxIdempotencyKeyLength = 255
+
+// defaultIdempotencyTTL is how long responses are kept by the [MemoryIdempotencyStore] the App uses when it is not
+// configured with [AppWithIdempotencyStore].
+const defaultIdempotencyTTL = 24 * time.Hour
+
+// maxMessageBytes is the largest request body accepted by [MessagesHandler].
+const maxMessageBytes = 1 << 20
+
+// Error codes of an [APIError] other than the [ErrorClass] of an email which failed to send.
+const (
+	ErrorCodeInvalidRequest       = "invalid_request"
+	ErrorCodeIdempotencyKeyReused = "idempotency_key_reused"
+	ErrorCodeRequestInProgress    = "request_in_progress"
+	ErrorCodeNotFound             = "not_found"
+	ErrorCodeMethodNotAllowed     = "method_not_allowed"
+	ErrorCodeInternal             = "internal"
+)
+
+// MessageResponse is the body of a successful response from [MessagesHandler].
+type MessageResponse struct {
+	// ID is the id returned by the [Sender], empty unless the email was sent to [EventData.To].
+	ID     string        `json:"id,omitempty"`
+	Status MessageStatus `json:"status"`
+	// ScheduleKey is the key a scheduled email can be canceled with, see [CancelScheduledEmail].
+	ScheduleKey string `json:"scheduleKey,omitempty"`
+	// Recipients are the results for every recipient of an email to [EventData.Recipients].
+	Recipients []RecipientResult `json:"recipients,omitempty"`
+}
+
+// FieldViolation is a single invalid field of a request.
+type FieldViolation struct {
+	// Field is the JSON name of the field i.e. "to", or the path within "data" i.e. "data.items[0].price".
+	Field       string `json:"field"`
+	Description string `json:"description"`
+}
+
+// APIError describes why a request to [MessagesHandler] failed.
+type APIError struct {
+	// Code is the [ErrorClass] when the email failed to send, otherwise one of the ErrorCode constants.
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Violations are the invalid fields of a "validation" error.
+	Violations []FieldViolation `json:"violations,omitempty"`
+	// Recipients are the results for every recipient when an email to [EventData.Recipients] could not be sent to
+	// anyone.
+	Recipients []RecipientResult `json:"recipients,omitempty"`
+}
+
+// ErrorResponse is the body of a failed response from [MessagesHandler].
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// IdempotentResponse is a response saved to an [IdempotencyStore] to be replayed when a request is retried with the
+// same Idempotency-Key.
+type IdempotentResponse struct {
+	// Fingerprint is the hash of the request body, a retry with a different body is rejected.
+	Fingerprint string          `json:"fingerprint"`
+	StatusCode  int             `json:"statusCode"`
+	Body        json.RawMessage `json:"body"`
+}
+
+// IdempotencyStore saves the responses of [MessagesHandler] by Idempotency-Key, and the results of sent emails by
+// [EventData.IdempotencyKey]. Implement it with shared storage i.e. Redis when running more than one instance.
+type IdempotencyStore interface {
+	// Load returns the response saved for the key, false when there is none.
+	Load(ctx context.Context, key string) (IdempotentResponse, bool, error)
+	// Save saves the response for the key.
+	Save(ctx context.Context, key string, response IdempotentResponse) error
+}
+
+// MemoryIdempotencyStore is an [IdempotencyStore] which keeps responses in memory until they expire, it is only
+// suitable for testing or single instance deployments.
+type MemoryIdempotencyStore struct {
+	ttl       time.Duration
+	mu        sync.Mutex
+	responses map[string]memoryIdempotentResponse
+}
+
+type memoryIdempotentResponse struct {
+	response  IdempotentResponse
+	expiresAt time.Time
+}
+
+// NewMemoryIdempotencyStore constructs a [MemoryIdempotencyStore] which keeps responses for the ttl.
+func NewMemoryIdempotencyStore(ttl time.Duration) *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{ttl: ttl, responses: make(map[string]memoryIdempotentResponse)}
+}
+
+func (store *MemoryIdempotencyStore) Load(ctx context.Context, key string) (IdempotentResponse, bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	saved, ok := store.responses[key]
+	if !ok || time.Now().After(saved.expiresAt) {
+		return IdempotentResponse{}, false, nil
+	}
+	return saved.response, true, nil
+}
+
+func (store *MemoryIdempotencyStore) Save(ctx context.Context, key string, response IdempotentResponse) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	now := time.Now()
+	for savedKey, saved := range store.responses {
+		if now.After(saved.expiresAt) {
+			delete(store.responses, savedKey)
+		}
+	}
+	store.responses[key] = memoryIdempotentResponse{response: response, expiresAt: now.Add(store.ttl)}
+	return nil
+}
+
+// messagesHandler serves the JSON API of [MessagesHandler].
+type messagesHandler struct {
+	app   *App
+	store IdempotencyStore
+	// inFlight are the Idempotency-Keys of requests being handled, so a concurrent retry does not send the email
+	// twice.
+	mu       sync.Mutex
+	inFlight map[string]struct{}
+}
+
+// MessagesHandler creates an [http.Handler] serving "POST /v1/messages" for services which want to send an email
+// with a plain JSON request rather than a CloudEvent. The request body is [EventData], the email goes through the
+// same steps as [EmailEvent], and the response is a [MessageResponse] with the id returned by the [Sender] or an
+// [ErrorResponse] with the invalid fields.
+//
+// Requests with an Idempotency-Key header are safe to retry, the response to the first request is replayed for
+// every retry with the same key and body. Responses are saved to the [IdempotencyStore] configured with
+// [AppWithIdempotencyStore], or kept in memory for 24 hours. The key is also the [EventData.IdempotencyKey], a request
+// whose body or attributes set a different idempotency key is rejected.
+func MessagesHandler(app *App) http.Handler {
+	return &messagesHandler{app: app, store: app.idempotencyStore, inFlight: make(map[string]struct{})}
+}
+
+func (handler *messagesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != MessagesPath {
+		handler.writeError(w, http.StatusNotFound, APIError{Code: ErrorCodeNotFound, Message: "not found"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		handler.writeError(w, http.StatusMethodNotAllowed, APIError{Code: ErrorCodeMethodNotAllowed, Message: "method not allowed"})
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxMessageBytes))
+	if err != nil {
+		handler.writeError(w, http.StatusRequestEntityTooLarge, APIError{Code: ErrorCodeInvalidRequest, Message: err.Error()})
+		return
+	}
+
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if key == "" {
+		statusCode, response := handler.send(r.Context(), "", body)
+		handler.writeJSON(w, statusCode, response)
+		return
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		handler.writeError(w, http.StatusBadRequest, APIError{
+			Code:    ErrorCodeInvalidRequest,
+			Message: fmt.Sprintf("%s must be at most %d characters", IdempotencyKeyHeader, maxIdempotencyKeyLength),
+		})
+		return
+	}
+	handler.sendIdempotent(r.Context(), w, key, body)
+}
+
+// sendIdempotent replays the saved response for the Idempotency-Key or sends the email and saves the response.
+// Server errors are not saved so the request can be retried.
+func (handler *messagesHandler) sendIdempotent(ctx context.Context, w http.ResponseWriter, key string, body []byte) {
+	if !handler.claim(key) {
+		handler.writeError(w, http.StatusConflict, APIError{
+			Code:    ErrorCodeRequestInProgress,
+			Message: fmt.Sprintf("a request with the %s \"%s\" is in progress", IdempotencyKeyHeader, key),
+		})
+		return
+	}
+	defer handler.release(key)
+
+	fingerprint := sha256.Sum256(body)
+	saved, ok, err := handler.store.Load(ctx, key)
+	if err != nil {
+		handler.app.errorLogger.Printf("failed to load idempotent response %s - %v", key, err)
+		handler.writeError(w, http.StatusInternalServerError, APIError{Code: ErrorCodeInternal, Message: "failed to load idempotent response"})
+		return
+	}
+	if ok {
+		if saved.Fingerprint != hex.EncodeToString(fingerprint[:]) {
+			handler.writeError(w, http.StatusUnprocessableEntity, APIError{
+				Code:    ErrorCodeIdempotencyKeyReused,
+				Message: fmt.Sprintf("the %s \"%s\" was already used with a different request", IdempotencyKeyHeader, key),
+			})
+			return
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+		handler.writeJSON(w, saved.StatusCode, saved.Body)
+		return
+	}
+
+	statusCode, response := handler.send(ctx, key, body)
+	encoded, err := json.Marshal(response)
+	if err != nil {
+		handler.app.errorLogger.Printf("failed to encode messages response - %v", err)
+	}
+	if err == nil && statusCode < http.StatusInternalServerError {
+		saved := IdempotentResponse{Fingerprint: hex.EncodeToString(fingerprint[:]), StatusCode: statusCode, Body: encoded}
+		if err := handler.store.Save(ctx, key, saved); err != nil {
+			handler.app.errorLogger.Printf("failed to save idempotent response %s - %v", key, err)
+		}
+	}
+	handler.writeJSON(w, statusCode, json.RawMessage(encoded))
+}
+
+func (handler *messagesHandler) claim(key string) bool {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	if _, ok := handler.inFlight[key]; ok {
+		return false
+	}
+	handler.inFlight[key] = struct{}{}
+	return true
+}
+
+func (handler *messagesHandler) release(key string) {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	delete(handler.inFlight, key)
+}
+
+// send decodes the [EventData] from the request body and sends it with [App.Send], returning the response status
+// code and body.
+func (handler *messagesHandler) send(ctx context.Context, idempotencyKey string, body []byte) (int, interface{}) {
+	var eventData EventData
+	if err := json.Unmarshal(body, &eventData); err != nil {
+		return http.StatusBadRequest, ErrorResponse{Error: APIError{Code: ErrorCodeInvalidRequest, Message: fmt.Sprintf("invalid JSON - %v", err)}}
+	}
+	if idempotencyKey != "" {
+		// The attributes are applied again by App.Send, so an idempotency key from the body or an attribute which
+		// disagrees with the header would replace it.
+		if applied, err := applyAttributes(handler.app, eventData); err == nil && applied.IdempotencyKey != "" && applied.IdempotencyKey != idempotencyKey {
+			return http.StatusBadRequest, ErrorResponse{Error: APIError{
+				Code:    ErrorCodeInvalidRequest,
+				Message: fmt.Sprintf("\"idempotencyKey\" \"%s\" does not match the %s header", applied.IdempotencyKey, IdempotencyKeyHeader),
+			}}
+		}
+		eventData.IdempotencyKey = idempotencyKey
+	}
+
+	result, err := handler.app.Send(ctx, eventData)
+	if err != nil {
+		return errorStatusCode(err), ErrorResponse{Error: apiError(err)}
+	}
+
+	response := MessageResponse{ID: result.ID, Status: result.Status, ScheduleKey: result.ScheduleKey, Recipients: result.Recipients}
+	if response.Status == MessageStatusScheduled {
+		return http.StatusAccepted, response
+	}
+	return http.StatusOK, response
+}
+
+// apiError describes why an email failed to send, with the invalid fields of a validation error.
+func apiError(err error) APIError {
+	apiErr := APIError{Code: string(ClassifyError(err)), Message: err.Error(), Violations: fieldViolations(err)}
+	var batchSendError BatchSendError
+	if errors.As(err, &batchSendError) {
+		apiErr.Recipients = batchSendError.Results()
+	}
+	return apiErr
+}
+
+// fieldViolations are the invalid fields of a [FieldError] or the invalid values of a [SchemaValidationError].
+func fieldViolations(err error) []FieldViolation {
+	var fieldError FieldError
+	if errors.As(err, &fieldError) {
+		return []FieldViolation{{Field: fieldError.Field(), Description: fieldError.Error()}}
+	}
+	var schemaValidationError SchemaValidationError
+	if errors.As(err, &schemaValidationError) {
+		violations := make([]FieldViolation, len(schemaValidationError.Violations))
+		for i, violation := range schemaValidationError.Violations {
+			violations[i] = FieldViolation{Field: "data" + strings.TrimPrefix(violation.Path, "$"), Description: violation.Message}
+		}
+		return violations
+	}
+
+	return nil
+}
+
+// errorStatusCode is the HTTP status code for the [ErrorClass] of an email which failed to send.
+func errorStatusCode(err error) int {
+	switch ClassifyError(err) {
+	case ErrorClassValidation, ErrorClassTemplate:
+		return http.StatusUnprocessableEntity
+	case ErrorClassConfiguration:
+		return http.StatusInternalServerError
+	case ErrorClassTimeout:
+		return http.StatusGatewayTimeout
+	case ErrorClassStorage:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+func (handler *messagesHandler) writeError(w http.ResponseWriter, statusCode int, apiErr APIError) {
+	handler.writeJSON(w, statusCode, ErrorResponse{Error: apiErr})
+}
+
+func (handler *messagesHandler) writeJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		handler.app.errorLogger.Printf("failed to write messages response - %v", err)
+	}
+}
@@ -0,0 +1,235 @@
+package send_test
+
+import (
+	"encoding/json"
+	"github.com/itmayziii/email/send"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// postMessage sends the body to the handler and returns the response.
+func postMessage(t *testing.T, handler http.Handler, body string, idempotencyKey string) *httptest.ResponseRecorder {
+	t.Helper()
+	request := httptest.NewRequest(http.MethodPost, send.MessagesPath, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	if idempotencyKey != "" {
+		request.Header.Set(send.IdempotencyKeyHeader, idempotencyKey)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestMessagesHandler(t *testing.T) {
+	sendAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedCode   string
+		expectedField  string
+		expectedSent   send.MessageStatus
+	}{
+		{
+			name:           "sent",
+			body:           `{"sender":"no-reply@example.com","subject":"test","to":"tom@example.com","body":"hello"}`,
+			expectedStatus: http.StatusOK,
+			expectedSent:   send.MessageStatusSent,
+		},
+		{
+			name:           "scheduled",
+			body:           `{"sender":"no-reply@example.com","subject":"test","to":"tom@example.com","body":"hello","sendAt":"` + sendAt + `"}`,
+			expectedStatus: http.StatusAccepted,
+			expectedSent:   send.MessageStatusScheduled,
+		},
+		{
+			name:           "missing subject",
+			body:           `{"sender":"no-reply@example.com","to":"tom@example.com","body":"hello"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCode:   string(send.ErrorClassValidation),
+			expectedField:  "subject",
+		},
+		{
+			name:           "invalid to",
+			body:           `{"sender":"no-reply@example.com","subject":"test","to":"not an email","body":"hello"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCode:   string(send.ErrorClassValidation),
+			expectedField:  "to",
+		},
+		{
+			name:           "invalid JSON",
+			body:           `{"sender":`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   send.ErrorCodeInvalidRequest,
+		},
+		{
+			name:           "unregistered sender domain",
+			body:           `{"sender":"no-reply@example.org","subject":"test","to":"tom@example.com","body":"hello"}`,
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   string(send.ErrorClassConfiguration),
+		},
+	}
+
+	for _, tt := range tests {
+		ttCopy := tt
+		t.Run(ttCopy.name, func(t *testing.T) {
+			t.Parallel()
+			sender := &recordingSender{}
+			app := send.NewApp(send.AppWithDomainSender("example.com", sender), send.AppWithScheduleStore(send.NewMemoryScheduleStore()))
+
+			recorder := postMessage(t, send.MessagesHandler(app), ttCopy.body, "")
+
+			if recorder.Code != ttCopy.expectedStatus {
+				t.Fatalf("case: \"%s\", expected status %d, got %d: %s", ttCopy.name, ttCopy.expectedStatus, recorder.Code, recorder.Body)
+			}
+			if recorder.Header().Get("Content-Type") != "application/json" {
+				t.Errorf("case: \"%s\", expected a JSON response, got %s", ttCopy.name, recorder.Header().Get("Content-Type"))
+			}
+			if ttCopy.expectedCode == "" {
+				var response send.MessageResponse
+				if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+					t.Fatal(err)
+				}
+				if response.Status != ttCopy.expectedSent {
+					t.Errorf("case: \"%s\", expected status %s, got %+v", ttCopy.name, ttCopy.expectedSent, response)
+				}
+				if response.Status == send.MessageStatusSent && response.ID != "id" {
+					t.Errorf("case: \"%s\", expected the sender id, got %+v", ttCopy.name, response)
+				}
+				return
+			}
+
+			var response send.ErrorResponse
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if response.Error.Code != ttCopy.expectedCode || response.Error.Message == "" {
+				t.Errorf("case: \"%s\", expected error code %s, got %+v", ttCopy.name, ttCopy.expectedCode, response.Error)
+			}
+			if ttCopy.expectedField != "" && (len(response.Error.Violations) != 1 || response.Error.Violations[0].Field != ttCopy.expectedField) {
+				t.Errorf("case: \"%s\", expected a violation of %s, got %+v", ttCopy.name, ttCopy.expectedField, response.Error.Violations)
+			}
+			if len(sender.messages) != 0 {
+				t.Errorf("case: \"%s\", expected no messages, got %d", ttCopy.name, len(sender.messages))
+			}
+		})
+	}
+}
+
+func TestMessagesHandler_InvalidRoutes(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+	}{
+		{"not a POST", http.MethodGet, send.MessagesPath, http.StatusMethodNotAllowed},
+		{"unknown path", http.MethodPost, "/v1/other", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		ttCopy := tt
+		t.Run(ttCopy.name, func(t *testing.T) {
+			t.Parallel()
+			app := send.NewApp(send.AppWithDomainSender("example.com", &recordingSender{}))
+			recorder := httptest.NewRecorder()
+
+			send.MessagesHandler(app).ServeHTTP(recorder, httptest.NewRequest(ttCopy.method, ttCopy.path, nil))
+
+			if recorder.Code != ttCopy.expectedStatus {
+				t.Errorf("case: \"%s\", expected status %d, got %d", ttCopy.name, ttCopy.expectedStatus, recorder.Code)
+			}
+		})
+	}
+}
+
+func TestMessagesHandler_IdempotencyKey(t *testing.T) {
+	t.Parallel()
+	sender := &recordingSender{}
+	app := send.NewApp(send.AppWithDomainSender("example.com", sender))
+	handler := send.MessagesHandler(app)
+	body := `{"sender":"no-reply@example.com","subject":"test","to":"tom@example.com","body":"hello"}`
+
+	first := postMessage(t, handler, body, "order-1234")
+	retry := postMessage(t, handler, body, "order-1234")
+	if first.Code != http.StatusOK || retry.Code != http.StatusOK {
+		t.Fatalf("expected both requests to succeed, got %d and %d", first.Code, retry.Code)
+	}
+	if retry.Body.String() != first.Body.String() || retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("expected the first response %s to be replayed, got %s", first.Body, retry.Body)
+	}
+	if len(sender.messages) != 1 {
+		t.Errorf("expected 1 message, got %d", len(sender.messages))
+	}
+
+	reused := postMessage(t, handler, strings.Replace(body, "hello", "goodbye", 1), "order-1234")
+	var response send.ErrorResponse
+	if err := json.Unmarshal(reused.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if reused.Code != http.StatusUnprocessableEntity || response.Error.Code != send.ErrorCodeIdempotencyKeyReused {
+		t.Errorf("expected the reused key to be rejected, got %d: %s", reused.Code, reused.Body)
+	}
+
+	other := postMessage(t, handler, body, "order-5678")
+	if other.Code != http.StatusOK || len(sender.messages) != 2 {
+		t.Errorf("expected a different key to send again, got %d with %d messages", other.Code, len(sender.messages))
+	}
+}
+
+func TestMessagesHandler_IdempotencyKeySchedulesWithKey(t *testing.T) {
+	t.Parallel()
+	store := send.NewMemoryScheduleStore()
+	app := send.NewApp(send.AppWithDomainSender("example.com", &recordingSender{}), send.AppWithScheduleStore(store))
+	sendAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	recorder := postMessage(t, send.MessagesHandler(app), `{"sender":"no-reply@example.com","subject":"test","to":"tom@example.com","body":"hello","sendAt":"`+sendAt+`"}`, "order-1234")
+
+	var response send.MessageResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if recorder.Code != http.StatusAccepted || response.ScheduleKey != "order-1234" {
+		t.Errorf("expected the email scheduled with the key, got %d: %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestMessagesHandler_IdempotencyKeyMismatch(t *testing.T) {
+	tests := []struct {
+		name           string
+		fields         string
+		expectedStatus int
+	}{
+		{"attribute", `"attributes":{"idempotencyKey":"order-5678"}`, http.StatusBadRequest},
+		{"body", `"idempotencyKey":"order-5678"`, http.StatusBadRequest},
+		{"matching attribute", `"attributes":{"idempotencyKey":"order-1234"}`, http.StatusAccepted},
+	}
+
+	for _, tt := range tests {
+		ttCopy := tt
+		t.Run(ttCopy.name, func(t *testing.T) {
+			t.Parallel()
+			store := send.NewMemoryScheduleStore()
+			sender := &recordingSender{}
+			app := send.NewApp(send.AppWithDomainSender("example.com", sender), send.AppWithScheduleStore(store))
+			sendAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+			body := `{"sender":"no-reply@example.com","subject":"test","to":"tom@example.com","body":"hello","sendAt":"` + sendAt + `",` + ttCopy.fields + `}`
+
+			recorder := postMessage(t, send.MessagesHandler(app), body, "order-1234")
+
+			if recorder.Code != ttCopy.expectedStatus {
+				t.Fatalf("case: \"%s\", expected status %d but got %d: %s", ttCopy.name, ttCopy.expectedStatus, recorder.Code, recorder.Body)
+			}
+			var response send.MessageResponse
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if recorder.Code == http.StatusAccepted && response.ScheduleKey != "order-1234" {
+				t.Errorf("case: \"%s\", expected the email scheduled with the header key, got %s", ttCopy.name, recorder.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package send
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"gocloud.dev/pubsub"
+	"strings"
+	"time"
+)
+
+const (
+	// resultTypePrefix is prepended to the [DeliveryStatus] for the type of result events i.e. "email.sent".
+	resultTypePrefix = "email."
+	// resultCorrelationExtension is the CloudEvent extension attribute holding the id of the event which requested the
+	// email, it is also the subject of the result event.
+	resultCorrelationExtension = "correlationid"
+)
+
+// ErrorClass groups the reasons an email fails to send so consumers of result events can decide whether to retry.
+type ErrorClass string
+
+const (
+	// ErrorClassValidation means the event data or recipient was invalid, retrying will not help.
+	ErrorClassValidation ErrorClass = "validation"
+	// ErrorClassTemplate means the email body could not be rendered.
+	ErrorClassTemplate ErrorClass = "template"
+	// ErrorClassConfiguration means the App is missing something the email requires i.e. a [Sender] for the domain.
+	ErrorClassConfiguration ErrorClass = "configuration"
+	// ErrorClassProvider means the email provider rejected or failed to accept the email.
+	ErrorClassProvider ErrorClass = "provider"
+	// ErrorClassTimeout means the email provider did not respond in time or the context was canceled.
+	ErrorClassTimeout ErrorClass = "timeout"
+	// ErrorClassStorage means a store the email depends on, i.e. the [ScheduleStore] or [SuppressionStore], failed,
+	// or an email with the same [EventData.IdempotencyKey] is still being sent.
+	ErrorClassStorage ErrorClass = "storage"
+)
+
+// SendResult is the data of the "email.sent" and "email.failed" CloudEvents published by a [ResultPublisher].
+type SendResult struct {
+	// EventID is the id of the CloudEvent which requested the email.
+	EventID string `json:"eventId"`
+	// MessageID is the id the email provider assigned to the email, it is empty when the email failed to send.
+	MessageID       string     `json:"messageId,omitempty"`
+	Sender          string     `json:"sender"`
+	Subject         string     `json:"subject"`
+	To              []string   `json:"to"`
+	Cc              []string   `json:"cc,omitempty"`
+	Bcc             []string   `json:"bcc,omitempty"`
+	Category        string     `json:"category,omitempty"`
+	Template        string     `json:"template,omitempty"`
+	TemplateVersion string     `json:"templateVersion,omitempty"`
+	ErrorClass      ErrorClass `json:"errorClass,omitempty"`
+	Error           string     `json:"error,omitempty"`
+}
+
+// ResultPublisher publishes the result CloudEvents configured with [AppWithResultPublisher]. Implementations must be
+// safe for concurrent use.
+type ResultPublisher interface {
+	Publish(ctx context.Context, event cloudevents.Event) error
+}
+
+// CloudEventsPublisher is a [ResultPublisher] which sends result events with a CloudEvents client i.e. over HTTP.
+type CloudEventsPublisher struct {
+	client cloudevents.Client
+}
+
+// NewCloudEventsPublisher constructs a [CloudEventsPublisher].
+//
+//	client, err := cloudevents.NewClientHTTP(cloudevents.WithTarget("https://example.com/events"))
+//	publisher := send.NewCloudEventsPublisher(client)
+func NewCloudEventsPublisher(client cloudevents.Client) CloudEventsPublisher {
+	return CloudEventsPublisher{client: client}
+}
+
+func (publisher CloudEventsPublisher) Publish(ctx context.Context, event cloudevents.Event) error {
+	if result := publisher.client.Send(ctx, event); !cloudevents.IsACK(result) {
+		return result
+	}
+	return nil
+}
+
+// PubSubPublisher is a [ResultPublisher] which sends result events to a [gocloud pubsub topic] in the CloudEvents
+// binary content mode, the event data is the message body and the attributes are "ce-" prefixed message metadata.
+//
+// [gocloud pubsub topic]: https://gocloud.dev/howto/pubsub/publish/
+type PubSubPublisher struct {
+	topic *pubsub.Topic
+}
+
+// NewPubSubPublisher constructs a [PubSubPublisher], the caller is responsible for shutting down the topic.
+func NewPubSubPublisher(topic *pubsub.Topic) PubSubPublisher {
+	return PubSubPublisher{topic: topic}
+}
+
+func (publisher PubSubPublisher) Publish(ctx context.Context, event cloudevents.Event) error {
+	metadata := map[string]string{
+		"ce-specversion": event.SpecVersion(),
+		"ce-id":          event.ID(),
+		"ce-source":      event.Source(),
+		"ce-type":        event.Type(),
+		"content-type":   event.DataContentType(),
+	}
+	if event.Subject() != "" {
+		metadata["ce-subject"] = event.Subject()
+	}
+	if !event.Time().IsZero() {
+		metadata["ce-time"] = event.Time().UTC().Format(time.RFC3339Nano)
+	}
+	for name, value := range event.Extensions() {
+		metadata["ce-"+name] = fmt.Sprint(value)
+	}
+
+	return publisher.topic.Send(ctx, &pubsub.Message{Body: event.Data(), Metadata: metadata})
+}
+
+// sendError classifies why sending an email failed without changing the error message.
+type sendError struct {
+	class ErrorClass
+	err   error
+}
+
+func (sendError sendError) Error() string {
+	return sendError.err.Error()
+}
+
+func (sendError sendError) Unwrap() error {
+	return sendError.err
+}
+
+// ClassifyError returns the [ErrorClass] of an error returned while sending an email i.e. by [App.Send], only
+// [ErrorClassProvider], [ErrorClassTimeout], and [ErrorClassStorage] errors are worth retrying. Errors which were not
+// classified are assumed to come from the email provider.
+func ClassifyError(err error) ErrorClass {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return ErrorClassTimeout
+	}
+	var classified sendError
+	if errors.As(err, &classified) {
+		return classified.class
+	}
+	return ErrorClassProvider
+}
+
+// publishResult publishes an "email.sent" or "email.failed" CloudEvent for an email sent, or failed to be sent, for
+// the CloudEvent with the eventID. A failure to publish is logged rather than failing the email which was already
+// sent.
+func publishResult(ctx context.Context, app *App, eventID string, eventData EventData, version string, id string, sendErr error) {
+	if app.resultPublisher == nil || dryRunFrom(ctx) != nil {
+		return
+	}
+
+	result := SendResult{
+		EventID:         eventID,
+		MessageID:       normalizeMessageID(id),
+		Sender:          eventData.Sender,
+		Subject:         eventData.Subject,
+		To:              eventData.To,
+		Cc:              eventData.Cc,
+		Bcc:             eventData.Bcc,
+		Category:        eventData.Category,
+		Template:        eventData.Template,
+		TemplateVersion: version,
+	}
+	status := StatusSent
+	if sendErr != nil {
+		status = StatusFailed
+		result.ErrorClass = ClassifyError(sendErr)
+		result.Error = sendErr.Error()
+	}
+	for _, recipient := range eventData.Recipients {
+		result.To = append(result.To, recipient.To)
+	}
+
+	// The recipients are hashed so retries have the same id without putting email addresses in the id.
+	recipients := sha256.Sum256([]byte(strings.Join(result.To, ",")))
+	event := cloudevents.NewEvent()
+	event.SetID(fmt.Sprintf("%s-%s-%s", eventID, status, hex.EncodeToString(recipients[:8])))
+	event.SetSource(app.resultSource)
+	event.SetType(resultTypePrefix + string(status))
+	event.SetSubject(eventID)
+	event.SetExtension(resultCorrelationExtension, eventID)
+	event.SetTime(time.Now().UTC())
+	if err := event.SetData(cloudevents.ApplicationJSON, result); err != nil {
+		app.errorLogger.Printf("failed to create %s event for %s - %v", event.Type(), eventID, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Second*10)
+	defer cancel()
+	if err := app.resultPublisher.Publish(ctx, event); err != nil {
+		app.errorLogger.Printf("failed to publish %s event for %s - %v", event.Type(), eventID, err)
+	}
+}
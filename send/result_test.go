@@ -0,0 +1,329 @@
+package send_test
+
+import (
+	"context"
+	"errors"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/itmayziii/email/send"
+	"gocloud.dev/pubsub/mempubsub"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingPublisher implements [send.ResultPublisher] and keeps every event it was asked to publish.
+type recordingPublisher struct {
+	mu     sync.Mutex
+	events []cloudevents.Event
+}
+
+func (rp *recordingPublisher) Publish(ctx context.Context, event cloudevents.Event) error {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	rp.events = append(rp.events, event)
+	return nil
+}
+
+// failingSender implements [send.Sender] and fails to send every message.
+type failingSender struct{}
+
+func (fs failingSender) Send(ctx context.Context, m send.Message) (string, error) {
+	return "", errors.New("provider unavailable")
+}
+
+func sendResult(t *testing.T, event cloudevents.Event) send.SendResult {
+	t.Helper()
+	var result send.SendResult
+	if err := event.DataAs(&result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestEmailEvent_PublishesResult(t *testing.T) {
+	tests := []struct {
+		name               string
+		sender             send.Sender
+		data               map[string]interface{}
+		expectedType       string
+		expectedErrorClass send.ErrorClass
+	}{
+		{
+			"sent",
+			&recordingSender{},
+			map[string]interface{}{"to": "tom@example.com", "body": "hello"},
+			"email.sent",
+			"",
+		},
+		{
+			"provider failure",
+			failingSender{},
+			map[string]interface{}{"to": "tom@example.com", "body": "hello"},
+			"email.failed",
+			send.ErrorClassProvider,
+		},
+		{
+			"template failure",
+			&recordingSender{},
+			map[string]interface{}{"to": "tom@example.com", "body": "{{ .Missing.Field }}"},
+			"email.failed",
+			send.ErrorClassTemplate,
+		},
+		{
+			"invalid event",
+			&recordingSender{},
+			map[string]interface{}{"to": "not an email", "body": "hello"},
+			"email.failed",
+			send.ErrorClassValidation,
+		},
+	}
+
+	for _, tt := range tests {
+		ttCopy := tt
+		t.Run(ttCopy.name, func(t *testing.T) {
+			t.Parallel()
+			publisher := &recordingPublisher{}
+			app := send.NewApp(
+				send.AppWithDomainSender("example.com", ttCopy.sender),
+				send.AppWithResultPublisher(publisher, "email-service"),
+			)
+			data := map[string]interface{}{"sender": "no-reply@example.com", "subject": "test"}
+			for k, v := range ttCopy.data {
+				data[k] = v
+			}
+
+			_ = send.EmailEvent(app)(context.Background(), newEvent(t, data))
+			if len(publisher.events) != 1 {
+				t.Fatalf("case: \"%s\", expected 1 result event, got %d", ttCopy.name, len(publisher.events))
+			}
+			event := publisher.events[0]
+			if event.Type() != ttCopy.expectedType || event.Subject() != "1" || event.Source() != "email-service" {
+				t.Errorf("case: \"%s\", unexpected event %s", ttCopy.name, event)
+			}
+			if correlation := event.Extensions()["correlationid"]; correlation != "1" {
+				t.Errorf("case: \"%s\", expected correlationid 1, got %v", ttCopy.name, correlation)
+			}
+
+			result := sendResult(t, event)
+			if result.EventID != "1" || result.ErrorClass != ttCopy.expectedErrorClass {
+				t.Errorf("case: \"%s\", unexpected result %+v", ttCopy.name, result)
+			}
+			if ttCopy.expectedErrorClass == "" && result.MessageID != "id" {
+				t.Errorf("case: \"%s\", expected message id \"id\", got %+v", ttCopy.name, result)
+			}
+			if len(result.To) != 1 || result.To[0] != ttCopy.data["to"] {
+				t.Errorf("case: \"%s\", expected the recipient in the result, got %+v", ttCopy.name, result)
+			}
+		})
+	}
+}
+
+// failingSuppressionStore implements [send.SuppressionStore] and fails every lookup.
+type failingSuppressionStore struct {
+	send.SuppressionStore
+}
+
+func (fs failingSuppressionStore) Find(ctx context.Context, emails []string) ([]send.Suppression, error) {
+	return nil, errors.New("store unavailable")
+}
+
+func TestEmailEvent_PublishesResultForEveryFailure(t *testing.T) {
+	tests := []struct {
+		name               string
+		data               interface{}
+		opts               []send.AppOption
+		expectedErrorClass send.ErrorClass
+	}{
+		{
+			"invalid event data",
+			"not event data",
+			nil,
+			send.ErrorClassValidation,
+		},
+		{
+			"unpublished template version",
+			map[string]interface{}{"template": "welcome.html@latest"},
+			nil,
+			send.ErrorClassTemplate,
+		},
+		{
+			"suppression store failure",
+			map[string]interface{}{"body": "hello"},
+			[]send.AppOption{send.AppWithSuppressionStore(failingSuppressionStore{})},
+			send.ErrorClassStorage,
+		},
+	}
+
+	for _, tt := range tests {
+		ttCopy := tt
+		t.Run(ttCopy.name, func(t *testing.T) {
+			t.Parallel()
+			publisher := &recordingPublisher{}
+			opts := append([]send.AppOption{
+				send.AppWithDomainSender("example.com", &recordingSender{}),
+				send.AppWithResultPublisher(publisher, "email-service"),
+			}, ttCopy.opts...)
+			app := send.NewApp(opts...)
+			data := ttCopy.data
+			if fields, ok := data.(map[string]interface{}); ok {
+				fields["sender"], fields["subject"], fields["to"] = "no-reply@example.com", "test", "tom@example.com"
+			}
+
+			err := send.EmailEvent(app)(context.Background(), newEvent(t, data))
+			if send.ClassifyError(err) != ttCopy.expectedErrorClass {
+				t.Errorf("case: \"%s\", expected a %s error, got %v", ttCopy.name, ttCopy.expectedErrorClass, err)
+			}
+			if len(publisher.events) != 1 || publisher.events[0].Type() != "email.failed" {
+				t.Fatalf("case: \"%s\", expected an email.failed event, got %v", ttCopy.name, publisher.events)
+			}
+			if result := sendResult(t, publisher.events[0]); result.ErrorClass != ttCopy.expectedErrorClass {
+				t.Errorf("case: \"%s\", unexpected result %+v", ttCopy.name, result)
+			}
+		})
+	}
+}
+
+func TestEmailEvent_ResultIDHasNoEmailAddresses(t *testing.T) {
+	t.Parallel()
+	publisher := &recordingPublisher{}
+	app := send.NewApp(
+		send.AppWithDomainSender("example.com", &recordingSender{}),
+		send.AppWithResultPublisher(publisher, "email-service"),
+	)
+	event := newEvent(t, map[string]interface{}{"sender": "no-reply@example.com", "subject": "test", "to": "tom@example.com", "body": "hello"})
+
+	for i := 0; i < 2; i++ {
+		if err := send.EmailEvent(app)(context.Background(), event); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if len(publisher.events) != 2 {
+		t.Fatalf("expected 2 result events, got %d", len(publisher.events))
+	}
+	id := publisher.events[0].ID()
+	if strings.Contains(id, "tom") || !strings.HasPrefix(id, "1-sent-") {
+		t.Errorf("expected an id without the recipient, got %s", id)
+	}
+	if publisher.events[1].ID() != id {
+		t.Errorf("expected a retried event to have the same result id %s, got %s", id, publisher.events[1].ID())
+	}
+}
+
+func TestEmailEvent_PublishesResultPerRecipient(t *testing.T) {
+	t.Parallel()
+	publisher := &recordingPublisher{}
+	app := send.NewApp(
+		send.AppWithDomainSender("example.com", &recordingSender{}),
+		send.AppWithResultPublisher(publisher, "email-service"),
+	)
+
+	err := send.EmailEvent(app)(context.Background(), newEvent(t, map[string]interface{}{
+		"sender":     "no-reply@example.com",
+		"subject":    "test",
+		"body":       "hello",
+		"recipients": []map[string]interface{}{{"to": "tom@example.com"}, {"to": "invalid"}},
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	results := make(map[string]send.SendResult)
+	for _, event := range publisher.events {
+		result := sendResult(t, event)
+		results[result.To[0]] = result
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected a result per recipient, got %+v", results)
+	}
+	if results["tom@example.com"].ErrorClass != "" || results["invalid"].ErrorClass != send.ErrorClassValidation {
+		t.Errorf("unexpected results %+v", results)
+	}
+}
+
+func TestCloudEventsPublisher(t *testing.T) {
+	t.Parallel()
+	received := make(chan *http.Request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		received <- r
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(server.Close)
+	client, err := cloudevents.NewClientHTTP(cloudevents.WithTarget(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := send.NewApp(
+		send.AppWithDomainSender("example.com", &recordingSender{}),
+		send.AppWithResultPublisher(send.NewCloudEventsPublisher(client), "email-service"),
+	)
+
+	err = send.EmailEvent(app)(context.Background(), newEvent(t, map[string]interface{}{
+		"sender":  "no-reply@example.com",
+		"subject": "test",
+		"to":      "tom@example.com",
+		"body":    "hello",
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	select {
+	case r := <-received:
+		if r.Header.Get("Ce-Type") != "email.sent" || r.Header.Get("Ce-Subject") != "1" {
+			t.Errorf("unexpected CloudEvent headers %v", r.Header)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a result event to be posted")
+	}
+}
+
+func TestPubSubPublisher(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	topic := mempubsub.NewTopic()
+	t.Cleanup(func() {
+		_ = topic.Shutdown(ctx)
+	})
+	subscription := mempubsub.NewSubscription(topic, time.Minute)
+	t.Cleanup(func() {
+		_ = subscription.Shutdown(ctx)
+	})
+	app := send.NewApp(
+		send.AppWithDomainSender("example.com", failingSender{}),
+		send.AppWithResultPublisher(send.NewPubSubPublisher(topic), "email-service"),
+	)
+
+	err := send.EmailEvent(app)(ctx, newEvent(t, map[string]interface{}{
+		"sender":  "no-reply@example.com",
+		"subject": "test",
+		"to":      "tom@example.com",
+		"body":    "hello",
+	}))
+	if err == nil {
+		t.Fatal("expected the send to fail")
+	}
+
+	receiveCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	message, err := subscription.Receive(receiveCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message.Ack()
+	if message.Metadata["ce-type"] != "email.failed" || message.Metadata["ce-correlationid"] != "1" {
+		t.Errorf("unexpected message metadata %v", message.Metadata)
+	}
+	event := cloudevents.NewEvent()
+	if err := event.SetData(message.Metadata["content-type"], message.Body); err != nil {
+		t.Fatal(err)
+	}
+	if result := sendResult(t, event); result.ErrorClass != send.ErrorClassProvider || result.Error != "provider unavailable" {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
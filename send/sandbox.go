@@ -0,0 +1,134 @@
+package send
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// originalToHeader is the header holding every recipient of an email before [Sandbox] rewrote them.
+const originalToHeader = "X-Original-To"
+
+// bodyTagPattern finds the opening <body> tag of an HTML email so the sandbox banner can be placed inside it.
+var bodyTagPattern = regexp.MustCompile(`(?i)<body[^>]*>`)
+
+// Sandbox keeps non-production environments from emailing real people, see [AppWithSandbox]. A recipient is allowed
+// when their domain is in AllowedDomains or their address matches any of AllowedPatterns, every other recipient is
+// replaced with CatchAll or, without a CatchAll, removed.
+type Sandbox struct {
+	// CatchAll receives the email in place of every recipient which is not allowed.
+	CatchAll string
+	// AllowedDomains are email domains i.e. "example.com" which are sent to as is.
+	AllowedDomains []string
+	// AllowedPatterns are matched against the lower case email address of recipients which are sent to as is i.e.
+	// regexp.MustCompile(`^qa\+.*@example\.com$`).
+	AllowedPatterns []*regexp.Regexp
+}
+
+// allowed reports whether an email can be sent to the address as is.
+func (sandbox Sandbox) allowed(address string) bool {
+	address = normalizeEmail(address)
+	domain, _ := extractEmailDomain(address)
+	for _, allowedDomain := range sandbox.AllowedDomains {
+		if strings.EqualFold(domain, allowedDomain) {
+			return true
+		}
+	}
+	for _, pattern := range sandbox.AllowedPatterns {
+		if pattern.MatchString(address) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rewrite returns the addresses which are allowed along with the CatchAll in place of the ones which are not.
+func (sandbox Sandbox) rewrite(addresses []string, seen map[string]bool) []string {
+	var rewritten []string
+	for _, address := range addresses {
+		if !sandbox.allowed(address) {
+			if sandbox.CatchAll == "" {
+				continue
+			}
+			address = sandbox.CatchAll
+		}
+		if seen[normalizeEmail(address)] {
+			continue
+		}
+		seen[normalizeEmail(address)] = true
+		rewritten = append(rewritten, address)
+	}
+
+	return rewritten
+}
+
+// applySandbox rewrites the recipients of the message with the [Sandbox] configured with [AppWithSandbox] and reports
+// whether anyone is left to send the message to. When any recipient changes the original recipients are added to the
+// X-Original-To header and a banner at the top of the body, and the rewrite is logged.
+func applySandbox(app *App, message Message) (Message, bool) {
+	if app.sandbox == nil {
+		return message, true
+	}
+
+	seen := make(map[string]bool)
+	to := app.sandbox.rewrite(message.To, seen)
+	cc := app.sandbox.rewrite(message.Cc, seen)
+	bcc := app.sandbox.rewrite(message.Bcc, seen)
+	if slices.Equal(to, message.To) && slices.Equal(cc, message.Cc) && slices.Equal(bcc, message.Bcc) {
+		return message, true
+	}
+
+	original := describeRecipients(message.To, message.Cc, message.Bcc)
+	if len(to) == 0 {
+		app.infoLogger.Printf(
+			"sandbox dropped email, no recipients are allowed: original: %s, subject: %s\n",
+			original,
+			message.Subject,
+		)
+		return message, false
+	}
+	app.infoLogger.Printf(
+		"sandbox rewrote recipients: original: %s, rewritten: %s, subject: %s\n",
+		original,
+		describeRecipients(to, cc, bcc),
+		message.Subject,
+	)
+
+	headers := make(map[string]string, len(message.Headers)+1)
+	for name, value := range message.Headers {
+		headers[name] = value
+	}
+	var originalAddresses []string
+	for _, addresses := range [][]string{message.To, message.Cc, message.Bcc} {
+		originalAddresses = append(originalAddresses, addresses...)
+	}
+	headers[originalToHeader] = strings.Join(originalAddresses, ", ")
+
+	banner := fmt.Sprintf("Sandbox email, originally %s", original)
+	if message.Body != "" {
+		htmlBanner := fmt.Sprintf(
+			`<div style="background:#fff3cd;border:1px solid #ffc107;padding:8px;font-family:sans-serif;">%s</div>`,
+			html.EscapeString(banner),
+		)
+		if location := bodyTagPattern.FindStringIndex(message.Body); location != nil {
+			message.Body = message.Body[:location[1]] + htmlBanner + message.Body[location[1]:]
+		} else {
+			message.Body = htmlBanner + message.Body
+		}
+	}
+	if message.Text != "" {
+		message.Text = "[" + banner + "]\n\n" + message.Text
+	}
+	message.To, message.Cc, message.Bcc = to, cc, bcc
+	message.Headers = headers
+
+	return message, true
+}
+
+// describeRecipients formats recipients for logs and the sandbox banner i.e. "to: [a@example.com], cc: []".
+func describeRecipients(to []string, cc []string, bcc []string) string {
+	return fmt.Sprintf("to: %s, cc: %s, bcc: %s", to, cc, bcc)
+}
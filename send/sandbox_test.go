@@ -0,0 +1,200 @@
+package send_test
+
+import (
+	"bytes"
+	"context"
+	"github.com/itmayziii/email/send"
+	"log"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestEmailEvent_Sandbox(t *testing.T) {
+	sandbox := send.Sandbox{
+		CatchAll:        "staging@example.com",
+		AllowedDomains:  []string{"example.com"},
+		AllowedPatterns: []*regexp.Regexp{regexp.MustCompile(`^qa\+.*@gmail\.com$`)},
+	}
+	tests := []struct {
+		name          string
+		sandbox       send.Sandbox
+		to            []string
+		cc            []string
+		expectedTo    []string
+		expectedCc    []string
+		expectedSent  bool
+		expectedNoted bool
+	}{
+		{
+			"allowed recipients are unchanged",
+			sandbox,
+			[]string{"tom@example.com", "QA+1@gmail.com"},
+			nil,
+			[]string{"tom@example.com", "QA+1@gmail.com"},
+			nil,
+			true,
+			false,
+		},
+		{
+			"recipients are rewritten to the catch-all",
+			sandbox,
+			[]string{"customer@gmail.com", "tom@example.com"},
+			[]string{"other@yahoo.com"},
+			[]string{"staging@example.com", "tom@example.com"},
+			nil,
+			true,
+			true,
+		},
+		{
+			"recipients are dropped without a catch-all",
+			send.Sandbox{AllowedDomains: []string{"example.com"}},
+			[]string{"customer@gmail.com", "tom@example.com"},
+			[]string{"other@yahoo.com"},
+			[]string{"tom@example.com"},
+			nil,
+			true,
+			true,
+		},
+		{
+			"email is dropped when no recipients are allowed",
+			send.Sandbox{AllowedDomains: []string{"example.com"}},
+			[]string{"customer@gmail.com"},
+			nil,
+			nil,
+			nil,
+			false,
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		ttCopy := tt
+		t.Run(ttCopy.name, func(t *testing.T) {
+			t.Parallel()
+			var logs bytes.Buffer
+			sender := &recordingSender{}
+			app := send.NewApp(
+				send.AppWithDomainSender("example.com", sender),
+				send.AppWithSandbox(ttCopy.sandbox),
+				send.AppWithInfoLogger(log.New(&logs, "", 0)),
+			)
+
+			data := map[string]interface{}{
+				"sender":  "no-reply@example.com",
+				"subject": "test",
+				"to":      ttCopy.to,
+				"body":    "<html><body><p>hello</p></body></html>",
+			}
+			if ttCopy.cc != nil {
+				data["cc"] = ttCopy.cc
+			}
+			err := send.EmailEvent(app)(context.Background(), newEvent(t, data))
+			if err != nil {
+				t.Fatalf("case: \"%s\", unexpected error: %v", ttCopy.name, err)
+			}
+
+			if !ttCopy.expectedSent {
+				if len(sender.messages) != 0 {
+					t.Errorf("case: \"%s\", expected no message, got %+v", ttCopy.name, sender.messages)
+				}
+				if !strings.Contains(logs.String(), "sandbox dropped email") {
+					t.Errorf("case: \"%s\", expected the dropped email to be logged, got %s", ttCopy.name, logs.String())
+				}
+				return
+			}
+			if len(sender.messages) != 1 {
+				t.Fatalf("case: \"%s\", expected 1 message, got %d", ttCopy.name, len(sender.messages))
+			}
+			message := sender.messages[0]
+			if !reflect.DeepEqual(message.To, ttCopy.expectedTo) || !reflect.DeepEqual(message.Cc, ttCopy.expectedCc) {
+				t.Errorf("case: \"%s\", expected to %v cc %v, got to %v cc %v", ttCopy.name, ttCopy.expectedTo, ttCopy.expectedCc, message.To, message.Cc)
+			}
+
+			originalTo := message.Headers["X-Original-To"]
+			hasBanner := strings.HasPrefix(message.Body, "<html><body><div") && strings.Contains(message.Body, ttCopy.to[0])
+			logged := strings.Contains(logs.String(), "sandbox rewrote recipients")
+			if !ttCopy.expectedNoted {
+				if originalTo != "" || hasBanner || logged {
+					t.Errorf("case: \"%s\", expected the email to be unchanged, got %+v", ttCopy.name, message)
+				}
+				return
+			}
+			expectedOriginalTo := strings.Join(append(append([]string{}, ttCopy.to...), ttCopy.cc...), ", ")
+			if originalTo != expectedOriginalTo {
+				t.Errorf("case: \"%s\", expected X-Original-To %q, got %q", ttCopy.name, expectedOriginalTo, originalTo)
+			}
+			if !hasBanner {
+				t.Errorf("case: \"%s\", expected a banner with the original recipients, got %s", ttCopy.name, message.Body)
+			}
+			if !logged {
+				t.Errorf("case: \"%s\", expected the rewrite to be logged, got %s", ttCopy.name, logs.String())
+			}
+		})
+	}
+}
+
+func TestApp_SendSandbox(t *testing.T) {
+	tests := []struct {
+		name              string
+		sandbox           send.Sandbox
+		expectedStatus    send.MessageStatus
+		expectedRecipient string
+	}{
+		{
+			name:              "rewritten recipients are recorded",
+			sandbox:           send.Sandbox{CatchAll: "staging@example.com", AllowedDomains: []string{"example.com"}},
+			expectedStatus:    send.MessageStatusSent,
+			expectedRecipient: "staging@example.com",
+		},
+		{
+			name:           "dropped email is not recorded",
+			sandbox:        send.Sandbox{AllowedDomains: []string{"example.com"}},
+			expectedStatus: send.MessageStatusSandboxed,
+		},
+	}
+
+	for _, tt := range tests {
+		ttCopy := tt
+		t.Run(ttCopy.name, func(t *testing.T) {
+			t.Parallel()
+			sendLog := send.NewMemorySendLog()
+			publisher := &recordingPublisher{}
+			app := send.NewApp(
+				send.AppWithDomainSender("example.com", &recordingSender{}),
+				send.AppWithSandbox(ttCopy.sandbox),
+				send.AppWithSendLog(sendLog),
+				send.AppWithResultPublisher(publisher, "test"),
+			)
+
+			result, err := app.Send(context.Background(), send.EventData{
+				Sender:  "no-reply@example.com",
+				Subject: "test",
+				To:      send.MessageTo{"customer@gmail.com"},
+				Body:    "hello",
+			})
+			if err != nil {
+				t.Fatalf("case: \"%s\", unexpected error: %v", ttCopy.name, err)
+			}
+			if result.Status != ttCopy.expectedStatus {
+				t.Errorf("case: \"%s\", expected status %s, got %s", ttCopy.name, ttCopy.expectedStatus, result.Status)
+			}
+
+			events := sendLog.Events()
+			if ttCopy.expectedRecipient == "" {
+				if len(events) != 0 || len(publisher.events) != 0 {
+					t.Errorf("case: \"%s\", expected nothing to be recorded, got %+v and %d result events", ttCopy.name, events, len(publisher.events))
+				}
+				return
+			}
+			if len(events) != 1 || events[0].Recipient != ttCopy.expectedRecipient {
+				t.Errorf("case: \"%s\", expected %s to be recorded, got %+v", ttCopy.name, ttCopy.expectedRecipient, events)
+			}
+			var sendResult send.SendResult
+			if len(publisher.events) != 1 || publisher.events[0].DataAs(&sendResult) != nil || !reflect.DeepEqual(sendResult.To, []string{ttCopy.expectedRecipient}) {
+				t.Errorf("case: \"%s\", expected a result event to %s, got %+v", ttCopy.name, ttCopy.expectedRecipient, publisher.events)
+			}
+		})
+	}
+}
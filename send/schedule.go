@@ -0,0 +1,209 @@
+package send
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// scheduleThreshold is how far in the future [EventData.SendAt] has to be before an email is scheduled rather than
+	// sent immediately.
+	scheduleThreshold = 5 * time.Second
+	// maxScheduleAttempts is how many times a due scheduled email is attempted before it is given up on.
+	maxScheduleAttempts = 3
+)
+
+// ErrScheduledEmailNotFound is returned by a [ScheduleStore] when there is no scheduled email with the key.
+var ErrScheduledEmailNotFound = errors.New("scheduled email not found")
+
+// errNoScheduleStore is returned when scheduling functionality is used without [AppWithScheduleStore].
+var errNoScheduleStore = errors.New("no schedule store is configured")
+
+// ScheduledEmail is an email saved to a [ScheduleStore] to be sent at a later time.
+type ScheduledEmail struct {
+	// Key is the [EventData.IdempotencyKey] or CloudEvent ID, scheduling an email with the same key replaces it.
+	Key    string    `json:"key"`
+	SendAt time.Time `json:"sendAt"`
+	// EventID is the id of the CloudEvent which requested the email.
+	EventID string `json:"eventId,omitempty"`
+	// EventData has already been validated and its template version resolved.
+	EventData EventData `json:"eventData"`
+	// DataSchema is the CloudEvent dataschema attribute used to validate the data of each [EventData.Recipients].
+	DataSchema string `json:"dataSchema,omitempty"`
+	// TemplateVersion is the resolved version of [EventData.Template], if it was versioned.
+	TemplateVersion string `json:"templateVersion,omitempty"`
+	// Attempts is how many times sending the email has failed.
+	Attempts int `json:"attempts"`
+}
+
+// ScheduleStore persists emails until they are due to be sent. Implementations must be safe for concurrent use.
+type ScheduleStore interface {
+	// Save adds a scheduled email, replacing any scheduled email with the same key.
+	Save(ctx context.Context, email ScheduledEmail) error
+	// Due returns every scheduled email with a send time at or before now, earliest first.
+	Due(ctx context.Context, now time.Time) ([]ScheduledEmail, error)
+	// Delete removes a scheduled email, [ErrScheduledEmailNotFound] is returned when it does not exist.
+	Delete(ctx context.Context, key string) error
+}
+
+// ScheduleError represents an error that occurs when an email with [EventData.SendAt] can not be scheduled.
+type ScheduleError struct {
+	key string
+	err error
+}
+
+func (scheduleError ScheduleError) Error() string {
+	return fmt.Sprintf("failed to schedule email %s - %v", scheduleError.key, scheduleError.err)
+}
+
+func (scheduleError ScheduleError) Unwrap() error {
+	return scheduleError.err
+}
+
+// scheduleKey is the key a scheduled email is saved with, the [EventData.IdempotencyKey] or the event id.
+func scheduleKey(eventID string, eventData EventData) string {
+	if eventData.IdempotencyKey != "" {
+		return eventData.IdempotencyKey
+	}
+	return eventID
+}
+
+// scheduleEmail saves the email to the [ScheduleStore] when [EventData.SendAt] is far enough in the future and reports
+// whether it was scheduled. Without a store the email is left to the [ScheduledSender] to schedule with the email
+// provider and an error is returned when the sender can not.
+func scheduleEmail(ctx context.Context, app *App, eventID string, eventData EventData, dataSchema string, version string) (bool, error) {
+	if eventData.SendAt == nil || time.Until(*eventData.SendAt) <= scheduleThreshold {
+		return false, nil
+	}
+	key := scheduleKey(eventID, eventData)
+
+	if app.scheduleStore == nil {
+		if err := checkNativeSchedule(app, eventData); err != nil {
+			err = sendError{class: ErrorClassConfiguration, err: ScheduleError{key: key, err: err}}
+			app.errorLogger.Print(err)
+			return false, err
+		}
+		return false, nil
+	}
+
+	err := app.scheduleStore.Save(ctx, ScheduledEmail{
+		Key:             key,
+		SendAt:          eventData.SendAt.UTC(),
+		EventID:         eventID,
+		EventData:       eventData,
+		DataSchema:      dataSchema,
+		TemplateVersion: version,
+	})
+	if err != nil {
+		err = sendError{class: ErrorClassStorage, err: ScheduleError{key: key, err: err}}
+		app.errorLogger.Print(err)
+		return false, err
+	}
+	app.infoLogger.Printf(
+		"email scheduled: key: %s, send at: %s, sender: %s, subject: %s, template: %s, version: %s\n",
+		key,
+		eventData.SendAt.UTC().Format(time.RFC3339),
+		eventData.Sender,
+		eventData.Subject,
+		eventData.Template,
+		version,
+	)
+
+	return true, nil
+}
+
+// checkNativeSchedule returns an error unless the [Sender] for the email can schedule it with the email provider.
+func checkNativeSchedule(app *App, eventData EventData) error {
+	sender, err := domainSender(app, eventData.Sender)
+	if err != nil {
+		return err
+	}
+	scheduledSender, ok := sender.(ScheduledSender)
+	if !ok {
+		return errors.New("\"sendAt\" requires a schedule store or a sender which supports scheduling")
+	}
+	if time.Until(*eventData.SendAt) > scheduledSender.MaxScheduleDelay() {
+		return fmt.Errorf(
+			"\"sendAt\" is more than %s in the future, which requires a schedule store",
+			scheduledSender.MaxScheduleDelay(),
+		)
+	}
+
+	return nil
+}
+
+// CancelScheduledEmail removes an email from the [ScheduleStore] configured with [AppWithScheduleStore] so it is
+// never sent. The key is the [EventData.IdempotencyKey] or, when there was none, the CloudEvent ID.
+// [ErrScheduledEmailNotFound] is returned when the email is not scheduled, including when it was already sent.
+//
+// Emails scheduled with the email provider through a [ScheduledSender] can not be canceled.
+func CancelScheduledEmail(ctx context.Context, app *App, key string) error {
+	if app.scheduleStore == nil {
+		return errNoScheduleStore
+	}
+
+	if err := app.scheduleStore.Delete(ctx, key); err != nil {
+		return err
+	}
+	app.infoLogger.Printf("scheduled email canceled: key: %s\n", key)
+	return nil
+}
+
+// DispatchScheduledEmails sends every email in the [ScheduleStore] configured with [AppWithScheduleStore] which is
+// due. A sent email is removed from the store, an email which fails to send is attempted again on the next dispatch
+// up to 3 times.
+//
+// Emails are sent at least once. Running more than one dispatcher against the same store at the same time, or a
+// failure to remove a sent email, can send the same email twice.
+func DispatchScheduledEmails(ctx context.Context, app *App) error {
+	if app.scheduleStore == nil {
+		return errNoScheduleStore
+	}
+
+	due, err := app.scheduleStore.Due(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	for _, email := range due {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		_, sendErr := deliver(ctx, app, email.EventID, email.EventData, email.DataSchema, email.TemplateVersion)
+		if sendErr != nil {
+			email.Attempts++
+			if email.Attempts < maxScheduleAttempts {
+				if err := app.scheduleStore.Save(ctx, email); err != nil {
+					app.errorLogger.Printf("failed to save scheduled email %s - %v", email.Key, err)
+				}
+				continue
+			}
+			app.errorLogger.Printf("giving up on scheduled email %s after %d attempts - %v", email.Key, email.Attempts, sendErr)
+		}
+
+		if err := app.scheduleStore.Delete(ctx, email.Key); err != nil && !errors.Is(err, ErrScheduledEmailNotFound) {
+			app.errorLogger.Printf("failed to remove scheduled email %s - %v", email.Key, err)
+		}
+	}
+
+	return nil
+}
+
+// RunScheduleDispatcher calls [DispatchScheduledEmails] every interval until the context is done.
+func RunScheduleDispatcher(ctx context.Context, app *App, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := DispatchScheduledEmails(ctx, app); err != nil && ctx.Err() == nil {
+			app.errorLogger.Printf("failed to dispatch scheduled emails - %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package send
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryScheduleStore is a [ScheduleStore] which keeps scheduled emails in memory, scheduled emails are lost when the
+// process exits so it is only suitable for testing or long-running single instance deployments.
+type MemoryScheduleStore struct {
+	mu     sync.Mutex
+	emails map[string]ScheduledEmail
+}
+
+// NewMemoryScheduleStore constructs a [MemoryScheduleStore].
+func NewMemoryScheduleStore() *MemoryScheduleStore {
+	return &MemoryScheduleStore{emails: make(map[string]ScheduledEmail)}
+}
+
+func (store *MemoryScheduleStore) Save(ctx context.Context, email ScheduledEmail) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.emails[email.Key] = email
+	return nil
+}
+
+func (store *MemoryScheduleStore) Due(ctx context.Context, now time.Time) ([]ScheduledEmail, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	var due []ScheduledEmail
+	for _, email := range store.emails {
+		if !email.SendAt.After(now) {
+			due = append(due, email)
+		}
+	}
+	sortScheduledEmails(due)
+	return due, nil
+}
+
+func (store *MemoryScheduleStore) Delete(ctx context.Context, key string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, ok := store.emails[key]; !ok {
+		return ErrScheduledEmailNotFound
+	}
+	delete(store.emails, key)
+	return nil
+}
+
+// BlobScheduleStore is a [ScheduleStore] which keeps each scheduled email as a JSON file in a [blob.Bucket] under a
+// prefix i.e. "scheduled/". Every file is read to find the due emails, so it suits a modest number of scheduled
+// emails.
+//
+// [blob.Bucket]: https://gocloud.dev/howto/blob/
+type BlobScheduleStore struct {
+	bucket *blob.Bucket
+	prefix string
+}
+
+// NewBlobScheduleStore constructs a [BlobScheduleStore].
+func NewBlobScheduleStore(bucket *blob.Bucket, prefix string) BlobScheduleStore {
+	return BlobScheduleStore{bucket: bucket, prefix: prefix}
+}
+
+func (store BlobScheduleStore) Save(ctx context.Context, email ScheduledEmail) error {
+	contents, err := json.Marshal(email)
+	if err != nil {
+		return err
+	}
+
+	return store.bucket.WriteAll(ctx, store.fileName(email.Key), contents, &blob.WriterOptions{
+		ContentType: "application/json",
+	})
+}
+
+func (store BlobScheduleStore) Due(ctx context.Context, now time.Time) ([]ScheduledEmail, error) {
+	var due []ScheduledEmail
+	iter := store.bucket.List(&blob.ListOptions{Prefix: store.prefix})
+	for {
+		obj, err := iter.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if obj.IsDir || !strings.HasSuffix(obj.Key, ".json") {
+			continue
+		}
+
+		contents, err := store.bucket.ReadAll(ctx, obj.Key)
+		// The email may have been sent or canceled since it was listed.
+		if gcerrors.Code(err) == gcerrors.NotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var email ScheduledEmail
+		if err := json.Unmarshal(contents, &email); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal scheduled email %s - %v", obj.Key, err)
+		}
+		if !email.SendAt.After(now) {
+			due = append(due, email)
+		}
+	}
+
+	sortScheduledEmails(due)
+	return due, nil
+}
+
+func (store BlobScheduleStore) Delete(ctx context.Context, key string) error {
+	err := store.bucket.Delete(ctx, store.fileName(key))
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return ErrScheduledEmailNotFound
+	}
+	return err
+}
+
+// fileName escapes the key so keys containing "/" do not create directories.
+func (store BlobScheduleStore) fileName(key string) string {
+	return store.prefix + url.PathEscape(key) + ".json"
+}
+
+// SQLPlaceholder formats the nth, starting at 1, query parameter placeholder for a SQL database.
+type SQLPlaceholder func(n int) string
+
+// QuestionPlaceholder formats placeholders as "?", used by MySQL and SQLite.
+func QuestionPlaceholder(n int) string {
+	return "?"
+}
+
+// DollarPlaceholder formats placeholders as "$1", used by PostgreSQL.
+func DollarPlaceholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+// SQLScheduleStore is a [ScheduleStore] which keeps scheduled emails in a SQL database table. The table must already
+// exist with the following columns:
+//
+//	CREATE TABLE scheduled_emails (
+//	    id      VARCHAR(255) PRIMARY KEY,
+//	    send_at TIMESTAMP    NOT NULL,
+//	    email   TEXT         NOT NULL
+//	);
+//	CREATE INDEX scheduled_emails_send_at ON scheduled_emails (send_at);
+type SQLScheduleStore struct {
+	db          *sql.DB
+	table       string
+	placeholder SQLPlaceholder
+}
+
+// NewSQLScheduleStore constructs a [SQLScheduleStore] using the table, the placeholder should match the database
+// driver i.e. [DollarPlaceholder] for PostgreSQL.
+func NewSQLScheduleStore(db *sql.DB, table string, placeholder SQLPlaceholder) SQLScheduleStore {
+	return SQLScheduleStore{db: db, table: table, placeholder: placeholder}
+}
+
+func (store SQLScheduleStore) Save(ctx context.Context, email ScheduledEmail) error {
+	contents, err := json.Marshal(email)
+	if err != nil {
+		return err
+	}
+
+	// Deleting and inserting in a transaction is used instead of an upsert because upsert syntax differs between
+	// databases.
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	deleteQuery := fmt.Sprintf("DELETE FROM %s WHERE id = %s", store.table, store.placeholder(1))
+	if _, err := tx.ExecContext(ctx, deleteQuery, email.Key); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	insertQuery := fmt.Sprintf(
+		"INSERT INTO %s (id, send_at, email) VALUES (%s, %s, %s)",
+		store.table,
+		store.placeholder(1),
+		store.placeholder(2),
+		store.placeholder(3),
+	)
+	if _, err := tx.ExecContext(ctx, insertQuery, email.Key, email.SendAt.UTC(), string(contents)); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (store SQLScheduleStore) Due(ctx context.Context, now time.Time) ([]ScheduledEmail, error) {
+	query := fmt.Sprintf(
+		"SELECT email FROM %s WHERE send_at <= %s ORDER BY send_at",
+		store.table,
+		store.placeholder(1),
+	)
+	rows, err := store.db.QueryContext(ctx, query, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var due []ScheduledEmail
+	for rows.Next() {
+		var contents string
+		if err := rows.Scan(&contents); err != nil {
+			return nil, err
+		}
+		var email ScheduledEmail
+		if err := json.Unmarshal([]byte(contents), &email); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal scheduled email - %v", err)
+		}
+		due = append(due, email)
+	}
+
+	return due, rows.Err()
+}
+
+func (store SQLScheduleStore) Delete(ctx context.Context, key string) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = %s", store.table, store.placeholder(1))
+	result, err := store.db.ExecContext(ctx, query, key)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrScheduledEmailNotFound
+	}
+	return nil
+}
+
+// sortScheduledEmails sorts scheduled emails earliest first.
+func sortScheduledEmails(emails []ScheduledEmail) {
+	sort.Slice(emails, func(i, j int) bool {
+		return emails[i].SendAt.Before(emails[j].SendAt)
+	})
+}
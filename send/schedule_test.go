@@ -0,0 +1,155 @@
+package send_test
+
+import (
+	"context"
+	"errors"
+	"github.com/itmayziii/email/send"
+	"gocloud.dev/blob/memblob"
+	"testing"
+	"time"
+)
+
+func TestScheduleStores(t *testing.T) {
+	bucket := memblob.OpenBucket(nil)
+	t.Cleanup(func() { _ = bucket.Close() })
+	stores := map[string]send.ScheduleStore{
+		"memory": send.NewMemoryScheduleStore(),
+		"blob":   send.NewBlobScheduleStore(bucket, "scheduled/"),
+	}
+
+	for name, store := range stores {
+		storeCopy := store
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			now := time.Now().UTC().Truncate(time.Second)
+			emails := []send.ScheduledEmail{
+				{Key: "later", SendAt: now.Add(time.Hour)},
+				{Key: "a/b", SendAt: now.Add(-time.Minute), EventData: send.EventData{To: send.MessageTo{"tom@example.com"}}},
+				{Key: "first", SendAt: now.Add(-time.Hour)},
+			}
+			for _, email := range emails {
+				if err := storeCopy.Save(ctx, email); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			due, err := storeCopy.Due(ctx, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(due) != 2 || due[0].Key != "first" || due[1].Key != "a/b" || due[1].EventData.To[0] != "tom@example.com" {
+				t.Errorf("expected \"first\" then \"a/b\" to be due, got %+v", due)
+			}
+
+			if err := storeCopy.Delete(ctx, "a/b"); err != nil {
+				t.Fatal(err)
+			}
+			if err := storeCopy.Delete(ctx, "a/b"); !errors.Is(err, send.ErrScheduledEmailNotFound) {
+				t.Errorf("expected ErrScheduledEmailNotFound but got %v", err)
+			}
+		})
+	}
+}
+
+func TestEmailEvent_SchedulesSendAt(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	sender := &recordingSender{}
+	store := send.NewMemoryScheduleStore()
+	app := send.NewApp(send.AppWithDomainSender("example.com", sender), send.AppWithScheduleStore(store))
+
+	for _, key := range []string{"welcome-tom", "welcome-jane"} {
+		err := send.EmailEvent(app)(ctx, newEvent(t, map[string]interface{}{
+			"sender":         "no-reply@example.com",
+			"subject":        "test",
+			"to":             "tom@example.com",
+			"body":           "<p>{{ .Name }}</p>",
+			"data":           map[string]interface{}{"name": "Tommy"},
+			"sendAt":         time.Now().Add(time.Hour).Format(time.RFC3339),
+			"idempotencyKey": key,
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if len(sender.messages) != 0 {
+		t.Fatalf("expected scheduled emails not to be sent, got %d", len(sender.messages))
+	}
+
+	if err := send.CancelScheduledEmail(ctx, app, "welcome-jane"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Make the remaining email due.
+	scheduled, err := store.Due(ctx, time.Now().Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scheduled) != 1 || scheduled[0].Key != "welcome-tom" {
+		t.Fatalf("expected only \"welcome-tom\" to be scheduled, got %+v", scheduled)
+	}
+	scheduled[0].SendAt = time.Now()
+	if err := store.Save(ctx, scheduled[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := send.DispatchScheduledEmails(ctx, app); err != nil {
+		t.Fatal(err)
+	}
+	if len(sender.messages) != 1 || sender.messages[0].Body != "<p>Tommy</p>" {
+		t.Fatalf("expected the scheduled email to be sent, got %+v", sender.messages)
+	}
+	if err := send.CancelScheduledEmail(ctx, app, "welcome-tom"); !errors.Is(err, send.ErrScheduledEmailNotFound) {
+		t.Errorf("expected sent email to be removed from the store, got %v", err)
+	}
+}
+
+// schedulingSender implements [send.ScheduledSender].
+type schedulingSender struct {
+	recordingSender
+}
+
+func (ss *schedulingSender) MaxScheduleDelay() time.Duration {
+	return 24 * time.Hour
+}
+
+func TestEmailEvent_SchedulesWithProvider(t *testing.T) {
+	tests := []struct {
+		name        string
+		sender      send.Sender
+		sendAt      time.Time
+		expectError bool
+	}{
+		{"provider scheduling", &schedulingSender{}, time.Now().Add(time.Hour), false},
+		{"beyond provider limit", &schedulingSender{}, time.Now().Add(48 * time.Hour), true},
+		{"no provider scheduling", &recordingSender{}, time.Now().Add(time.Hour), true},
+	}
+
+	for _, tt := range tests {
+		ttCopy := tt
+		t.Run(ttCopy.name, func(t *testing.T) {
+			t.Parallel()
+			app := send.NewApp(send.AppWithDomainSender("example.com", ttCopy.sender))
+			err := send.EmailEvent(app)(context.Background(), newEvent(t, map[string]interface{}{
+				"sender":  "no-reply@example.com",
+				"subject": "test",
+				"to":      "tom@example.com",
+				"body":    "hello",
+				"sendAt":  ttCopy.sendAt.Format(time.RFC3339),
+			}))
+			var scheduleError send.ScheduleError
+			if ttCopy.expectError != errors.As(err, &scheduleError) {
+				t.Fatalf("case: \"%s\", expected ScheduleError: %t but got %v", ttCopy.name, ttCopy.expectError, err)
+			}
+			if ttCopy.expectError {
+				return
+			}
+
+			messages := ttCopy.sender.(*schedulingSender).messages
+			if len(messages) != 1 || !messages[0].SendAt.Equal(ttCopy.sendAt.Truncate(time.Second)) {
+				t.Errorf("expected message with SendAt %s, got %+v", ttCopy.sendAt, messages)
+			}
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package send
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"gocloud.dev/gcerrors"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// frontMatterDelimiter starts and ends the YAML front matter at the top of a template.
+const frontMatterDelimiter = "---"
+
+// schemaSuffix is appended to a template name, without its extension, to find the template's sidecar JSON Schema
+// i.e. emails/welcome.html -> emails/welcome.schema.json.
+const schemaSuffix = ".schema.json"
+
+// frontMatter is the YAML found at the top of a template between "---" lines.
+type frontMatter struct {
+	// Schema is either a JSON Schema describing the template data or a path to one in file storage.
+	Schema interface{} `yaml:"schema"`
+}
+
+// SchemaViolation is a single way the template data does not satisfy the template's JSON Schema.
+type SchemaViolation struct {
+	// Path is the JSON path to the invalid value within [EventData.Data] i.e. $.items[0].price.
+	Path string `json:"path"`
+	// Message describes what is wrong with the value.
+	Message string `json:"message"`
+}
+
+// SchemaValidationError represents an error that occurs when [EventData.Data] does not satisfy the template's JSON
+// Schema. All the violations are reported at once.
+type SchemaValidationError struct {
+	// Schema is where the schema was found.
+	Schema     string
+	Violations []SchemaViolation
+}
+
+func (schemaValidationError SchemaValidationError) Error() string {
+	violations := make([]string, len(schemaValidationError.Violations))
+	for i, v := range schemaValidationError.Violations {
+		violations[i] = fmt.Sprintf("%s: %s", v.Path, v.Message)
+	}
+
+	return fmt.Sprintf(
+		"\"data\" does not match schema %s - %s",
+		schemaValidationError.Schema,
+		strings.Join(violations, ", "),
+	)
+}
+
+// splitFrontMatter separates YAML front matter from the rest of the template. Templates without front matter return
+// an empty front matter and the template unchanged.
+func splitFrontMatter(template string) (string, string) {
+	normalized := strings.ReplaceAll(template, "\r\n", "\n")
+	if !strings.HasPrefix(normalized, frontMatterDelimiter+"\n") {
+		return "", template
+	}
+
+	rest := normalized[len(frontMatterDelimiter)+1:]
+	end := strings.Index(rest, "\n"+frontMatterDelimiter+"\n")
+	if end == -1 {
+		if !strings.HasSuffix(rest, "\n"+frontMatterDelimiter) {
+			return "", template
+		}
+		return rest[:len(rest)-len(frontMatterDelimiter)-1], ""
+	}
+
+	return rest[:end], rest[end+len(frontMatterDelimiter)+2:]
+}
+
+// defaultSchemaTimeout is how long fetching a remote JSON Schema may take unless configured with
+// [AppWithSchemaHTTPClient].
+const defaultSchemaTimeout = 10 * time.Second
+
+// validateTemplateData validates [EventData.Data] against a JSON Schema when one is declared. The schema is found,
+// in order of priority, from the CloudEvent dataschema attribute, the "schema" key in the template front matter, or
+// a sidecar *.schema.json file next to the template. Events without a schema are not validated.
+func validateTemplateData(ctx context.Context, app *App, eventData EventData, dataSchema string) error {
+	location, schema, err := findSchema(ctx, app, eventData, dataSchema)
+	if err != nil {
+		return err
+	}
+
+	return validateSchema(location, schema, eventData.Data)
+}
+
+// validateSchema validates the template data against a schema found with [findSchema], the data is not validated
+// when the schema is nil.
+func validateSchema(location string, schema *jsonschema.Schema, templateData map[string]interface{}) error {
+	if schema == nil {
+		return nil
+	}
+
+	// The data is round tripped through JSON because the validator only understands JSON types, i.e. an int provided
+	// by a Go caller rather than decoded from JSON would not be considered a number.
+	if templateData == nil {
+		templateData = map[string]interface{}{}
+	}
+	rawData, err := json.Marshal(templateData)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(rawData))
+	decoder.UseNumber()
+	var data interface{}
+	if err := decoder.Decode(&data); err != nil {
+		return err
+	}
+
+	err = schema.Validate(data)
+	var validationError *jsonschema.ValidationError
+	if errors.As(err, &validationError) {
+		return SchemaValidationError{Schema: location, Violations: schemaViolations(validationError)}
+	}
+
+	return err
+}
+
+// findSchema returns the location and compiled JSON Schema for the event or a nil schema if there isn't one. A
+// dataschema which can not be resolved, i.e. a URN or a URL on a host which is not allowed with [AppWithSchemaHosts],
+// is only an identifier and the template's schema is used instead.
+func findSchema(ctx context.Context, app *App, eventData EventData, dataSchema string) (string, *jsonschema.Schema, error) {
+	if dataSchema != "" {
+		schema, err := loadSchema(ctx, app, dataSchema)
+		if !errors.Is(err, errSchemaNotFound) && !errors.Is(err, errSchemaHostNotAllowed) {
+			return dataSchema, schema, err
+		}
+	}
+	if eventData.Template == "" || eventData.Body != "" || eventData.BodyMarkdown != "" {
+		return "", nil, nil
+	}
+
+	template, err := readTemplate(ctx, app, eventData.Template)
+	if err != nil {
+		return "", nil, err
+	}
+	rawFrontMatter, _ := splitFrontMatter(template)
+	var matter frontMatter
+	if err := yaml.Unmarshal([]byte(rawFrontMatter), &matter); err != nil {
+		return "", nil, fmt.Errorf("invalid front matter in template %s - %v", eventData.Template, err)
+	}
+	switch s := matter.Schema.(type) {
+	case string:
+		location := path.Join(path.Dir(eventData.Template), s)
+		schema, err := loadSchema(ctx, app, location)
+		return location, schema, err
+	case map[string]interface{}:
+		rawSchema, err := json.Marshal(s)
+		if err != nil {
+			return "", nil, err
+		}
+		schema, err := app.schemas.compile(eventData.Template, rawSchema)
+		return eventData.Template, schema, err
+	}
+
+	location := strings.TrimSuffix(eventData.Template, path.Ext(eventData.Template)) + schemaSuffix
+	schema, err := loadSchema(ctx, app, location)
+	if errors.Is(err, errSchemaNotFound) {
+		return "", nil, nil
+	}
+	return location, schema, err
+}
+
+var (
+	// errSchemaNotFound is returned by [loadSchema] when the schema does not exist in file storage.
+	errSchemaNotFound = errors.New("schema not found")
+	// errSchemaHostNotAllowed is returned by [loadSchema] for a URL on a host which is not allowed with
+	// [AppWithSchemaHosts].
+	errSchemaHostNotAllowed = errors.New("schema host is not allowed")
+)
+
+// loadSchema returns the compiled JSON Schema at an http(s) URL or in file storage. Remote schemas are only fetched
+// from the hosts allowed with [AppWithSchemaHosts] and are fetched once, schemas in file storage are read every time
+// so edits take effect, but are only compiled again when they change.
+func loadSchema(ctx context.Context, app *App, location string) (*jsonschema.Schema, error) {
+	u, err := url.Parse(location)
+	if err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		if !app.schemaHosts[strings.ToLower(u.Hostname())] {
+			return nil, fmt.Errorf("%w: %s", errSchemaHostNotAllowed, location)
+		}
+		if schema, ok := app.schemas.load(location); ok {
+			return schema, nil
+		}
+		rawSchema, err := fetchSchema(ctx, app, location)
+		if err != nil {
+			return nil, err
+		}
+		return app.schemas.compile(location, rawSchema)
+	}
+
+	rawSchema, err := readFile(ctx, app.fileStorage, strings.TrimPrefix(location, "/"))
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return nil, fmt.Errorf("%w: %s", errSchemaNotFound, location)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema %s - %v", location, err)
+	}
+
+	return app.schemas.compile(location, rawSchema)
+}
+
+// fetchSchema downloads a JSON Schema over HTTP with the client configured with [AppWithSchemaHTTPClient].
+func fetchSchema(ctx context.Context, app *App, location string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := app.schemaClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch schema %s - %v", location, err)
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch schema %s - status %d", location, res.StatusCode)
+	}
+
+	return io.ReadAll(res.Body)
+}
+
+// schemaCache keeps compiled JSON Schemas so they are not compiled for every event, it is safe for concurrent use.
+type schemaCache struct {
+	mu      sync.RWMutex
+	schemas map[string]*jsonschema.Schema
+}
+
+func newSchemaCache() *schemaCache {
+	return &schemaCache{schemas: make(map[string]*jsonschema.Schema)}
+}
+
+// load returns the schema last compiled for the location.
+func (cache *schemaCache) load(location string) (*jsonschema.Schema, bool) {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+	schema, ok := cache.schemas[location]
+	return schema, ok
+}
+
+// compile compiles the schema found at the location, a schema which was already compiled for the location with the
+// same contents is reused.
+func (cache *schemaCache) compile(location string, rawSchema []byte) (*jsonschema.Schema, error) {
+	hash := sha256.Sum256(rawSchema)
+	key := location + "#" + hex.EncodeToString(hash[:])
+	cache.mu.RLock()
+	schema, ok := cache.schemas[key]
+	cache.mu.RUnlock()
+	if ok {
+		return schema, nil
+	}
+
+	// The schema is registered under a URL the compiler will never try to load itself.
+	resource := "mem:///" + strings.TrimPrefix(location, "/")
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(resource, bytes.NewReader(rawSchema)); err != nil {
+		return nil, fmt.Errorf("invalid schema %s - %v", location, err)
+	}
+	schema, err := compiler.Compile(resource)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema %s - %v", location, err)
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.schemas[key] = schema
+	cache.schemas[location] = schema
+	return schema, nil
+}
+
+// schemaViolations flattens the validation error tree into the leaf errors which describe what is actually wrong.
+func schemaViolations(validationError *jsonschema.ValidationError) []SchemaViolation {
+	if len(validationError.Causes) == 0 {
+		return []SchemaViolation{{
+			Path:    jsonPointerToPath(validationError.InstanceLocation),
+			Message: validationError.Message,
+		}}
+	}
+
+	var violations []SchemaViolation
+	for _, cause := range validationError.Causes {
+		violations = append(violations, schemaViolations(cause)...)
+	}
+	return violations
+}
+
+// jsonPointerToPath converts a JSON pointer i.e. /items/0/price to a JSON path i.e. $.items[0].price.
+func jsonPointerToPath(pointer string) string {
+	var b strings.Builder
+	b.WriteString("$")
+	for _, token := range strings.Split(pointer, "/")[1:] {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		if _, err := strconv.Atoi(token); err == nil {
+			b.WriteString("[" + token + "]")
+			continue
+		}
+		b.WriteString("." + token)
+	}
+
+	return b.String()
+}
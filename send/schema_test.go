@@ -0,0 +1,220 @@
+package send_test
+
+import (
+	"context"
+	"errors"
+	"github.com/itmayziii/email/send"
+	"gocloud.dev/blob/memblob"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+const productSchema = `{
+	"type": "object",
+	"required": ["name", "items"],
+	"properties": {
+		"name": {"type": "string"},
+		"items": {"type": "array", "items": {"type": "object", "properties": {"price": {"type": "number"}}}}
+	}
+}`
+
+func TestEmailEvent_ValidatesDataAgainstSchema(t *testing.T) {
+	tests := []struct {
+		name       string
+		template   string
+		dataSchema string
+		data       map[string]interface{}
+		expected   []send.SchemaViolation
+	}{
+		{
+			"sidecar schema",
+			"emails/sidecar.html",
+			"",
+			map[string]interface{}{"items": []interface{}{map[string]interface{}{"price": "free"}}},
+			[]send.SchemaViolation{
+				{Path: "$", Message: "missing properties: 'name'"},
+				{Path: "$.items[0].price", Message: "expected number, but got string"},
+			},
+		},
+		{
+			"front matter schema",
+			"emails/front-matter.html",
+			"",
+			map[string]interface{}{"name": 7},
+			[]send.SchemaViolation{{Path: "$.name", Message: "expected string, but got number"}},
+		},
+		{
+			"front matter schema path",
+			"emails/front-matter-path.html",
+			"",
+			map[string]interface{}{"name": "Tommy"},
+			[]send.SchemaViolation{{Path: "$", Message: "missing properties: 'items'"}},
+		},
+		{
+			"dataschema attribute",
+			"emails/none.html",
+			"schemas/product.json",
+			map[string]interface{}{"name": "Tommy"},
+			[]send.SchemaViolation{{Path: "$", Message: "missing properties: 'items'"}},
+		},
+		{
+			"unresolvable dataschema falls back to the template schema",
+			"emails/sidecar.html",
+			"urn:example:product",
+			map[string]interface{}{"name": "Tommy"},
+			[]send.SchemaViolation{{Path: "$", Message: "missing properties: 'items'"}},
+		},
+		{"no schema", "emails/none.html", "", map[string]interface{}{"name": 7}, nil},
+		{"valid", "emails/sidecar.html", "", map[string]interface{}{"name": "Tommy", "items": []interface{}{}}, nil},
+	}
+
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	t.Cleanup(func() { _ = bucket.Close() })
+	files := map[string]string{
+		"emails/sidecar.html":           "<p>{{ .Name }}</p>",
+		"emails/sidecar.schema.json":    productSchema,
+		"emails/front-matter.html":      "---\nschema:\n  type: object\n  properties:\n    name:\n      type: string\n---\n<p>{{ .Name }}</p>",
+		"emails/front-matter-path.html": "---\nschema: ../schemas/product.json\n---\n<p>{{ .Name }}</p>",
+		"emails/none.html":              "<p>{{ .Name }}</p>",
+		"schemas/product.json":          productSchema,
+	}
+	for name, contents := range files {
+		if err := bucket.WriteAll(ctx, name, []byte(contents), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range tests {
+		ttCopy := tt
+		t.Run(ttCopy.name, func(t *testing.T) {
+			t.Parallel()
+			sender := &recordingSender{}
+			app := send.NewApp(send.AppWithFileStorage(bucket), send.AppWithDomainSender("example.com", sender))
+
+			event := newEvent(t, map[string]interface{}{
+				"sender":   "no-reply@example.com",
+				"subject":  "test",
+				"to":       "tom@example.com",
+				"template": ttCopy.template,
+				"data":     ttCopy.data,
+			})
+			if ttCopy.dataSchema != "" {
+				event.SetDataSchema(ttCopy.dataSchema)
+			}
+			err := send.EmailEvent(app)(ctx, event)
+
+			if ttCopy.expected == nil {
+				if err != nil {
+					t.Errorf("case: \"%s\", unexpected error: %v", ttCopy.name, err)
+				}
+				return
+			}
+			var schemaValidationError send.SchemaValidationError
+			if !errors.As(err, &schemaValidationError) {
+				t.Fatalf("expected SchemaValidationError but got %v", err)
+			}
+			if !reflect.DeepEqual(schemaValidationError.Violations, ttCopy.expected) {
+				t.Errorf("expected %v to match %v", schemaValidationError.Violations, ttCopy.expected)
+			}
+			if len(sender.messages) != 0 {
+				t.Errorf("expected no email to be sent")
+			}
+		})
+	}
+}
+
+func TestEmailEvent_StripsFrontMatter(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	t.Cleanup(func() { _ = bucket.Close() })
+	template := "---\nschema:\n  type: object\n---\n<p>{{ .Name }}</p>"
+	if err := bucket.WriteAll(ctx, "welcome.html", []byte(template), nil); err != nil {
+		t.Fatal(err)
+	}
+	sender := &recordingSender{}
+	app := send.NewApp(send.AppWithFileStorage(bucket), send.AppWithDomainSender("example.com", sender))
+
+	err := send.EmailEvent(app)(ctx, newEvent(t, map[string]interface{}{
+		"sender":   "no-reply@example.com",
+		"subject":  "test",
+		"to":       "tom@example.com",
+		"template": "welcome.html",
+		"data":     map[string]interface{}{"name": "Tommy"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sender.messages[0].Body != "<p>Tommy</p>" {
+		t.Errorf("expected %q to match %q", sender.messages[0].Body, "<p>Tommy</p>")
+	}
+}
+
+func TestEmailEvent_RemoteDataSchema(t *testing.T) {
+	var mu sync.Mutex
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fetches++
+		_, _ = w.Write([]byte(productSchema))
+	}))
+	t.Cleanup(server.Close)
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		hosts           []string
+		dataSchema      string
+		expectedFetches int
+		expectInvalid   bool
+	}{
+		{"allowed host is fetched once", []string{serverURL.Hostname()}, server.URL + "/product.json", 1, true},
+		{"other hosts are an identifier", []string{"schemas.example.com"}, server.URL + "/product.json", 0, false},
+		{"urn is an identifier", nil, "urn:example:product:v1", 0, false},
+	}
+
+	for _, tt := range tests {
+		ttCopy := tt
+		t.Run(ttCopy.name, func(t *testing.T) {
+			mu.Lock()
+			fetches = 0
+			mu.Unlock()
+			app := send.NewApp(send.AppWithDomainSender("example.com", &recordingSender{}), send.AppWithSchemaHosts(ttCopy.hosts...))
+
+			for i := 0; i < 2; i++ {
+				event := newEvent(t, map[string]interface{}{
+					"sender":  "no-reply@example.com",
+					"subject": "test",
+					"to":      "tom@example.com",
+					"body":    "<p>{{ .Name }}</p>",
+					"data":    map[string]interface{}{"name": "Tommy"},
+				})
+				event.SetDataSchema(ttCopy.dataSchema)
+				err := send.EmailEvent(app)(context.Background(), event)
+
+				var schemaValidationError send.SchemaValidationError
+				if ttCopy.expectInvalid != errors.As(err, &schemaValidationError) {
+					t.Errorf("case: \"%s\", expected invalid data to be %t, got %v", ttCopy.name, ttCopy.expectInvalid, err)
+				}
+				if !ttCopy.expectInvalid && err != nil {
+					t.Errorf("case: \"%s\", unexpected error: %v", ttCopy.name, err)
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if fetches != ttCopy.expectedFetches {
+				t.Errorf("case: \"%s\", expected %d fetches, got %d", ttCopy.name, ttCopy.expectedFetches, fetches)
+			}
+		})
+	}
+}
@@ -1,5 +1,5 @@
 /*
-Package send exposes primitives to send emails by responding to [CloudEvents].
+Package send exposes primitives to send emails by responding to [CloudEvents], or directly from Go with [App.Send].
 
 [CloudEvents]: https://cloudevents.io/
 */
@@ -7,82 +7,371 @@ package send
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	cloudevents "github.com/cloudevents/sdk-go/v2"
 	"log"
 	"time"
 )
 
-// EmailEvent creates a function to send an email by responding to a [CloudEvent].
+// EmailEvent creates a function to send an email by responding to a [CloudEvent], it extracts the [EventData] from
+// the event and sends it the same way as [App.Send]. The email is a dry run, see [DryRun], when the App is configured
+// with [AppWithDryRun] or the event has the [DryRunExtension].
 //
 // [CloudEvent]: https://cloudevents.io/
 func EmailEvent(app *App) func(context.Context, cloudevents.Event) error {
 	return func(ctx context.Context, event cloudevents.Event) error {
-		defer func() {
-			if err := app.flusher.Flush(); err != nil {
-				// Not appropriate to rely on the info or error logger here as that is probably the thing that is being
-				// flushed and errored.
-				log.Printf("failed to flush: %v", err)
-			}
-		}()
-
-		eventData, err := extractEventData(event)
-		if err != nil {
-			app.errorLogger.Printf("failed to extract event data - %v", err)
-			return err
-		}
-		err = validateEventData(eventData)
-		if err != nil {
-			app.errorLogger.Printf("invalid event data - %v", err)
-			return err
-		}
+		defer flush(app)
 
-		emailBody, err := determineEmailBody(ctx, app, eventData)
-		if err != nil {
-			app.errorLogger.Printf("failed to determine email body %v", err)
-			return err
+		if app.dryRun || isDryRunEvent(event) {
+			ctx, _ = withDryRun(ctx)
 		}
+		return handleEmailEvent(ctx, app, event)
+	}
+}
 
-		domain, err := extractEmailDomain(eventData.Sender)
+// handleEmailEvent extracts the email from the CloudEvent and sends it the same way as [App.Send], identified by the
+// CloudEvent ID and validated against the CloudEvent dataschema, see [send].
+func handleEmailEvent(ctx context.Context, app *App, event cloudevents.Event) error {
+	eventData, err := extractEventData(app, event)
+	if err != nil {
+		app.errorLogger.Printf("failed to extract event data - %v", err)
+		err = sendError{class: ErrorClassValidation, err: err}
+		publishResult(ctx, app, event.ID(), EventData{}, "", "", err)
+		return err
+	}
+
+	_, err = send(ctx, app, event.ID(), eventData, event.DataSchema())
+	return err
+}
+
+// MessageStatus is what happened to an email which was sent without an error.
+type MessageStatus string
+
+const (
+	// MessageStatusSent means the email was accepted by the email provider.
+	MessageStatusSent MessageStatus = "sent"
+	// MessageStatusScheduled means the email was saved to the [ScheduleStore] to be sent later.
+	MessageStatusScheduled MessageStatus = "scheduled"
+	// MessageStatusSuppressed means the email was not sent because every recipient is suppressed.
+	MessageStatusSuppressed MessageStatus = "suppressed"
+	// MessageStatusDryRun means the email was rendered and routed without being sent, see [AppWithDryRun].
+	MessageStatusDryRun MessageStatus = "dry_run"
+	// MessageStatusSandboxed means the email was not sent because the [Sandbox] removed every recipient.
+	MessageStatusSandboxed MessageStatus = "sandboxed"
+)
+
+// Result is what happened to an email sent with [App.Send].
+type Result struct {
+	// ID is the id returned by the [Sender], empty unless the email was sent to [EventData.To].
+	ID     string
+	Status MessageStatus
+	// ScheduleKey is the key a scheduled email can be canceled with, see [CancelScheduledEmail].
+	ScheduleKey string
+	// Recipients are the results for every recipient of an email to [EventData.Recipients].
+	Recipients []RecipientResult
+}
+
+// Send validates, renders, and sends the email with the [Sender] registered for the sender domain, without the need
+// for a CloudEvent. Emails with an [EventData.SendAt] in the future are scheduled, suppressed recipients are removed,
+// and the result is published to the [ResultPublisher], the same as an email sent with [EmailEvent]. The
+// [EventData.IdempotencyKey] identifies the email in the [ResultPublisher] events when there is one. The email is a
+// dry run when the App is configured with [AppWithDryRun].
+//
+// Errors can be classified with [ClassifyError], an email to [EventData.Recipients] which could not be sent to
+// anyone is a [BatchSendError].
+func (app *App) Send(ctx context.Context, eventData EventData) (Result, error) {
+	defer flush(app)
+
+	if app.dryRun {
+		ctx, _ = withDryRun(ctx)
+	}
+	return send(ctx, app, "", eventData, "")
+}
+
+// Render validates and renders the email and chooses the [Sender] for it without sending it, the same as [DryRun]
+// without the need for a CloudEvent. The emails which would have been sent are returned, an email to
+// [EventData.Recipients] returns a result per recipient.
+func (app *App) Render(ctx context.Context, eventData EventData) ([]DryRunResult, error) {
+	defer flush(app)
+
+	ctx, run := withDryRun(ctx)
+	if _, err := send(ctx, app, "", eventData, ""); err != nil {
+		return nil, err
+	}
+
+	return run.results, nil
+}
+
+// send applies the [EventData.Attributes] and sends the email, see [sendEventData]. It is how every email is sent,
+// from [App.Send] and [EmailEvent] alike. The eventID identifies the request for the email i.e. the CloudEvent ID,
+// when it is empty the [EventData.IdempotencyKey], after the attributes are applied, or a random id is used instead.
+// The dataSchema is the CloudEvent dataschema, see [validateTemplateData].
+func send(ctx context.Context, app *App, eventID string, eventData EventData, dataSchema string) (Result, error) {
+	applied, err := applyAttributes(app, eventData)
+	if err != nil {
+		applied = eventData
+	}
+	if eventID == "" {
+		eventID = messageID(applied)
+	}
+	if err != nil {
+		app.errorLogger.Printf("invalid event data - %v", err)
+		err = sendError{class: ErrorClassValidation, err: err}
+		publishResult(ctx, app, eventID, eventData, "", "", err)
+		return Result{}, err
+	}
+
+	return sendEventData(ctx, app, eventID, applied, dataSchema)
+}
+
+// messageID identifies an email sent without a CloudEvent by its [EventData.IdempotencyKey] or a random id.
+func messageID(eventData EventData) string {
+	if eventData.IdempotencyKey != "" {
+		return eventData.IdempotencyKey
+	}
+	return newMessageID()
+}
+
+// sendEventData resolves the template version and validates the email, then schedules or delivers it. An email with
+// an [EventData.IdempotencyKey] which was already delivered is skipped, see [claimSend]. The eventID identifies the
+// request for the email i.e. the CloudEvent ID.
+func sendEventData(ctx context.Context, app *App, eventID string, eventData EventData, dataSchema string) (Result, error) {
+	eventData, version, err := resolveTemplateVersion(ctx, app, eventData)
+	if err != nil {
+		app.errorLogger.Printf("failed to resolve template version - %v", err)
+		err = sendError{class: ErrorClassTemplate, err: err}
+		publishResult(ctx, app, eventID, eventData, "", "", err)
+		return Result{}, err
+	}
+	err = validateEventData(ctx, app, eventData, dataSchema)
+	if err != nil {
+		app.errorLogger.Printf("invalid event data - %v", err)
+		err = sendError{class: ErrorClassValidation, err: err}
+		publishResult(ctx, app, eventID, eventData, version, "", err)
+		return Result{}, err
+	}
+
+	// A dry run renders scheduled emails immediately rather than saving them for later.
+	if dryRunFrom(ctx) == nil {
+		scheduled, err := scheduleEmail(ctx, app, eventID, eventData, dataSchema, version)
 		if err != nil {
-			app.errorLogger.Print(err)
-			return err
+			publishResult(ctx, app, eventID, eventData, version, "", err)
+			return Result{}, err
 		}
-		sender, hasDomain := app.domainSenders[domain]
-		if !hasDomain {
-			err = fmt.Errorf(
-				"domain: \"%s\" from \"sender\": \"%s\" does not match any registered domain to send emails from",
-				domain,
-				eventData.Sender,
-			)
-			app.errorLogger.Print(err)
-			return err
+		if scheduled {
+			return Result{Status: MessageStatusScheduled, ScheduleKey: scheduleKey(eventID, eventData)}, nil
 		}
+	}
 
-		ctx, cancel := context.WithTimeout(ctx, time.Second*10)
-		defer cancel()
-		id, err := sender.Send(ctx, Message{
-			Sender:  eventData.Sender,
-			Subject: eventData.Subject,
-			Body:    emailBody,
-			To:      eventData.To,
-			Cc:      eventData.Cc,
-			Bcc:     eventData.Bcc,
-		})
-		if err != nil {
-			app.errorLogger.Printf("failed to send email: %v\n", err)
-			return err
-		}
+	// A redelivered event, i.e. a Pub/Sub message with the same message id, is only sent once.
+	sent, complete, claimed, err := claimSend(ctx, app, eventData)
+	if err != nil {
+		app.errorLogger.Print(err)
+		publishResult(ctx, app, eventID, eventData, version, "", err)
+		return Result{}, err
+	}
+	if !claimed {
 		app.infoLogger.Printf(
-			"email sent: id: %s, sender: %s, subject: %s, to: %s, cc: %s, bcc: %s\n",
-			id,
+			"email skipped, already sent: idempotency key: %s, sender: %s, subject: %s, template: %s, version: %s\n",
+			eventData.IdempotencyKey,
 			eventData.Sender,
 			eventData.Subject,
-			eventData.To,
-			eventData.Cc,
-			eventData.Bcc,
+			eventData.Template,
+			version,
 		)
+		return sent, nil
+	}
+	result, err := deliver(ctx, app, eventID, eventData, dataSchema, version)
+	complete(result, err)
+	return result, err
+}
+
+// deliver sends an email which has already been validated, to every [EventData.Recipients] when there are any.
+// Suppressed addresses are removed first, which for a scheduled email happens when it is due. The eventID is the id of
+// the CloudEvent which requested the email.
+func deliver(ctx context.Context, app *App, eventID string, eventData EventData, dataSchema string, version string) (Result, error) {
+	eventData, hasRecipients, err := removeSuppressed(ctx, app, eventData)
+	if err != nil {
+		app.errorLogger.Print(err)
+		publishResult(ctx, app, eventID, eventData, version, "", err)
+		return Result{}, err
+	}
+	if !hasRecipients {
+		app.infoLogger.Printf(
+			"email skipped, every recipient is suppressed: sender: %s, subject: %s, template: %s, version: %s\n",
+			eventData.Sender,
+			eventData.Subject,
+			eventData.Template,
+			version,
+		)
+		return Result{Status: MessageStatusSuppressed}, nil
+	}
+
+	if len(eventData.Recipients) > 0 {
+		results, err := sendBatch(ctx, app, eventID, eventData, dataSchema, version)
+		if err != nil {
+			return Result{}, err
+		}
+		return Result{Status: batchStatus(ctx, results), Recipients: results}, nil
+	}
+
+	sent, err := sendMessage(ctx, app, eventData)
+	if err == nil && sent.sandboxed {
+		return Result{Status: MessageStatusSandboxed}, nil
+	}
+	eventData = sent.recipients(eventData)
+	recordSend(ctx, app, eventData, version, sent.id, err)
+	publishResult(ctx, app, eventID, eventData, version, sent.id, err)
+	if err != nil {
+		return Result{}, err
+	}
+	if dryRunFrom(ctx) != nil {
+		return Result{ID: sent.id, Status: MessageStatusDryRun}, nil
+	}
+	app.infoLogger.Printf(
+		"email sent: id: %s, sender: %s, subject: %s, to: %s, cc: %s, bcc: %s, template: %s, version: %s\n",
+		sent.id,
+		eventData.Sender,
+		eventData.Subject,
+		eventData.To,
+		eventData.Cc,
+		eventData.Bcc,
+		eventData.Template,
+		version,
+	)
+
+	return Result{ID: sent.id, Status: MessageStatusSent}, nil
+}
+
+// deliveredStatus is the status of an email which was delivered, [MessageStatusDryRun] for a dry run.
+func deliveredStatus(ctx context.Context) MessageStatus {
+	if dryRunFrom(ctx) != nil {
+		return MessageStatusDryRun
+	}
+	return MessageStatusSent
+}
+
+// batchStatus is the status of an email to [EventData.Recipients], [MessageStatusSandboxed] when the [Sandbox]
+// removed every recipient which did not fail.
+func batchStatus(ctx context.Context, results []RecipientResult) MessageStatus {
+	for _, result := range results {
+		if result.Error == "" && result.Status != MessageStatusSandboxed {
+			return deliveredStatus(ctx)
+		}
+	}
+	return MessageStatusSandboxed
+}
+
+// sentMessage is the message handed to the [Sender] for an email.
+type sentMessage struct {
+	// id is the id returned by the [Sender].
+	id string
+	// message is the message after the [Sandbox] rewrote its recipients.
+	message Message
+	// sandboxed is true when the [Sandbox] removed every recipient so nothing was sent.
+	sandboxed bool
+}
+
+// recipients returns the event data with the recipients the message was sent to, which differ from the event data
+// when the [Sandbox] rewrote them. The event data is unchanged when the message was never created.
+func (sent sentMessage) recipients(eventData EventData) EventData {
+	if sent.message.To == nil {
+		return eventData
+	}
+	eventData.To, eventData.Cc, eventData.Bcc = sent.message.To, sent.message.Cc, sent.message.Bcc
+	return eventData
+}
+
+// sendMessage renders the email body for the event data and sends it with the [Sender] registered for the
+// [EventData.Sender] domain. Failures are logged to the error logger before being returned.
+func sendMessage(ctx context.Context, app *App, eventData EventData) (sentMessage, error) {
+	emailBody, err := determineEmailBody(ctx, app, eventData)
+	if err != nil {
+		app.errorLogger.Printf("failed to determine email body %v", err)
+		return sentMessage{}, sendError{class: ErrorClassTemplate, err: err}
+	}
+
+	sender, err := domainSender(app, eventData.Sender)
+	if err != nil {
+		app.errorLogger.Print(err)
+		return sentMessage{}, sendError{class: ErrorClassConfiguration, err: err}
+	}
+
+	headers, err := emailHeaders(app, eventData)
+	if err != nil {
+		app.errorLogger.Printf("failed to create email headers %v", err)
+		return sentMessage{}, sendError{class: ErrorClassConfiguration, err: err}
+	}
+
+	message := Message{
+		Sender:   eventData.Sender,
+		Subject:  eventData.Subject,
+		Body:     emailBody.HTML,
+		Text:     emailBody.Text,
+		To:       eventData.To,
+		Cc:       eventData.Cc,
+		Bcc:      eventData.Bcc,
+		Category: eventData.Category,
+		Headers:  headers,
+	}
+	if _, ok := sender.(ScheduledSender); ok && eventData.SendAt != nil && eventData.SendAt.After(time.Now()) {
+		message.SendAt = *eventData.SendAt
+	}
+	message, hasRecipients := applySandbox(app, message)
+	if !hasRecipients {
+		return sentMessage{sandboxed: true}, nil
+	}
+	if run := dryRunFrom(ctx); run != nil {
+		domain, _ := extractEmailDomain(eventData.Sender)
+		recordDryRun(app, run, DryRunResult{Message: message, Sender: sender, Domain: domain})
+		return sentMessage{message: message}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+	id, err := sender.Send(ctx, message)
+	if err != nil {
+		app.errorLogger.Printf("failed to send email: %v\n", err)
+		return sentMessage{message: message}, sendError{class: ErrorClassProvider, err: err}
+	}
+
+	return sentMessage{id: id, message: message}, nil
+}
+
+// domainSender finds the [Sender] registered with [AppWithDomainSender] for the domain of the sender email address.
+func domainSender(app *App, senderEmail string) (Sender, error) {
+	domain, err := extractEmailDomain(senderEmail)
+	if err != nil {
+		return nil, err
+	}
+	sender, hasDomain := app.domainSenders[domain]
+	if !hasDomain {
+		return nil, fmt.Errorf(
+			"domain: \"%s\" from \"sender\": \"%s\" does not match any registered domain to send emails from",
+			domain,
+			senderEmail,
+		)
+	}
+
+	return sender, nil
+}
+
+// flush flushes the buffers of the App, i.e. of the logger, before a function which sends emails returns.
+func flush(app *App) {
+	if err := app.flusher.Flush(); err != nil {
+		// Not appropriate to rely on the info or error logger here as that is probably the thing that is being
+		// flushed and errored.
+		log.Printf("failed to flush: %v", err)
+	}
+}
 
-		return nil
+// newMessageID creates a random id for an email without an [EventData.IdempotencyKey].
+func newMessageID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
 	}
+	return hex.EncodeToString(id)
 }
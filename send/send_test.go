@@ -0,0 +1,168 @@
+package send_test
+
+import (
+	"context"
+	"github.com/itmayziii/email/send"
+	"testing"
+	"time"
+)
+
+func TestApp_Send(t *testing.T) {
+	sendAt := time.Now().Add(time.Hour)
+	tests := []struct {
+		name                string
+		eventData           send.EventData
+		dryRun              bool
+		expectedStatus      send.MessageStatus
+		expectedID          string
+		expectedScheduleKey string
+		expectedClass       send.ErrorClass
+		expectedMessages    int
+	}{
+		{
+			name:             "sent",
+			eventData:        send.EventData{Sender: "no-reply@example.com", Subject: "test", To: send.MessageTo{"tom@example.com"}, Body: "hello"},
+			expectedStatus:   send.MessageStatusSent,
+			expectedID:       "id",
+			expectedMessages: 1,
+		},
+		{
+			name: "scheduled",
+			eventData: send.EventData{
+				Sender:         "no-reply@example.com",
+				Subject:        "test",
+				To:             send.MessageTo{"tom@example.com"},
+				Body:           "hello",
+				SendAt:         &sendAt,
+				IdempotencyKey: "welcome-tom",
+			},
+			expectedStatus:      send.MessageStatusScheduled,
+			expectedScheduleKey: "welcome-tom",
+		},
+		{
+			name:           "suppressed",
+			eventData:      send.EventData{Sender: "no-reply@example.com", Subject: "test", To: send.MessageTo{"suppressed@example.com"}, Body: "hello"},
+			expectedStatus: send.MessageStatusSuppressed,
+		},
+		{
+			name:           "dry run",
+			eventData:      send.EventData{Sender: "no-reply@example.com", Subject: "test", To: send.MessageTo{"tom@example.com"}, Body: "hello"},
+			dryRun:         true,
+			expectedStatus: send.MessageStatusDryRun,
+		},
+		{
+			name:          "invalid to",
+			eventData:     send.EventData{Sender: "no-reply@example.com", Subject: "test", To: send.MessageTo{"not an email"}, Body: "hello"},
+			expectedClass: send.ErrorClassValidation,
+		},
+		{
+			name: "invalid attribute",
+			eventData: send.EventData{
+				Sender:     "no-reply@example.com",
+				Subject:    "test",
+				To:         send.MessageTo{"tom@example.com"},
+				Body:       "hello",
+				Attributes: map[string]string{"sendAt": "tomorrow"},
+			},
+			expectedClass: send.ErrorClassValidation,
+		},
+	}
+
+	for _, tt := range tests {
+		ttCopy := tt
+		t.Run(ttCopy.name, func(t *testing.T) {
+			t.Parallel()
+			sender := &recordingSender{}
+			opts := []send.AppOption{
+				send.AppWithDomainSender("example.com", sender),
+				send.AppWithScheduleStore(send.NewMemoryScheduleStore()),
+				send.AppWithSuppressionStore(send.NewMemorySuppressionStore()),
+				send.AppWithAttributeMapping(map[string]string{"sendAt": "sendAt"}),
+			}
+			if ttCopy.dryRun {
+				opts = append(opts, send.AppWithDryRun())
+			}
+			app := send.NewApp(opts...)
+			err := send.Suppress(context.Background(), app, send.Suppression{Email: "suppressed@example.com", Reason: send.SuppressionBounce})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := app.Send(context.Background(), ttCopy.eventData)
+
+			if ttCopy.expectedClass != "" {
+				if err == nil || send.ClassifyError(err) != ttCopy.expectedClass {
+					t.Fatalf("case: \"%s\", expected a %s error, got %v", ttCopy.name, ttCopy.expectedClass, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("case: \"%s\", unexpected error: %v", ttCopy.name, err)
+			}
+			if result.Status != ttCopy.expectedStatus || result.ID != ttCopy.expectedID || result.ScheduleKey != ttCopy.expectedScheduleKey {
+				t.Errorf("case: \"%s\", unexpected result %+v", ttCopy.name, result)
+			}
+			if len(sender.messages) != ttCopy.expectedMessages {
+				t.Errorf("case: \"%s\", expected %d messages, got %d", ttCopy.name, ttCopy.expectedMessages, len(sender.messages))
+			}
+		})
+	}
+}
+
+func TestApp_SendRecipients(t *testing.T) {
+	t.Parallel()
+	sender := &recordingSender{}
+	app := send.NewApp(send.AppWithDomainSender("example.com", sender))
+
+	result, err := app.Send(context.Background(), send.EventData{
+		Sender:  "no-reply@example.com",
+		Subject: "test",
+		Body:    "hello {{ .Name }}",
+		Recipients: []send.Recipient{
+			{To: "tom@example.com", Data: map[string]interface{}{"name": "Tom"}},
+			{To: "jane@example.com", Data: map[string]interface{}{"name": "Jane"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.Status != send.MessageStatusSent || len(result.Recipients) != 2 {
+		t.Fatalf("expected a sent result for 2 recipients, got %+v", result)
+	}
+	for _, recipient := range result.Recipients {
+		if recipient.ID != "id" || recipient.Error != "" {
+			t.Errorf("unexpected recipient result %+v", recipient)
+		}
+	}
+}
+
+func TestApp_Render(t *testing.T) {
+	t.Parallel()
+	sender := &recordingSender{}
+	sendLog := send.NewMemorySendLog()
+	app := send.NewApp(send.AppWithDomainSender("example.com", sender), send.AppWithSendLog(sendLog))
+
+	results, err := app.Render(context.Background(), send.EventData{
+		Sender:  "no-reply@example.com",
+		Subject: "test",
+		To:      send.MessageTo{"tom@example.com"},
+		Body:    "hello {{ .Name }}",
+		Data:    map[string]interface{}{"name": "Tom"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(results) != 1 || results[0].Message.Body != "hello Tom" || results[0].Sender != sender || results[0].Domain != "example.com" {
+		t.Errorf("expected the rendered message, got %+v", results)
+	}
+	if len(sender.messages) != 0 || len(sendLog.Events()) != 0 {
+		t.Errorf("expected nothing to be sent or recorded, got %d messages", len(sender.messages))
+	}
+
+	_, err = app.Render(context.Background(), send.EventData{Sender: "no-reply@example.com", To: send.MessageTo{"tom@example.com"}, Body: "hello"})
+	if send.ClassifyError(err) != send.ErrorClassValidation {
+		t.Errorf("expected a validation error for the missing subject, got %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+package send
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Suppression reasons, any other reason may also be used.
+const (
+	SuppressionBounce      = "bounce"
+	SuppressionComplaint   = "complaint"
+	SuppressionUnsubscribe = "unsubscribe"
+)
+
+// ErrSuppressionNotFound is returned by a [SuppressionStore] when the email is not suppressed in the scope.
+var ErrSuppressionNotFound = errors.New("suppression not found")
+
+// SuppressionScope limits which emails a [Suppression] applies to. The zero value is a global suppression which
+// applies to every email, a Domain only applies to emails from that sender domain, and a Category only applies to
+// emails with that [EventData.Category]. When both are set both must match.
+type SuppressionScope struct {
+	Domain   string `json:"domain,omitempty"`
+	Category string `json:"category,omitempty"`
+}
+
+// matches reports whether the scope applies to an email from the sender domain in the category.
+func (scope SuppressionScope) matches(domain string, category string) bool {
+	if scope.Domain != "" && !strings.EqualFold(scope.Domain, domain) {
+		return false
+	}
+	if scope.Category != "" && scope.Category != category {
+		return false
+	}
+	return true
+}
+
+// Suppression stops emails from being sent to an email address i.e. because it hard bounced or unsubscribed.
+type Suppression struct {
+	Email     string           `json:"email"`
+	Scope     SuppressionScope `json:"scope"`
+	Reason    string           `json:"reason"`
+	CreatedAt time.Time        `json:"createdAt"`
+}
+
+// SuppressionStore persists suppressed email addresses. Email addresses are normalized to lower case before being
+// passed to the store. Implementations must be safe for concurrent use.
+type SuppressionStore interface {
+	// Add suppresses an email address, replacing any suppression of the address with the same scope.
+	Add(ctx context.Context, suppression Suppression) error
+	// Remove removes the suppression of an email address with the scope, [ErrSuppressionNotFound] is returned when it
+	// does not exist.
+	Remove(ctx context.Context, email string, scope SuppressionScope) error
+	// Find returns every suppression, in any scope, of the email addresses.
+	Find(ctx context.Context, emails []string) ([]Suppression, error)
+}
+
+// SuppressionError represents an error that occurs when the [SuppressionStore] can not be checked.
+type SuppressionError struct {
+	err error
+}
+
+func (suppressionError SuppressionError) Error() string {
+	return fmt.Sprintf("failed to check suppressions - %v", suppressionError.err)
+}
+
+func (suppressionError SuppressionError) Unwrap() error {
+	return suppressionError.err
+}
+
+// normalizeEmail returns the lower case address of an email which may include a name i.e. "Tom <TOM@example.com>".
+func normalizeEmail(email string) string {
+	if address, err := mail.ParseAddress(email); err == nil {
+		email = address.Address
+	}
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Suppress adds a suppression to the [SuppressionStore] configured with [AppWithSuppressionStore].
+func Suppress(ctx context.Context, app *App, suppression Suppression) error {
+	if app.suppressionStore == nil {
+		return errNoSuppressionStore
+	}
+
+	suppression.Email = normalizeEmail(suppression.Email)
+	if suppression.CreatedAt.IsZero() {
+		suppression.CreatedAt = time.Now().UTC()
+	}
+	return app.suppressionStore.Add(ctx, suppression)
+}
+
+// Unsuppress removes a suppression from the [SuppressionStore] configured with [AppWithSuppressionStore].
+func Unsuppress(ctx context.Context, app *App, email string, scope SuppressionScope) error {
+	if app.suppressionStore == nil {
+		return errNoSuppressionStore
+	}
+
+	return app.suppressionStore.Remove(ctx, normalizeEmail(email), scope)
+}
+
+// errNoSuppressionStore is returned when suppression functionality is used without [AppWithSuppressionStore].
+var errNoSuppressionStore = errors.New("no suppression store is configured")
+
+// removeSuppressed removes suppressed addresses from [EventData.To], [EventData.Cc], [EventData.Bcc], and
+// [EventData.Recipients] and reports whether anyone is left to send the email to. An email without any [EventData.To]
+// or [EventData.Recipients] left is not sent, even if there are [EventData.Cc] or [EventData.Bcc] left.
+func removeSuppressed(ctx context.Context, app *App, eventData EventData) (EventData, bool, error) {
+	if app.suppressionStore == nil {
+		return eventData, true, nil
+	}
+
+	emails := make([]string, 0, len(eventData.To)+len(eventData.Cc)+len(eventData.Bcc)+len(eventData.Recipients))
+	for _, addresses := range [][]string{eventData.To, eventData.Cc, eventData.Bcc} {
+		for _, address := range addresses {
+			emails = append(emails, normalizeEmail(address))
+		}
+	}
+	for _, recipient := range eventData.Recipients {
+		emails = append(emails, normalizeEmail(recipient.To))
+	}
+
+	suppressions, err := app.suppressionStore.Find(ctx, emails)
+	if err != nil {
+		return eventData, false, sendError{class: ErrorClassStorage, err: SuppressionError{err: err}}
+	}
+	domain, _ := extractEmailDomain(normalizeEmail(eventData.Sender))
+	suppressed := make(map[string]Suppression)
+	for _, suppression := range suppressions {
+		if suppression.Scope.matches(domain, eventData.Category) {
+			suppressed[normalizeEmail(suppression.Email)] = suppression
+		}
+	}
+	if len(suppressed) == 0 {
+		return eventData, true, nil
+	}
+
+	keep := func(address string) bool {
+		suppression, ok := suppressed[normalizeEmail(address)]
+		if ok {
+			app.infoLogger.Printf(
+				"suppressed recipient removed: email: %s, reason: %s, subject: %s\n",
+				address,
+				suppression.Reason,
+				eventData.Subject,
+			)
+		}
+		return !ok
+	}
+	eventData.To = filterAddresses(eventData.To, keep)
+	eventData.Cc = filterAddresses(eventData.Cc, keep)
+	eventData.Bcc = filterAddresses(eventData.Bcc, keep)
+	if len(eventData.Recipients) > 0 {
+		var recipients []Recipient
+		for _, recipient := range eventData.Recipients {
+			if keep(recipient.To) {
+				recipients = append(recipients, recipient)
+			}
+		}
+		eventData.Recipients = recipients
+	}
+
+	return eventData, len(eventData.To) > 0 || len(eventData.Recipients) > 0, nil
+}
+
+// filterAddresses returns the addresses for which keep returns true.
+func filterAddresses(addresses MessageTo, keep func(string) bool) MessageTo {
+	var kept MessageTo
+	for _, address := range addresses {
+		if keep(address) {
+			kept = append(kept, address)
+		}
+	}
+	return kept
+}
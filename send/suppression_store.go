@@ -0,0 +1,325 @@
+package send
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// MemorySuppressionStore is a [SuppressionStore] which keeps suppressions in memory, suppressions are lost when the
+// process exits so it is only suitable for testing.
+type MemorySuppressionStore struct {
+	mu           sync.Mutex
+	suppressions map[string][]Suppression
+}
+
+// NewMemorySuppressionStore constructs a [MemorySuppressionStore].
+func NewMemorySuppressionStore() *MemorySuppressionStore {
+	return &MemorySuppressionStore{suppressions: make(map[string][]Suppression)}
+}
+
+func (store *MemorySuppressionStore) Add(ctx context.Context, suppression Suppression) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.suppressions[suppression.Email] = replaceSuppression(store.suppressions[suppression.Email], suppression)
+	return nil
+}
+
+func (store *MemorySuppressionStore) Remove(ctx context.Context, email string, scope SuppressionScope) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	remaining, removed := removeSuppression(store.suppressions[email], scope)
+	if !removed {
+		return ErrSuppressionNotFound
+	}
+	store.suppressions[email] = remaining
+	return nil
+}
+
+func (store *MemorySuppressionStore) Find(ctx context.Context, emails []string) ([]Suppression, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	var found []Suppression
+	for _, email := range uniqueStrings(emails) {
+		found = append(found, store.suppressions[email]...)
+	}
+	return found, nil
+}
+
+// BlobSuppressionStore is a [SuppressionStore] which keeps the suppressions of each email address as a JSON file in a
+// [blob.Bucket] under a prefix i.e. "suppressions/".
+//
+// [blob.Bucket]: https://gocloud.dev/howto/blob/
+type BlobSuppressionStore struct {
+	bucket *blob.Bucket
+	prefix string
+	// mu serializes read-modify-write updates of a file within this process.
+	mu *sync.Mutex
+}
+
+// NewBlobSuppressionStore constructs a [BlobSuppressionStore].
+func NewBlobSuppressionStore(bucket *blob.Bucket, prefix string) BlobSuppressionStore {
+	return BlobSuppressionStore{bucket: bucket, prefix: prefix, mu: &sync.Mutex{}}
+}
+
+func (store BlobSuppressionStore) Add(ctx context.Context, suppression Suppression) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	suppressions, err := store.read(ctx, suppression.Email)
+	if err != nil {
+		return err
+	}
+	return store.write(ctx, suppression.Email, replaceSuppression(suppressions, suppression))
+}
+
+func (store BlobSuppressionStore) Remove(ctx context.Context, email string, scope SuppressionScope) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	suppressions, err := store.read(ctx, email)
+	if err != nil {
+		return err
+	}
+	remaining, removed := removeSuppression(suppressions, scope)
+	if !removed {
+		return ErrSuppressionNotFound
+	}
+	if len(remaining) == 0 {
+		return store.bucket.Delete(ctx, store.fileName(email))
+	}
+	return store.write(ctx, email, remaining)
+}
+
+func (store BlobSuppressionStore) Find(ctx context.Context, emails []string) ([]Suppression, error) {
+	var found []Suppression
+	for _, email := range uniqueStrings(emails) {
+		suppressions, err := store.read(ctx, email)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, suppressions...)
+	}
+	return found, nil
+}
+
+// read returns the suppressions of an email address, an address without a file has no suppressions.
+func (store BlobSuppressionStore) read(ctx context.Context, email string) ([]Suppression, error) {
+	contents, err := store.bucket.ReadAll(ctx, store.fileName(email))
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var suppressions []Suppression
+	if err := json.Unmarshal(contents, &suppressions); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal suppressions of %s - %v", email, err)
+	}
+	return suppressions, nil
+}
+
+// write replaces the suppressions of an email address.
+func (store BlobSuppressionStore) write(ctx context.Context, email string, suppressions []Suppression) error {
+	contents, err := json.Marshal(suppressions)
+	if err != nil {
+		return err
+	}
+
+	return store.bucket.WriteAll(ctx, store.fileName(email), contents, &blob.WriterOptions{
+		ContentType: "application/json",
+	})
+}
+
+// fileName escapes the email address so it is safe to use as a file name.
+func (store BlobSuppressionStore) fileName(email string) string {
+	return store.prefix + url.PathEscape(email) + ".json"
+}
+
+// sqlSuppressionBatchSize is the most email addresses looked up in a single query.
+const sqlSuppressionBatchSize = 500
+
+// SQLSuppressionStore is a [SuppressionStore] which keeps suppressions in a SQL database table. The table must
+// already exist with the following columns, a global scope is stored as empty strings:
+//
+//	CREATE TABLE suppressions (
+//	    email      VARCHAR(320) NOT NULL,
+//	    domain     VARCHAR(255) NOT NULL DEFAULT '',
+//	    category   VARCHAR(255) NOT NULL DEFAULT '',
+//	    reason     VARCHAR(255) NOT NULL DEFAULT '',
+//	    created_at TIMESTAMP    NOT NULL,
+//	    PRIMARY KEY (email, domain, category)
+//	);
+type SQLSuppressionStore struct {
+	db          *sql.DB
+	table       string
+	placeholder SQLPlaceholder
+}
+
+// NewSQLSuppressionStore constructs a [SQLSuppressionStore] using the table, the placeholder should match the
+// database driver i.e. [DollarPlaceholder] for PostgreSQL.
+func NewSQLSuppressionStore(db *sql.DB, table string, placeholder SQLPlaceholder) SQLSuppressionStore {
+	return SQLSuppressionStore{db: db, table: table, placeholder: placeholder}
+}
+
+func (store SQLSuppressionStore) Add(ctx context.Context, suppression Suppression) error {
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := store.delete(ctx, tx, suppression.Email, suppression.Scope); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	insertQuery := fmt.Sprintf(
+		"INSERT INTO %s (email, domain, category, reason, created_at) VALUES (%s, %s, %s, %s, %s)",
+		store.table,
+		store.placeholder(1),
+		store.placeholder(2),
+		store.placeholder(3),
+		store.placeholder(4),
+		store.placeholder(5),
+	)
+	_, err = tx.ExecContext(
+		ctx,
+		insertQuery,
+		suppression.Email,
+		suppression.Scope.Domain,
+		suppression.Scope.Category,
+		suppression.Reason,
+		suppression.CreatedAt.UTC(),
+	)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (store SQLSuppressionStore) Remove(ctx context.Context, email string, scope SuppressionScope) error {
+	deleted, err := store.delete(ctx, store.db, email, scope)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrSuppressionNotFound
+	}
+	return nil
+}
+
+func (store SQLSuppressionStore) Find(ctx context.Context, emails []string) ([]Suppression, error) {
+	emails = uniqueStrings(emails)
+	var found []Suppression
+	for start := 0; start < len(emails); start += sqlSuppressionBatchSize {
+		end := start + sqlSuppressionBatchSize
+		if end > len(emails) {
+			end = len(emails)
+		}
+		suppressions, err := store.find(ctx, emails[start:end])
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, suppressions...)
+	}
+	return found, nil
+}
+
+// find looks up the suppressions of a batch of email addresses in a single query.
+func (store SQLSuppressionStore) find(ctx context.Context, emails []string) ([]Suppression, error) {
+	placeholders := make([]string, len(emails))
+	args := make([]interface{}, len(emails))
+	for i, email := range emails {
+		placeholders[i] = store.placeholder(i + 1)
+		args[i] = email
+	}
+	query := fmt.Sprintf(
+		"SELECT email, domain, category, reason, created_at FROM %s WHERE email IN (%s)",
+		store.table,
+		strings.Join(placeholders, ", "),
+	)
+	rows, err := store.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var found []Suppression
+	for rows.Next() {
+		var suppression Suppression
+		err := rows.Scan(
+			&suppression.Email,
+			&suppression.Scope.Domain,
+			&suppression.Scope.Category,
+			&suppression.Reason,
+			&suppression.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, suppression)
+	}
+
+	return found, rows.Err()
+}
+
+// sqlExecer is implemented by both *sql.DB and *sql.Tx.
+type sqlExecer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// delete removes the suppression of an email address with the scope and returns how many rows were removed.
+func (store SQLSuppressionStore) delete(ctx context.Context, db sqlExecer, email string, scope SuppressionScope) (int64, error) {
+	query := fmt.Sprintf(
+		"DELETE FROM %s WHERE email = %s AND domain = %s AND category = %s",
+		store.table,
+		store.placeholder(1),
+		store.placeholder(2),
+		store.placeholder(3),
+	)
+	result, err := db.ExecContext(ctx, query, email, scope.Domain, scope.Category)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// replaceSuppression adds the suppression, replacing any suppression with the same scope.
+func replaceSuppression(suppressions []Suppression, suppression Suppression) []Suppression {
+	remaining, _ := removeSuppression(suppressions, suppression.Scope)
+	return append(remaining, suppression)
+}
+
+// removeSuppression removes the suppression with the scope and reports whether there was one.
+func removeSuppression(suppressions []Suppression, scope SuppressionScope) ([]Suppression, bool) {
+	var remaining []Suppression
+	removed := false
+	for _, suppression := range suppressions {
+		if suppression.Scope == scope {
+			removed = true
+			continue
+		}
+		remaining = append(remaining, suppression)
+	}
+	return remaining, removed
+}
+
+// uniqueStrings returns the strings without duplicates, in their original order.
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var unique []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,136 @@
+package send_test
+
+import (
+	"context"
+	"errors"
+	"github.com/itmayziii/email/send"
+	"gocloud.dev/blob/memblob"
+	"reflect"
+	"testing"
+)
+
+func TestSuppressionStores(t *testing.T) {
+	bucket := memblob.OpenBucket(nil)
+	t.Cleanup(func() { _ = bucket.Close() })
+	stores := map[string]send.SuppressionStore{
+		"memory": send.NewMemorySuppressionStore(),
+		"blob":   send.NewBlobSuppressionStore(bucket, "suppressions/"),
+	}
+
+	for name, store := range stores {
+		storeCopy := store
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			suppressions := []send.Suppression{
+				{Email: "tom@example.com", Reason: send.SuppressionBounce},
+				{Email: "tom@example.com", Scope: send.SuppressionScope{Category: "newsletter"}, Reason: "first"},
+				{Email: "tom@example.com", Scope: send.SuppressionScope{Category: "newsletter"}, Reason: send.SuppressionUnsubscribe},
+				{Email: "jane@example.com", Scope: send.SuppressionScope{Domain: "example.org"}},
+			}
+			for _, suppression := range suppressions {
+				if err := storeCopy.Add(ctx, suppression); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			found, err := storeCopy.Find(ctx, []string{"tom@example.com", "tom@example.com", "nobody@example.com"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(found) != 2 {
+				t.Errorf("expected 2 suppressions of tom@example.com, got %+v", found)
+			}
+			for _, suppression := range found {
+				if suppression.Reason == "first" {
+					t.Errorf("expected suppression with the same scope to be replaced, got %+v", found)
+				}
+			}
+
+			if err := storeCopy.Remove(ctx, "jane@example.com", send.SuppressionScope{Domain: "example.org"}); err != nil {
+				t.Fatal(err)
+			}
+			err = storeCopy.Remove(ctx, "jane@example.com", send.SuppressionScope{Domain: "example.org"})
+			if !errors.Is(err, send.ErrSuppressionNotFound) {
+				t.Errorf("expected ErrSuppressionNotFound but got %v", err)
+			}
+		})
+	}
+}
+
+func TestEmailEvent_RemovesSuppressedRecipients(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     map[string]interface{}
+		expected []send.Message
+	}{
+		{
+			"removes suppressed",
+			map[string]interface{}{
+				"to":       []string{"tom@example.com", "Jane <JANE@example.com>", "other-domain@example.com"},
+				"cc":       "bounced@example.com",
+				"category": "receipts",
+			},
+			[]send.Message{{To: []string{"tom@example.com", "other-domain@example.com"}}},
+		},
+		{
+			"category",
+			map[string]interface{}{"to": []string{"tom@example.com", "newsletter@example.com"}, "category": "newsletter"},
+			[]send.Message{{To: []string{"tom@example.com"}}},
+		},
+		{
+			"skips when every to is suppressed",
+			map[string]interface{}{"to": "bounced@example.com", "bcc": "tom@example.com"},
+			nil,
+		},
+		{
+			"recipients",
+			map[string]interface{}{"recipients": []interface{}{
+				map[string]interface{}{"to": "bounced@example.com"},
+				map[string]interface{}{"to": "tom@example.com"},
+			}},
+			[]send.Message{{To: []string{"tom@example.com"}}},
+		},
+	}
+
+	ctx := context.Background()
+	store := send.NewMemorySuppressionStore()
+	suppressApp := send.NewApp(send.AppWithSuppressionStore(store))
+	suppressions := []send.Suppression{
+		{Email: "bounced@example.com", Reason: send.SuppressionBounce},
+		{Email: "jane@example.com", Scope: send.SuppressionScope{Domain: "example.com"}},
+		{Email: "other-domain@example.com", Scope: send.SuppressionScope{Domain: "example.org"}},
+		{Email: "newsletter@example.com", Scope: send.SuppressionScope{Category: "newsletter"}},
+	}
+	for _, suppression := range suppressions {
+		if err := send.Suppress(ctx, suppressApp, suppression); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range tests {
+		ttCopy := tt
+		t.Run(ttCopy.name, func(t *testing.T) {
+			t.Parallel()
+			sender := &recordingSender{}
+			app := send.NewApp(send.AppWithDomainSender("example.com", sender), send.AppWithSuppressionStore(store))
+
+			data := map[string]interface{}{"sender": "no-reply@example.com", "subject": "test", "body": "hello"}
+			for k, v := range ttCopy.data {
+				data[k] = v
+			}
+			if err := send.EmailEvent(app)(ctx, newEvent(t, data)); err != nil {
+				t.Fatalf("case: \"%s\", unexpected error: %v", ttCopy.name, err)
+			}
+
+			if len(sender.messages) != len(ttCopy.expected) {
+				t.Fatalf("case: \"%s\", expected %d messages, got %+v", ttCopy.name, len(ttCopy.expected), sender.messages)
+			}
+			for i, message := range sender.messages {
+				if !reflect.DeepEqual(message.To, ttCopy.expected[i].To) || len(message.Cc) != 0 {
+					t.Errorf("case: \"%s\", expected to %v without cc, got %+v", ttCopy.name, ttCopy.expected[i].To, message)
+				}
+			}
+		})
+	}
+}
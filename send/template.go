@@ -4,9 +4,13 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"gocloud.dev/blob"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 	htmlTemplate "html/template"
+	"sync"
+	textTemplate "text/template"
+	"text/template/parse"
 )
 
 // ReadTemplateError represents an error that occurs when an email template fails to be retrieved/read.
@@ -21,7 +25,7 @@ func (readTemplateError ReadTemplateError) Error() string {
 
 // readTemplate reads file contents from the provided App.fileStorage.
 func readTemplate(ctx context.Context, app *App, fileName string) (string, error) {
-	data, err := app.fileStorage.ReadAll(ctx, fileName)
+	data, err := readFile(ctx, app.fileStorage, fileName)
 	if err != nil {
 		return "", ReadTemplateError{templateName: fileName, err: err}
 	}
@@ -29,29 +33,196 @@ func readTemplate(ctx context.Context, app *App, fileName string) (string, error
 	return string(data), nil
 }
 
+// fileCacheKey is the context key of the fileCache shared by every recipient of an email to [EventData.Recipients].
+type fileCacheKey struct{}
+
+// fileCache keeps the files read from file storage, i.e. templates, partials, stylesheets, and schemas, so they are
+// read once for an email rather than once per recipient. Recipients are sent concurrently so it is safe for
+// concurrent use.
+type fileCache struct {
+	mu    sync.Mutex
+	files map[string]cachedFile
+}
+
+// cachedFile is the outcome of reading a file, missing files are cached too as partials are looked up by trying
+// several names.
+type cachedFile struct {
+	data []byte
+	err  error
+}
+
+// withFileCache returns a context whose file storage reads are cached, see [readFile].
+func withFileCache(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(fileCacheKey{}).(*fileCache); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, fileCacheKey{}, &fileCache{files: make(map[string]cachedFile)})
+}
+
+// readFile reads a file from file storage, only once when the context was created with [withFileCache].
+func readFile(ctx context.Context, fileStorage *blob.Bucket, name string) ([]byte, error) {
+	cache, ok := ctx.Value(fileCacheKey{}).(*fileCache)
+	if !ok {
+		return fileStorage.ReadAll(ctx, name)
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if file, ok := cache.files[name]; ok {
+		return file.data, file.err
+	}
+	data, err := fileStorage.ReadAll(ctx, name)
+	cache.files[name] = cachedFile{data: data, err: err}
+	return data, err
+}
+
 // executeTemplate takes a string representing a [Go HTML template] attempts to bind provided data to the template.
-// If any template variables go unbound then an error is returned.
+// If any template variables go unbound then an error is returned. The provided funcs are made available to the template.
 //
 // [Go HTML template]: https://pkg.go.dev/html/template
-func executeTemplate(template string, data map[string]interface{}) (string, error) {
-	// We expect email templates to use title case variables {{ .Title }}
-	titleData := make(map[string]interface{})
-	for k, v := range data {
-		titleK := cases.Title(language.AmericanEnglish)
-		titleData[titleK.String(k)] = v
+func executeTemplate(template string, data map[string]interface{}, funcs htmlTemplate.FuncMap) (string, error) {
+	t, err := htmlTemplate.New("email").
+		Option("missingkey=error").
+		Funcs(funcs).
+		Parse(template)
+	if err != nil {
+		return "", err
 	}
 
-	t, err := htmlTemplate.New("email").
+	var tpl bytes.Buffer
+	err = t.Execute(&tpl, titleCaseKeys(data))
+	if err != nil {
+		return "", err
+	}
+	return tpl.String(), nil
+}
+
+// executeTextTemplate is the [Go text template] equivalent of [executeTemplate], nothing is escaped so the result
+// is only appropriate for plain text.
+//
+// [Go text template]: https://pkg.go.dev/text/template
+func executeTextTemplate(template string, data map[string]interface{}, funcs htmlTemplate.FuncMap) (string, error) {
+	t, err := textTemplate.New("email").
 		Option("missingkey=error").
+		Funcs(textTemplate.FuncMap(funcs)).
 		Parse(template)
 	if err != nil {
 		return "", err
 	}
 
 	var tpl bytes.Buffer
-	err = t.Execute(&tpl, titleData)
+	err = t.Execute(&tpl, titleCaseKeys(data))
 	if err != nil {
 		return "", err
 	}
 	return tpl.String(), nil
 }
+
+// titleCaseKeys copies data with each key converted to title case. We expect Go templates to use title case
+// variables {{ .Title }}.
+func titleCaseKeys(data map[string]interface{}) map[string]interface{} {
+	titleData := make(map[string]interface{})
+	for k, v := range data {
+		titleData[titleCase(k)] = v
+	}
+
+	return titleData
+}
+
+// titleCase converts a template variable name to title case.
+func titleCase(k string) string {
+	return cases.Title(language.AmericanEnglish).String(k)
+}
+
+// inspectGoTemplate parses a Go template and reports the top level variables it references i.e. "Name" for {{ .Name }}
+// or {{ $.Name }} along with any {{ template "name" }} calls to templates which are not defined in the template.
+func inspectGoTemplate(template string, funcs htmlTemplate.FuncMap) (TemplateInfo, error) {
+	t, err := textTemplate.New("email").
+		Funcs(textTemplate.FuncMap(funcs)).
+		Parse(template)
+	if err != nil {
+		return TemplateInfo{}, err
+	}
+
+	inspector := goTemplateInspector{seen: make(map[string]bool)}
+	for _, defined := range t.Templates() {
+		// Templates defined with {{ define }} receive whatever dot they are called with so only the main template's
+		// variables are known to come from the root data.
+		if defined.Tree != nil {
+			inspector.walk(defined.Tree.Root, defined == t)
+		}
+	}
+	for _, name := range inspector.calls {
+		if t.Lookup(name) == nil {
+			inspector.info.UndefinedPartials = append(inspector.info.UndefinedPartials, name)
+		}
+	}
+
+	return inspector.info, nil
+}
+
+// goTemplateInspector walks a Go template parse tree collecting the variables referenced from the root data.
+type goTemplateInspector struct {
+	info  TemplateInfo
+	seen  map[string]bool
+	calls []string
+}
+
+// walk visits the node, root reports whether dot is still the root data at this point in the template. Dot changes
+// inside of {{ range }} and {{ with }}.
+func (i *goTemplateInspector) walk(node parse.Node, root bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			i.walk(child, root)
+		}
+	case *parse.ActionNode:
+		i.walk(n.Pipe, root)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				i.walk(arg, root)
+			}
+		}
+	case *parse.IfNode:
+		i.walkBranch(&n.BranchNode, root, root)
+	case *parse.RangeNode:
+		i.walkBranch(&n.BranchNode, root, false)
+	case *parse.WithNode:
+		i.walkBranch(&n.BranchNode, root, false)
+	case *parse.TemplateNode:
+		i.calls = append(i.calls, n.Name)
+		i.walk(n.Pipe, root)
+	case *parse.FieldNode:
+		if root {
+			i.add(n.Ident[0])
+		}
+	case *parse.ChainNode:
+		i.walk(n.Node, root)
+	case *parse.VariableNode:
+		if n.Ident[0] == "$" && len(n.Ident) > 1 {
+			i.add(n.Ident[1])
+		}
+	}
+}
+
+// walkBranch visits an {{ if }}, {{ range }}, or {{ with }}. The pipeline and else branch are evaluated with the
+// outer dot while the body is evaluated with bodyRoot.
+func (i *goTemplateInspector) walkBranch(n *parse.BranchNode, root bool, bodyRoot bool) {
+	i.walk(n.Pipe, root)
+	i.walk(n.List, bodyRoot)
+	i.walk(n.ElseList, root)
+}
+
+func (i *goTemplateInspector) add(variable string) {
+	if !i.seen[variable] {
+		i.seen[variable] = true
+		i.info.Variables = append(i.info.Variables, variable)
+	}
+}
@@ -0,0 +1,131 @@
+package send_test
+
+import (
+	"context"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/itmayziii/email/send"
+	"gocloud.dev/blob/memblob"
+	htmlTemplate "html/template"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingSender implements [send.Sender] and keeps every message it was asked to send.
+type recordingSender struct {
+	mu       sync.Mutex
+	messages []send.Message
+}
+
+func (rs *recordingSender) Send(ctx context.Context, m send.Message) (string, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.messages = append(rs.messages, m)
+	return "id", nil
+}
+
+// newEvent creates a CloudEvent with the provided data for testing.
+func newEvent(t *testing.T, data interface{}) cloudevents.Event {
+	t.Helper()
+	event := cloudevents.NewEvent()
+	event.SetID("1")
+	event.SetSource("test")
+	event.SetType("test")
+	if err := event.SetData(cloudevents.ApplicationJSON, data); err != nil {
+		t.Fatalf("failed to set event data: %v", err)
+	}
+
+	return event
+}
+
+func TestEmailEvent_TemplateFuncs(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		data     map[string]interface{}
+		expected string
+	}{
+		{"date", `{{ date "2006-01-02 15:04" .At }}`, map[string]interface{}{"at": "2023-10-05T14:30:00Z"}, "2023-10-05 14:30"},
+		{"date unix", `{{ date "2006-01-02" .At }}`, map[string]interface{}{"at": 1696516200}, "2023-10-05"},
+		{"date in zone", `{{ dateInZone "15:04 MST" "America/New_York" .At }}`, map[string]interface{}{"at": "2023-10-05T14:30:00Z"}, "10:30 EDT"},
+		{"currency", `{{ currency "USD" .Total }}`, map[string]interface{}{"total": 1234.5}, "$1,234.50"},
+		{"currency negative", `{{ currency "EUR" .Total }}`, map[string]interface{}{"total": -5}, "-€5.00"},
+		{"currency no decimals", `{{ currency "JPY" .Total }}`, map[string]interface{}{"total": 500}, "¥500"},
+		{"pluralize singular", `{{ pluralize "item" "items" .Count }}`, map[string]interface{}{"count": 1}, "item"},
+		{"pluralize plural", `{{ pluralize "item" "items" .Count }}`, map[string]interface{}{"count": 2}, "items"},
+		{"default", `{{ .Name | default "friend" }}`, map[string]interface{}{"name": ""}, "friend"},
+		{"default not used", `{{ .Name | default "friend" }}`, map[string]interface{}{"name": "Tommy"}, "Tommy"},
+		{"coalesce", `{{ coalesce .Nickname .Name "friend" }}`, map[string]interface{}{"nickname": nil, "name": "Tommy"}, "Tommy"},
+		{"truncate", `{{ .Text | truncate 5 }}`, map[string]interface{}{"text": "hello world"}, "hello..."},
+		{"truncate short", `{{ .Text | truncate 50 }}`, map[string]interface{}{"text": "hello world"}, "hello world"},
+		{"url", `<a href="{{ url "https://example.com/orders" "id" .Id "q" "a b" }}">`, map[string]interface{}{"id": "7"}, `<a href="https://example.com/orders?id=7&amp;q=a&#43;b">`},
+		{"markdown", `{{ markdown .Text }}`, map[string]interface{}{"text": "**hi** <script>alert(1)</script>"}, "<p><strong>hi</strong> alert(1)</p>\n"},
+	}
+
+	for _, tt := range tests {
+		ttCopy := tt
+		t.Run(ttCopy.name, func(t *testing.T) {
+			t.Parallel()
+			sender := &recordingSender{}
+			app := send.NewApp(send.AppWithDomainSender("example.com", sender))
+
+			err := send.EmailEvent(app)(context.Background(), newEvent(t, map[string]interface{}{
+				"sender":  "no-reply@example.com",
+				"subject": "test",
+				"to":      "tom@example.com",
+				"body":    ttCopy.body,
+				"data":    ttCopy.data,
+			}))
+			if err != nil {
+				t.Fatalf("case: \"%s\", unexpected error: %v", ttCopy.name, err)
+			}
+			if sender.messages[0].Body != ttCopy.expected {
+				t.Errorf("expected %q to match %q", sender.messages[0].Body, ttCopy.expected)
+			}
+		})
+	}
+}
+
+func TestEmailEvent_TemplateFuncsRejectUnsafeURL(t *testing.T) {
+	t.Parallel()
+	app := send.NewApp(send.AppWithDomainSender("example.com", &recordingSender{}))
+
+	err := send.EmailEvent(app)(context.Background(), newEvent(t, map[string]interface{}{
+		"sender":  "no-reply@example.com",
+		"subject": "test",
+		"to":      "tom@example.com",
+		"body":    `{{ url "javascript:alert(1)" }}`,
+	}))
+	if err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("expected scheme not allowed error but got %v", err)
+	}
+}
+
+func TestAppWithTemplateFuncs_RegistersCustomFuncs(t *testing.T) {
+	t.Parallel()
+	sender := &recordingSender{}
+	bucket := memblob.OpenBucket(nil)
+	t.Cleanup(func() { _ = bucket.Close() })
+	if err := bucket.WriteAll(context.Background(), "welcome.html", []byte(`{{ shout .Name }}`), nil); err != nil {
+		t.Fatal(err)
+	}
+	app := send.NewApp(
+		send.AppWithFileStorage(bucket),
+		send.AppWithDomainSender("example.com", sender),
+		send.AppWithTemplateFuncs(htmlTemplate.FuncMap{"shout": strings.ToUpper}),
+	)
+
+	err := send.EmailEvent(app)(context.Background(), newEvent(t, map[string]interface{}{
+		"sender":   "no-reply@example.com",
+		"subject":  "test",
+		"to":       "tom@example.com",
+		"template": "welcome.html",
+		"data":     map[string]interface{}{"name": "tommy"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sender.messages[0].Body != "TOMMY" {
+		t.Errorf("expected %q to match %q", sender.messages[0].Body, "TOMMY")
+	}
+}
@@ -0,0 +1,225 @@
+package send
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmlTemplate "html/template"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// unsubscribeTokenParam is the query parameter of the unsubscribe URL holding the token.
+	unsubscribeTokenParam = "token"
+	// oneClickUnsubscribe is the List-Unsubscribe-Post header value and the form body RFC 8058 clients post.
+	oneClickUnsubscribe = "List-Unsubscribe=One-Click"
+	// previewUnsubscribeURL is returned by the unsubscribeURL template function when there is no recipient i.e. when
+	// previewing or linting a template.
+	previewUnsubscribeURL = "#unsubscribe"
+)
+
+// unsubscribeConfig is how unsubscribe links are built and verified, see [AppWithUnsubscribe].
+type unsubscribeConfig struct {
+	baseURL string
+	secret  []byte
+}
+
+// UnsubscribeToken identifies who is unsubscribing from what, it is signed so it can not be forged.
+type UnsubscribeToken struct {
+	Email string `json:"e"`
+	// Category is the [EventData.Category] being unsubscribed from, when empty the recipient is unsubscribed from every
+	// email from the Sender domain.
+	Category string `json:"c,omitempty"`
+	Sender   string `json:"s"`
+}
+
+// InvalidUnsubscribeTokenError represents an error that occurs when an unsubscribe token is malformed or its
+// signature does not match.
+type InvalidUnsubscribeTokenError struct {
+	reason string
+}
+
+func (invalidUnsubscribeTokenError InvalidUnsubscribeTokenError) Error() string {
+	return fmt.Sprintf("invalid unsubscribe token - %s", invalidUnsubscribeTokenError.reason)
+}
+
+// encode returns the token as "<payload>.<signature>", both base64 URL encoded.
+func (token UnsubscribeToken) encode(secret []byte) (string, error) {
+	payload, err := json.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+	return encodedPayload + "." + base64.RawURLEncoding.EncodeToString(signUnsubscribe(secret, encodedPayload)), nil
+}
+
+// signUnsubscribe is the HMAC SHA256 of the encoded token payload.
+func signUnsubscribe(secret []byte, encodedPayload string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(encodedPayload))
+	return mac.Sum(nil)
+}
+
+// ParseUnsubscribeToken verifies the signature of a token created for an unsubscribe link with the secret configured
+// with [AppWithUnsubscribe].
+func ParseUnsubscribeToken(app *App, token string) (UnsubscribeToken, error) {
+	if app.unsubscribe == nil {
+		return UnsubscribeToken{}, errNoUnsubscribe
+	}
+
+	encodedPayload, encodedSignature, ok := strings.Cut(token, ".")
+	if !ok {
+		return UnsubscribeToken{}, InvalidUnsubscribeTokenError{reason: "malformed"}
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, signUnsubscribe(app.unsubscribe.secret, encodedPayload)) {
+		return UnsubscribeToken{}, InvalidUnsubscribeTokenError{reason: "signature does not match"}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return UnsubscribeToken{}, InvalidUnsubscribeTokenError{reason: "malformed"}
+	}
+
+	var parsed UnsubscribeToken
+	if err := json.Unmarshal(payload, &parsed); err != nil || parsed.Email == "" {
+		return UnsubscribeToken{}, InvalidUnsubscribeTokenError{reason: "malformed"}
+	}
+	return parsed, nil
+}
+
+// errNoUnsubscribe is returned when unsubscribe functionality is used without [AppWithUnsubscribe].
+var errNoUnsubscribe = errors.New("unsubscribe links are not configured")
+
+// unsubscribeURL builds the signed unsubscribe link for a single recipient of the email.
+func unsubscribeURL(app *App, eventData EventData) (string, error) {
+	if app.unsubscribe == nil {
+		return "", errNoUnsubscribe
+	}
+	if len(eventData.To) != 1 {
+		return "", errors.New("unsubscribe links require a single \"to\", use \"recipients\" to send individually")
+	}
+
+	token, err := UnsubscribeToken{
+		Email:    normalizeEmail(eventData.To[0]),
+		Category: eventData.Category,
+		Sender:   normalizeEmail(eventData.Sender),
+	}.encode(app.unsubscribe.secret)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(app.unsubscribe.baseURL)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Set(unsubscribeTokenParam, token)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// unsubscribeHeaders returns the RFC 8058 one-click unsubscribe headers for emails with an [EventData.Category] sent
+// to a single recipient, other emails get no headers.
+func unsubscribeHeaders(app *App, eventData EventData) (map[string]string, error) {
+	if app.unsubscribe == nil || eventData.Category == "" || len(eventData.To) != 1 {
+		return nil, nil
+	}
+
+	link, err := unsubscribeURL(app, eventData)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		"List-Unsubscribe":      "<" + link + ">",
+		"List-Unsubscribe-Post": oneClickUnsubscribe,
+	}, nil
+}
+
+// messageTemplateFuncs are the App template functions along with the functions which depend on the email being
+// rendered i.e. unsubscribeURL.
+func messageTemplateFuncs(app *App, eventData EventData) htmlTemplate.FuncMap {
+	funcs := make(htmlTemplate.FuncMap, len(app.templateFuncs)+1)
+	for name, fn := range app.templateFuncs {
+		funcs[name] = fn
+	}
+	funcs["unsubscribeURL"] = func() (htmlTemplate.URL, error) {
+		if len(eventData.To) == 0 {
+			return previewUnsubscribeURL, nil
+		}
+		link, err := unsubscribeURL(app, eventData)
+		return htmlTemplate.URL(link), err
+	}
+
+	return funcs
+}
+
+// previewUnsubscribe is the unsubscribeURL template function used when there is no email being rendered i.e. when
+// a template is inspected.
+func previewUnsubscribe() htmlTemplate.URL {
+	return previewUnsubscribeURL
+}
+
+var unsubscribePage = htmlTemplate.Must(htmlTemplate.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Unsubscribe</title></head>
+<body>
+{{ if .Done }}<p>{{ .Email }} has been unsubscribed.</p>{{ else }}
+<form method="post">
+<p>Unsubscribe {{ .Email }}{{ if .Category }} from {{ .Category }} emails{{ end }}?</p>
+<input type="hidden" name="List-Unsubscribe" value="One-Click">
+<button type="submit">Unsubscribe</button>
+</form>
+{{ end }}
+</body>
+</html>`))
+
+// UnsubscribeHandler creates an [http.Handler] for the unsubscribe links configured with [AppWithUnsubscribe]. A POST,
+// including RFC 8058 one-click unsubscribes from email clients, verifies the token and records the unsubscribe with
+// [RecordDelivery], which suppresses the recipient for the category or, without a category, the sender domain. A GET
+// shows a confirmation page rather than unsubscribing, so link scanners do not unsubscribe recipients.
+func UnsubscribeHandler(app *App) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		token, err := ParseUnsubscribeToken(app, r.URL.Query().Get(unsubscribeTokenParam))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		page := struct {
+			Email    string
+			Category string
+			Done     bool
+		}{Email: token.Email, Category: token.Category}
+		if r.Method == http.MethodPost {
+			err := RecordDelivery(r.Context(), app, DeliveryEvent{
+				Recipient: token.Email,
+				Status:    StatusUnsubscribed,
+				Sender:    token.Sender,
+				Category:  token.Category,
+			})
+			if err != nil {
+				app.errorLogger.Printf("failed to unsubscribe %s - %v", token.Email, err)
+				http.Error(w, "failed to unsubscribe", http.StatusInternalServerError)
+				return
+			}
+			page.Done = true
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := unsubscribePage.Execute(w, page); err != nil {
+			app.errorLogger.Printf("failed to write unsubscribe page - %v", err)
+		}
+	})
+}
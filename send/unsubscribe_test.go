@@ -0,0 +1,164 @@
+package send_test
+
+import (
+	"context"
+	"github.com/itmayziii/email/send"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+var unsubscribeSecret = []byte("secret")
+
+// sendUnsubscribable sends an email with an unsubscribe link in the body and returns the message that was sent.
+func sendUnsubscribable(t *testing.T, app *send.App, sender *recordingSender) send.Message {
+	t.Helper()
+	err := send.EmailEvent(app)(context.Background(), newEvent(t, map[string]interface{}{
+		"sender":   "no-reply@example.com",
+		"subject":  "test",
+		"to":       "Tom@example.com",
+		"body":     `<a href="{{ unsubscribeURL }}">Unsubscribe</a>`,
+		"category": "newsletter",
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sender.messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(sender.messages))
+	}
+
+	return sender.messages[0]
+}
+
+func TestEmailEvent_UnsubscribeHeaders(t *testing.T) {
+	t.Parallel()
+	sender := &recordingSender{}
+	app := send.NewApp(
+		send.AppWithDomainSender("example.com", sender),
+		send.AppWithUnsubscribe("https://example.com/unsubscribe", unsubscribeSecret),
+	)
+
+	message := sendUnsubscribable(t, app, sender)
+	listUnsubscribe := message.Headers["List-Unsubscribe"]
+	if !strings.HasPrefix(listUnsubscribe, "<https://example.com/unsubscribe?token=") {
+		t.Fatalf("unexpected List-Unsubscribe header %q", listUnsubscribe)
+	}
+	if message.Headers["List-Unsubscribe-Post"] != "List-Unsubscribe=One-Click" {
+		t.Errorf("unexpected List-Unsubscribe-Post header %q", message.Headers["List-Unsubscribe-Post"])
+	}
+	link := strings.Trim(listUnsubscribe, "<>")
+	if !strings.Contains(message.Body, link) {
+		t.Errorf("expected body to link to %s, got %s", link, message.Body)
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := send.ParseUnsubscribeToken(app, u.Query().Get("token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := send.UnsubscribeToken{Email: "tom@example.com", Category: "newsletter", Sender: "no-reply@example.com"}
+	if token != expected {
+		t.Errorf("expected token %+v, got %+v", expected, token)
+	}
+}
+
+func TestEmailEvent_UnsubscribeURLNotConfigured(t *testing.T) {
+	t.Parallel()
+	app := send.NewApp(send.AppWithDomainSender("example.com", &recordingSender{}))
+
+	err := send.EmailEvent(app)(context.Background(), newEvent(t, map[string]interface{}{
+		"sender":  "no-reply@example.com",
+		"subject": "test",
+		"to":      "tom@example.com",
+		"body":    `<a href="{{ unsubscribeURL }}">Unsubscribe</a>`,
+	}))
+	if err == nil {
+		t.Fatal("expected an error when unsubscribe links are not configured")
+	}
+}
+
+func TestParseUnsubscribeToken_Invalid(t *testing.T) {
+	t.Parallel()
+	sender := &recordingSender{}
+	app := send.NewApp(
+		send.AppWithDomainSender("example.com", sender),
+		send.AppWithUnsubscribe("https://example.com/unsubscribe", unsubscribeSecret),
+	)
+	u, err := url.Parse(strings.Trim(sendUnsubscribable(t, app, sender).Headers["List-Unsubscribe"], "<>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := u.Query().Get("token")
+	payload, _, _ := strings.Cut(token, ".")
+
+	otherApp := send.NewApp(send.AppWithUnsubscribe("https://example.com/unsubscribe", []byte("other")))
+	tests := []struct {
+		name  string
+		app   *send.App
+		token string
+	}{
+		{"empty", app, ""},
+		{"no signature", app, payload},
+		{"tampered payload", app, "e30" + token},
+		{"wrong secret", otherApp, token},
+	}
+
+	for _, tt := range tests {
+		ttCopy := tt
+		t.Run(ttCopy.name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := send.ParseUnsubscribeToken(ttCopy.app, ttCopy.token); err == nil {
+				t.Errorf("case: \"%s\", expected an error", ttCopy.name)
+			}
+		})
+	}
+}
+
+func TestUnsubscribeHandler(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	sender := &recordingSender{}
+	suppressions := send.NewMemorySuppressionStore()
+	app := send.NewApp(
+		send.AppWithDomainSender("example.com", sender),
+		send.AppWithSuppressionStore(suppressions),
+		send.AppWithUnsubscribe("https://example.com/unsubscribe", unsubscribeSecret),
+	)
+	link := strings.Trim(sendUnsubscribable(t, app, sender).Headers["List-Unsubscribe"], "<>")
+	handler := send.UnsubscribeHandler(app)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, link, nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<form") {
+		t.Fatalf("expected a confirmation page, got %d - %s", rec.Code, rec.Body)
+	}
+	if found, _ := suppressions.Find(ctx, []string{"tom@example.com"}); len(found) != 0 {
+		t.Fatalf("expected GET not to unsubscribe, got %+v", found)
+	}
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, link, strings.NewReader("List-Unsubscribe=One-Click"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200 but got %d - %s", rec.Code, rec.Body)
+	}
+	found, err := suppressions.Find(ctx, []string{"tom@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Scope != (send.SuppressionScope{Category: "newsletter"}) {
+		t.Errorf("expected a newsletter suppression, got %+v", found)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "https://example.com/unsubscribe?token=forged", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid token but got %d", rec.Code)
+	}
+}
@@ -0,0 +1,412 @@
+package send
+
+import (
+	"cloud.google.com/go/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cbroglie/mustache"
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+	"gopkg.in/yaml.v3"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// manifestSuffix is appended to a template name, without its extension, to find the manifest of published
+	// versions i.e. emails/welcome.html -> emails/welcome.manifest.json.
+	manifestSuffix = ".manifest.json"
+	// versionSeparator separates a template name from the version in a template reference i.e. welcome.html@v3.
+	versionSeparator = "@"
+	// LatestVersion resolves to the version the template manifest marks as latest.
+	LatestVersion = "latest"
+	// versionsDir is the directory published versions of templates, along with the files they depend on, are copied
+	// to.
+	versionsDir = ".versions"
+)
+
+// TemplateVersion is a single published version of a template.
+type TemplateVersion struct {
+	Version     string    `json:"version"`
+	PublishedAt time.Time `json:"publishedAt"`
+	// Root is the file storage prefix the template and the files it depends on were copied under, so the version
+	// resolves partials, stylesheets, and schemas from the copies. It is empty for versions published before
+	// dependencies were versioned, which only have a copy of the template and its sidecar schema.
+	Root string `json:"root,omitempty"`
+	// Files are the working copies which were copied to publish the version, the template first.
+	Files []string `json:"files,omitempty"`
+}
+
+// TemplateManifest lists the published versions of a template, oldest first, and which version "@latest" resolves to.
+type TemplateManifest struct {
+	Latest   string            `json:"latest"`
+	Versions []TemplateVersion `json:"versions"`
+}
+
+// findVersion returns the published version, false when it has not been published.
+func (manifest TemplateManifest) findVersion(version string) (TemplateVersion, bool) {
+	for _, v := range manifest.Versions {
+		if v.Version == version {
+			return v, true
+		}
+	}
+
+	return TemplateVersion{}, false
+}
+
+// TemplateVersionError represents an error that occurs when a template version can not be resolved, published, or
+// rolled back.
+type TemplateVersionError struct {
+	templateName string
+	version      string
+	err          error
+}
+
+func (templateVersionError TemplateVersionError) Error() string {
+	return fmt.Sprintf(
+		"template %s version \"%s\" - %v",
+		templateVersionError.templateName,
+		templateVersionError.version,
+		templateVersionError.err,
+	)
+}
+
+func (templateVersionError TemplateVersionError) Unwrap() error {
+	return templateVersionError.err
+}
+
+var (
+	// errNoManifest is returned when a template has never been published.
+	errNoManifest = errors.New("template has no published versions")
+	// errNotPublished is returned for a version which is not in the template manifest.
+	errNotPublished = errors.New("not published")
+	// errConcurrentPublish is returned when the template manifest or version was changed while it was being published.
+	errConcurrentPublish = errors.New("changed by another publish or rollback, try again")
+	// errNoExtension is returned for a reference without an extension to a version which does not record the template
+	// file it was published from.
+	errNoExtension = errors.New("published before dependencies were versioned, reference it with its extension")
+)
+
+// splitTemplateVersion splits a template reference i.e. "welcome.html@v3" into its name and version, the version is
+// empty when the reference is not versioned. Only a "v<N>" or "latest" suffix is a version, so a template named i.e.
+// "promo@2024.html" is not mistaken for one.
+func splitTemplateVersion(reference string) (string, string) {
+	i := strings.LastIndex(reference, versionSeparator)
+	if i == -1 || !isVersion(reference[i+len(versionSeparator):]) {
+		return reference, ""
+	}
+
+	return reference[:i], reference[i+len(versionSeparator):]
+}
+
+// isVersion reports whether the version is [LatestVersion] or a version published by [PublishTemplate] i.e. "v3".
+func isVersion(version string) bool {
+	if version == LatestVersion {
+		return true
+	}
+	if !strings.HasPrefix(version, "v") {
+		return false
+	}
+	n, err := strconv.Atoi(version[1:])
+	return err == nil && n > 0 && strconv.Itoa(n) == version[1:]
+}
+
+// versionedName is the file storage location of a version of a template published without its dependencies, see
+// [TemplateVersion.Root]. The version is placed before the extension so the template engine is still chosen by
+// extension i.e. emails/welcome.html@v3 -> emails/welcome@v3.html.
+func versionedName(name string, version string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + versionSeparator + version + ext
+}
+
+// versionRoot is the file storage prefix a version of a template and the files it depends on are copied under. Every
+// file keeps its full path below the prefix, so relative partials, stylesheets, and schemas resolve to the copies
+// i.e. emails/welcome.html@v3 -> .versions/emails/welcome.html@v3/emails/welcome.html.
+func versionRoot(name string, version string) string {
+	return path.Join(versionsDir, name+versionSeparator+version) + "/"
+}
+
+// publishedRoot returns the [versionRoot] of a file copied to publish a template version, it is empty for the
+// working copy of a file.
+func publishedRoot(name string) string {
+	if !strings.HasPrefix(name, versionsDir+"/") {
+		return ""
+	}
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		if _, version := splitTemplateVersion(part); version != "" {
+			return strings.Join(parts[:i+1], "/") + "/"
+		}
+	}
+
+	return ""
+}
+
+// isVersionedName reports whether a file in storage is a published version of a template, or a copy of a file it
+// depends on, rather than the working copy.
+func isVersionedName(name string) bool {
+	if strings.HasPrefix(name, versionsDir+"/") {
+		return true
+	}
+	base := path.Base(name)
+	_, version := splitTemplateVersion(strings.TrimSuffix(base, path.Ext(base)))
+	return version != ""
+}
+
+// manifestName is the file storage location of a template manifest.
+func manifestName(name string) string {
+	return strings.TrimSuffix(name, path.Ext(name)) + manifestSuffix
+}
+
+// resolveTemplateVersion replaces a versioned [EventData.Template] i.e. "welcome.html@v3", "welcome@v3", or
+// "welcome.html@latest" with the file storage location of that version and returns the resolved version. The version
+// must be in the template manifest. Templates without a version are returned unchanged and read from the working copy.
+func resolveTemplateVersion(ctx context.Context, app *App, eventData EventData) (EventData, string, error) {
+	name, version := splitTemplateVersion(eventData.Template)
+	if version == "" {
+		return eventData, "", nil
+	}
+
+	manifest, err := ReadTemplateManifest(ctx, app, name)
+	if err != nil {
+		return eventData, "", TemplateVersionError{templateName: name, version: version, err: errors.Unwrap(err)}
+	}
+	if version == LatestVersion {
+		if manifest.Latest == "" {
+			return eventData, "", TemplateVersionError{templateName: name, version: version, err: errNoManifest}
+		}
+		version = manifest.Latest
+	}
+	published, ok := manifest.findVersion(version)
+	if !ok {
+		return eventData, "", TemplateVersionError{templateName: name, version: version, err: errNotPublished}
+	}
+
+	if published.Root == "" {
+		if path.Ext(name) == "" {
+			return eventData, "", TemplateVersionError{templateName: name, version: version, err: errNoExtension}
+		}
+		eventData.Template = versionedName(name, version)
+		return eventData, version, nil
+	}
+	// A reference without an extension i.e. "welcome@v3" resolves to the template file which was published.
+	if path.Ext(name) == "" && len(published.Files) > 0 && manifestName(published.Files[0]) == manifestName(name) {
+		name = published.Files[0]
+	}
+	eventData.Template = published.Root + name
+	return eventData, version, nil
+}
+
+// ReadTemplateManifest reads the manifest of published versions of a template.
+func ReadTemplateManifest(ctx context.Context, app *App, name string) (TemplateManifest, error) {
+	manifest, _, err := readTemplateManifest(ctx, app, name)
+	return manifest, err
+}
+
+// readTemplateManifest reads the manifest of published versions of a template along with its GCS generation, which is
+// 0 when the manifest does not exist or the storage is not GCS, see [writeTemplateManifest].
+func readTemplateManifest(ctx context.Context, app *App, name string) (TemplateManifest, int64, error) {
+	reader, err := app.fileStorage.NewReader(ctx, manifestName(name), nil)
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return TemplateManifest{}, 0, TemplateVersionError{templateName: name, version: LatestVersion, err: errNoManifest}
+	}
+	if err != nil {
+		return TemplateManifest{}, 0, TemplateVersionError{templateName: name, version: LatestVersion, err: err}
+	}
+	defer func() { _ = reader.Close() }()
+
+	var manifest TemplateManifest
+	if err := json.NewDecoder(reader).Decode(&manifest); err != nil {
+		return TemplateManifest{}, 0, TemplateVersionError{templateName: name, version: LatestVersion, err: err}
+	}
+	var generation int64
+	var gcsReader *storage.Reader
+	if reader.As(&gcsReader) {
+		generation = gcsReader.Attrs.Generation
+	}
+	return manifest, generation, nil
+}
+
+// PublishTemplate copies the working copy of a template, along with the files it depends on, to the next version
+// i.e. emails/welcome.html -> .versions/emails/welcome.html@v4/emails/welcome.html and marks it as the latest version.
+// The dependencies are the sidecar schema, a schema path in the front matter, Mustache partials, and linked
+// stylesheets, they are copied to the same path below the version so the version never reads a working copy.
+// Published versions are never modified, so emails referencing a pinned version are unaffected by later edits.
+//
+// Publishing fails rather than overwriting a version when the template is published concurrently, the version is
+// refused when it was already copied and, on GCS, the manifest is only written when it was not changed since it was
+// read.
+func PublishTemplate(ctx context.Context, app *App, name string) (TemplateVersion, error) {
+	manifest, generation, err := readTemplateManifest(ctx, app, name)
+	if err != nil && !errors.Is(err, errNoManifest) {
+		return TemplateVersion{}, err
+	}
+
+	version := "v" + strconv.Itoa(len(manifest.Versions)+1)
+	published := TemplateVersion{Version: version, PublishedAt: time.Now().UTC(), Root: versionRoot(name, version)}
+	exists, err := app.fileStorage.Exists(ctx, published.Root+name)
+	if err != nil {
+		return TemplateVersion{}, TemplateVersionError{templateName: name, version: version, err: err}
+	}
+	if exists {
+		return TemplateVersion{}, TemplateVersionError{templateName: name, version: version, err: errConcurrentPublish}
+	}
+	published.Files, err = TemplateFiles(ctx, app, name)
+	if err != nil {
+		return TemplateVersion{}, TemplateVersionError{templateName: name, version: version, err: err}
+	}
+	for _, file := range published.Files {
+		if err := app.fileStorage.Copy(ctx, published.Root+file, file, nil); err != nil {
+			return TemplateVersion{}, TemplateVersionError{templateName: name, version: version, err: err}
+		}
+	}
+
+	manifest.Latest = published.Version
+	manifest.Versions = append(manifest.Versions, published)
+	if err := writeTemplateManifest(ctx, app, name, manifest, generation); err != nil {
+		return TemplateVersion{}, TemplateVersionError{templateName: name, version: version, err: err}
+	}
+	return published, nil
+}
+
+// TemplateFiles returns the template and the files in storage it depends on, the sidecar schema, a schema path in the
+// front matter, Mustache partials, and linked stylesheets, with the template first. Partials and a schema path in the
+// front matter must exist, the sidecar schema and stylesheets are optional as they are only read when they exist or
+// CSS inlining is enabled.
+func TemplateFiles(ctx context.Context, app *App, name string) ([]string, error) {
+	source, err := readTemplate(ctx, app, name)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{name}
+	seen := map[string]bool{name: true}
+	addOptional := func(file string) error {
+		if seen[file] {
+			return nil
+		}
+		exists, err := app.fileStorage.Exists(ctx, file)
+		if err != nil {
+			return err
+		}
+		if exists {
+			seen[file] = true
+			files = append(files, file)
+		}
+		return nil
+	}
+
+	if err := addOptional(strings.TrimSuffix(name, path.Ext(name)) + schemaSuffix); err != nil {
+		return nil, err
+	}
+	rawFrontMatter, body := splitFrontMatter(source)
+	var matter frontMatter
+	if err := yaml.Unmarshal([]byte(rawFrontMatter), &matter); err != nil {
+		return nil, fmt.Errorf("invalid front matter in template %s - %v", name, err)
+	}
+	if schema, ok := matter.Schema.(string); ok {
+		location := path.Join(path.Dir(name), schema)
+		if _, err := app.fileStorage.ReadAll(ctx, location); err != nil {
+			return nil, fmt.Errorf("failed to read schema %s - %v", location, err)
+		}
+		seen[location] = true
+		files = append(files, location)
+	}
+
+	// Partials are resolved relative to the template they are included in, including partials of partials.
+	sources := []string{body}
+	partials := &bucketPartialProvider{ctx: ctx, fileStorage: app.fileStorage, template: name}
+	for i := 0; i < len(sources); i++ {
+		parsed, err := mustache.ParseString(sources[i])
+		if err != nil {
+			// Go templates are not valid Mustache and do not have partials.
+			continue
+		}
+		for _, partial := range mustachePartials(parsed.Tags()) {
+			location, contents, err := partials.find(partial)
+			if err != nil {
+				return nil, err
+			}
+			if seen[location] {
+				continue
+			}
+			seen[location] = true
+			files = append(files, location)
+			sources = append(sources, contents)
+		}
+	}
+
+	for _, source := range sources {
+		for _, stylesheet := range linkedStylesheets(source) {
+			if err := addOptional(stylesheetName(name, stylesheet)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// RollbackTemplate marks a previously published version as the latest version. When version is empty the version
+// published before the current latest version is used.
+func RollbackTemplate(ctx context.Context, app *App, name string, version string) (TemplateManifest, error) {
+	manifest, generation, err := readTemplateManifest(ctx, app, name)
+	if err != nil {
+		return manifest, err
+	}
+
+	if version == "" {
+		for i, v := range manifest.Versions {
+			if v.Version == manifest.Latest && i > 0 {
+				version = manifest.Versions[i-1].Version
+			}
+		}
+		if version == "" {
+			return manifest, TemplateVersionError{
+				templateName: name,
+				version:      manifest.Latest,
+				err:          errors.New("there is no earlier version to roll back to"),
+			}
+		}
+	}
+	if _, ok := manifest.findVersion(version); !ok {
+		return manifest, TemplateVersionError{templateName: name, version: version, err: errNotPublished}
+	}
+
+	manifest.Latest = version
+	if err := writeTemplateManifest(ctx, app, name, manifest, generation); err != nil {
+		return manifest, TemplateVersionError{templateName: name, version: version, err: err}
+	}
+	return manifest, nil
+}
+
+// writeTemplateManifest writes the manifest of published versions of a template. On GCS the manifest is only written
+// when its generation still matches the generation it was read at, or when it still does not exist for generation 0,
+// so a manifest changed by a concurrent publish is not overwritten.
+func writeTemplateManifest(ctx context.Context, app *App, name string, manifest TemplateManifest, generation int64) error {
+	contents, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	conditions := storage.Conditions{DoesNotExist: true}
+	if generation != 0 {
+		conditions = storage.Conditions{GenerationMatch: generation}
+	}
+	err = app.fileStorage.WriteAll(ctx, manifestName(name), contents, &blob.WriterOptions{
+		BeforeWrite: func(asFunc func(interface{}) bool) error {
+			var object **storage.ObjectHandle
+			if asFunc(&object) {
+				*object = (*object).If(conditions)
+			}
+			return nil
+		},
+	})
+	if gcerrors.Code(err) == gcerrors.FailedPrecondition {
+		return errConcurrentPublish
+	}
+	return err
+}
@@ -0,0 +1,220 @@
+package send_test
+
+import (
+	"context"
+	"errors"
+	"github.com/itmayziii/email/send"
+	"gocloud.dev/blob/memblob"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEmailEvent_VersionedTemplates(t *testing.T) {
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	t.Cleanup(func() { _ = bucket.Close() })
+	app := send.NewApp(send.AppWithFileStorage(bucket))
+
+	for _, contents := range []string{"<p>v1 {{ .Name }}</p>", "<p>v2 {{ .Name }}</p>"} {
+		if err := bucket.WriteAll(ctx, "emails/welcome.html", []byte(contents), nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := send.PublishTemplate(ctx, app, "emails/welcome.html"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bucket.WriteAll(ctx, "emails/welcome.html", []byte("<p>draft {{ .Name }}</p>"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	sendTemplate := func(template string) string {
+		sender := &recordingSender{}
+		app := send.NewApp(send.AppWithFileStorage(bucket), send.AppWithDomainSender("example.com", sender))
+		err := send.EmailEvent(app)(ctx, newEvent(t, map[string]interface{}{
+			"sender":   "no-reply@example.com",
+			"subject":  "test",
+			"to":       "tom@example.com",
+			"template": template,
+			"data":     map[string]interface{}{"name": "Tommy"},
+		}))
+		if err != nil {
+			t.Fatalf("template: \"%s\", unexpected error: %v", template, err)
+		}
+		return sender.messages[0].Body
+	}
+
+	expected := map[string]string{
+		"emails/welcome.html":        "<p>draft Tommy</p>",
+		"emails/welcome.html@v1":     "<p>v1 Tommy</p>",
+		"emails/welcome@v1":          "<p>v1 Tommy</p>",
+		"emails/welcome.html@latest": "<p>v2 Tommy</p>",
+		"emails/welcome@latest":      "<p>v2 Tommy</p>",
+	}
+	for template, body := range expected {
+		if actual := sendTemplate(template); actual != body {
+			t.Errorf("template: \"%s\", expected body %q to match %q", template, actual, body)
+		}
+	}
+
+	manifest, err := send.RollbackTemplate(ctx, app, "emails/welcome.html", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Latest != "v1" || len(manifest.Versions) != 2 {
+		t.Errorf("expected rollback to v1 with 2 versions, got %+v", manifest)
+	}
+	if actual := sendTemplate("emails/welcome.html@latest"); actual != "<p>v1 Tommy</p>" {
+		t.Errorf("expected rolled back body %q to match %q", actual, "<p>v1 Tommy</p>")
+	}
+
+	if _, err := send.RollbackTemplate(ctx, app, "emails/welcome.html", ""); err == nil {
+		t.Errorf("expected error rolling back past the first version")
+	}
+	if _, err := send.RollbackTemplate(ctx, app, "emails/welcome.html", "v9"); err == nil {
+		t.Errorf("expected error rolling back to an unpublished version")
+	}
+}
+
+func TestEmailEvent_AtInTemplateName(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	t.Cleanup(func() { _ = bucket.Close() })
+	if err := bucket.WriteAll(ctx, "emails/promo@2024.html", []byte("<p>promo {{ .Name }}</p>"), nil); err != nil {
+		t.Fatal(err)
+	}
+	sender := &recordingSender{}
+	app := send.NewApp(send.AppWithFileStorage(bucket), send.AppWithDomainSender("example.com", sender))
+
+	err := send.EmailEvent(app)(ctx, newEvent(t, map[string]interface{}{
+		"sender":   "no-reply@example.com",
+		"subject":  "test",
+		"to":       "tom@example.com",
+		"template": "emails/promo@2024.html",
+		"data":     map[string]interface{}{"name": "Tommy"},
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if body := sender.messages[0].Body; body != "<p>promo Tommy</p>" {
+		t.Errorf("expected body %q to match %q", body, "<p>promo Tommy</p>")
+	}
+}
+
+func TestEmailEvent_LatestWithoutManifest(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	t.Cleanup(func() { _ = bucket.Close() })
+	app := send.NewApp(send.AppWithFileStorage(bucket))
+
+	_, err := app.Render(ctx, send.EventData{
+		Sender:   "no-reply@example.com",
+		Subject:  "test",
+		To:       send.MessageTo{"tom@example.com"},
+		Template: "emails/welcome.html@latest",
+	})
+	var versionErr send.TemplateVersionError
+	if !errors.As(err, &versionErr) {
+		t.Errorf("expected TemplateVersionError, got %v", err)
+	}
+}
+
+func TestEmailEvent_VersionedTemplateDependencies(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	t.Cleanup(func() { _ = bucket.Close() })
+	app := send.NewApp(send.AppWithFileStorage(bucket), send.AppWithInlineCSS())
+
+	files := map[string]string{
+		"emails/welcome.mustache":   "---\nschema: welcome.json\n---\n<link rel=\"stylesheet\" href=\"/styles/main.css\"><p>{{> header}} {{name}}</p>",
+		"emails/header.mustache":    "v1 header",
+		"emails/welcome.json":       `{"type": "object", "required": ["name"]}`,
+		"styles/main.css":           "p { color: red; }",
+		"emails/unrelated.mustache": "not a dependency",
+	}
+	for name, contents := range files {
+		if err := bucket.WriteAll(ctx, name, []byte(contents), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	published, err := send.PublishTemplate(ctx, app, "emails/welcome.mustache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedFiles := []string{"emails/welcome.mustache", "emails/welcome.json", "emails/header.mustache", "styles/main.css"}
+	if !reflect.DeepEqual(published.Files, expectedFiles) {
+		t.Errorf("expected published files %v, got %v", expectedFiles, published.Files)
+	}
+
+	edits := map[string]string{
+		"emails/header.mustache": "draft header",
+		"emails/welcome.json":    `{"type": "object", "required": ["name", "email"]}`,
+		"styles/main.css":        "p { color: blue; }",
+	}
+	for name, contents := range edits {
+		if err := bucket.WriteAll(ctx, name, []byte(contents), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sender := &recordingSender{}
+	app = send.NewApp(send.AppWithFileStorage(bucket), send.AppWithDomainSender("example.com", sender), send.AppWithInlineCSS())
+	sendTemplate := func(template string) error {
+		return send.EmailEvent(app)(ctx, newEvent(t, map[string]interface{}{
+			"sender":   "no-reply@example.com",
+			"subject":  "test",
+			"to":       "tom@example.com",
+			"template": template,
+			"data":     map[string]interface{}{"name": "Tommy"},
+		}))
+	}
+
+	if err := sendTemplate("emails/welcome.mustache@v1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body := sender.messages[0].Body
+	if !strings.Contains(body, "v1 header Tommy") || !strings.Contains(body, "color: red") {
+		t.Errorf("expected the published partial and stylesheet, got %q", body)
+	}
+	if err := sendTemplate("emails/welcome.mustache"); err == nil {
+		t.Errorf("expected the edited working copy schema to require an email")
+	}
+	var versionErr send.TemplateVersionError
+	if err := sendTemplate("emails/welcome.mustache@v2"); !errors.As(err, &versionErr) {
+		t.Errorf("expected TemplateVersionError for an unpublished version, got %v", err)
+	}
+}
+
+func TestPublishTemplate_RefusesAnExistingVersion(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	t.Cleanup(func() { _ = bucket.Close() })
+	app := send.NewApp(send.AppWithFileStorage(bucket))
+
+	// A concurrent publish which copied v1 but has not written the manifest yet.
+	files := map[string]string{
+		"emails/welcome.html": "<p>draft</p>",
+		".versions/emails/welcome.html@v1/emails/welcome.html": "<p>v1</p>",
+	}
+	for name, contents := range files {
+		if err := bucket.WriteAll(ctx, name, []byte(contents), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var versionErr send.TemplateVersionError
+	if _, err := send.PublishTemplate(ctx, app, "emails/welcome.html"); !errors.As(err, &versionErr) {
+		t.Errorf("expected TemplateVersionError, got %v", err)
+	}
+	contents, err := bucket.ReadAll(ctx, ".versions/emails/welcome.html@v1/emails/welcome.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != "<p>v1</p>" {
+		t.Errorf("expected the published version %q to be unchanged", contents)
+	}
+}
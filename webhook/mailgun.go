@@ -0,0 +1,191 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/itmayziii/email/send"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	mailgunProvider = "mailgun"
+	// mailgunMaxAge is how old a Mailgun webhook signature can be before it is rejected, tokens of newer signatures are
+	// remembered so they can not be replayed.
+	mailgunMaxAge = 5 * time.Minute
+)
+
+// MailgunParser is a [Parser] for [Mailgun webhooks].
+//
+// [Mailgun webhooks]: https://documentation.mailgun.com/docs/mailgun/user-manual/tracking-messages/#webhooks
+type MailgunParser struct {
+	signingKey string
+	now        func() time.Time
+	tokens     *tokenCache
+}
+
+// NewMailgunParser constructs a [MailgunParser] which verifies webhooks with the HTTP webhook signing key from the
+// Mailgun dashboard. Every signature token is only accepted once, Mailgun signs each attempt to deliver a webhook
+// with a new token so retries are still accepted.
+func NewMailgunParser(signingKey string) MailgunParser {
+	return MailgunParser{signingKey: signingKey, now: time.Now, tokens: newTokenCache()}
+}
+
+// tokenCache remembers the signature tokens seen within [mailgunMaxAge], older signatures are rejected as expired
+// so their tokens do not need to be remembered. It is safe for concurrent use.
+type tokenCache struct {
+	mu     sync.Mutex
+	tokens map[string]time.Time
+}
+
+func newTokenCache() *tokenCache {
+	return &tokenCache{tokens: make(map[string]time.Time)}
+}
+
+// add remembers the token until it expires and reports whether it was not seen before.
+func (cache *tokenCache) add(token string, now time.Time) bool {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	for seen, expires := range cache.tokens {
+		if now.After(expires) {
+			delete(cache.tokens, seen)
+		}
+	}
+	if _, ok := cache.tokens[token]; ok {
+		return false
+	}
+
+	cache.tokens[token] = now.Add(2 * mailgunMaxAge)
+	return true
+}
+
+type mailgunWebhook struct {
+	Signature struct {
+		Timestamp string `json:"timestamp"`
+		Token     string `json:"token"`
+		Signature string `json:"signature"`
+	} `json:"signature"`
+	EventData struct {
+		ID        string  `json:"id"`
+		Event     string  `json:"event"`
+		Timestamp float64 `json:"timestamp"`
+		Severity  string  `json:"severity"`
+		Reason    string  `json:"reason"`
+		Recipient string  `json:"recipient"`
+		Message   struct {
+			Headers struct {
+				MessageID string `json:"message-id"`
+				From      string `json:"from"`
+				Subject   string `json:"subject"`
+			} `json:"headers"`
+		} `json:"message"`
+		DeliveryStatus struct {
+			Message     string `json:"message"`
+			Description string `json:"description"`
+		} `json:"delivery-status"`
+		UserVariables map[string]interface{} `json:"user-variables"`
+	} `json:"event-data"`
+}
+
+func (parser MailgunParser) Parse(r *http.Request) ([]send.DeliveryEvent, error) {
+	var payload mailgunWebhook
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return nil, PayloadError{err: err}
+	}
+	if err := parser.verify(payload); err != nil {
+		return nil, err
+	}
+
+	data := payload.EventData
+	status, ok := mailgunStatus(data.Event, data.Severity)
+	if !ok {
+		return nil, nil
+	}
+	seconds, fraction := math.Modf(data.Timestamp)
+	event := send.DeliveryEvent{
+		ID:        data.ID,
+		MessageID: data.Message.Headers.MessageID,
+		Recipient: data.Recipient,
+		Status:    status,
+		Reason:    mailgunReason(data.Reason, data.DeliveryStatus.Message, data.DeliveryStatus.Description),
+		Provider:  mailgunProvider,
+		Sender:    data.Message.Headers.From,
+		Subject:   data.Message.Headers.Subject,
+		Timestamp: time.Unix(int64(seconds), int64(fraction*float64(time.Second))).UTC(),
+	}
+	if category, ok := data.UserVariables["category"].(string); ok {
+		event.Category = category
+	}
+
+	return []send.DeliveryEvent{event}, nil
+}
+
+// verify checks the signature is the HMAC SHA256 of the timestamp and token with the signing key, that the signature
+// is recent, and that the token has not been used before.
+func (parser MailgunParser) verify(payload mailgunWebhook) error {
+	signature := payload.Signature
+	if signature.Signature == "" || signature.Token == "" || signature.Timestamp == "" {
+		return SignatureError{reason: "missing signature"}
+	}
+
+	mac := hmac.New(sha256.New, []byte(parser.signingKey))
+	mac.Write([]byte(signature.Timestamp + signature.Token))
+	expected := mac.Sum(nil)
+	actual, err := hex.DecodeString(signature.Signature)
+	if err != nil || !hmac.Equal(actual, expected) {
+		return SignatureError{reason: "signature does not match"}
+	}
+
+	timestamp, err := strconv.ParseInt(signature.Timestamp, 10, 64)
+	if err != nil {
+		return SignatureError{reason: "invalid timestamp"}
+	}
+	age := parser.now().Sub(time.Unix(timestamp, 0))
+	if age > mailgunMaxAge || age < -mailgunMaxAge {
+		return SignatureError{reason: "signature has expired"}
+	}
+	if !parser.tokens.add(signature.Token, parser.now()) {
+		return SignatureError{reason: "token has already been used"}
+	}
+
+	return nil
+}
+
+// mailgunStatus maps a Mailgun event to a [send.DeliveryStatus], "accepted" and "stored" events are ignored.
+func mailgunStatus(event string, severity string) (send.DeliveryStatus, bool) {
+	switch event {
+	case "delivered":
+		return send.StatusDelivered, true
+	case "failed":
+		if severity == "temporary" {
+			return send.StatusDeferred, true
+		}
+		return send.StatusBounced, true
+	case "complained":
+		return send.StatusComplained, true
+	case "unsubscribed":
+		return send.StatusUnsubscribed, true
+	case "opened":
+		return send.StatusOpened, true
+	case "clicked":
+		return send.StatusClicked, true
+	}
+
+	return "", false
+}
+
+// mailgunReason picks the most descriptive reason Mailgun provided for a failure.
+func mailgunReason(reasons ...string) string {
+	for _, reason := range reasons {
+		if reason != "" && reason != "generic" {
+			return reason
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,164 @@
+/*
+Package webhook receives delivery, bounce, complaint, and unsubscribe webhooks from email providers. Every webhook is
+verified, normalized into a [send.DeliveryEvent], recorded with [send.RecordDelivery] so the send log and suppression
+list stay up to date, and optionally re-emitted as a CloudEvent i.e. "email.bounced".
+
+	app := send.NewApp(send.AppWithSuppressionStore(store), send.AppWithSendLog(sendLog))
+	http.Handle("/webhooks/mailgun", webhook.NewHandler(app, webhook.NewMailgunParser(os.Getenv("MG_WEBHOOK_KEY"))))
+*/
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/itmayziii/email/send"
+	"io"
+	"log"
+	"net/http"
+)
+
+// cloudEventTypePrefix is prepended to the [send.DeliveryStatus] to form the type of re-emitted CloudEvents.
+const cloudEventTypePrefix = "email."
+
+// Parser verifies the webhook request of an email provider and normalizes it into delivery events. Events the
+// package has no use for i.e. Mailgun "accepted" events are not returned.
+type Parser interface {
+	Parse(r *http.Request) ([]send.DeliveryEvent, error)
+}
+
+// SignatureError represents an error that occurs when a webhook request can not be verified as coming from the
+// email provider.
+type SignatureError struct {
+	reason string
+}
+
+func (signatureError SignatureError) Error() string {
+	return fmt.Sprintf("invalid webhook signature - %s", signatureError.reason)
+}
+
+// PayloadError represents an error that occurs when a webhook request body is not in the expected format.
+type PayloadError struct {
+	err error
+}
+
+func (payloadError PayloadError) Error() string {
+	return fmt.Sprintf("invalid webhook payload - %v", payloadError.err)
+}
+
+func (payloadError PayloadError) Unwrap() error {
+	return payloadError.err
+}
+
+// Handler is an [http.Handler] for email provider webhooks.
+type Handler struct {
+	app          *send.App
+	parser       Parser
+	cloudEvents  cloudevents.Client
+	eventSource  string
+	maxBodyBytes int64
+	errorLogger  *log.Logger
+}
+
+// HandlerOption configures a [Handler].
+type HandlerOption func(*Handler)
+
+// NewHandler is a constructor for [Handler] which utilizes the [options pattern].
+//
+// [options pattern]: https://dave.cheney.net/2014/10/17/functional-options-for-friendly-apis
+func NewHandler(app *send.App, parser Parser, opts ...HandlerOption) *Handler {
+	handler := &Handler{app: app, parser: parser, maxBodyBytes: 1 << 20}
+	for _, opt := range opts {
+		opt(handler)
+	}
+
+	if handler.errorLogger == nil {
+		handler.errorLogger = log.New(io.Discard, "", 0)
+	}
+
+	return handler
+}
+
+// HandlerWithCloudEvents provides an option to re-emit every delivery event as a CloudEvent with the type
+// "email.<status>" i.e. "email.bounced" and the [send.DeliveryEvent] as data. A CloudEvent which fails to be emitted
+// is logged to the error logger rather than failing the webhook, as the email provider retrying it would record the
+// event again.
+func HandlerWithCloudEvents(client cloudevents.Client, source string) HandlerOption {
+	return func(handler *Handler) {
+		handler.cloudEvents = client
+		handler.eventSource = source
+	}
+}
+
+// HandlerWithErrorLogger provides an option to supply an error severity logger, nothing is logged by default.
+func HandlerWithErrorLogger(logger *log.Logger) HandlerOption {
+	return func(handler *Handler) {
+		handler.errorLogger = logger
+	}
+}
+
+// ServeHTTP responds with 401 when the request can not be verified, 400 when the payload is malformed, and 500 when
+// the event could not be recorded so the email provider retries the webhook. Once the event is recorded the response
+// is 200 even when re-emitting it as a CloudEvent failed.
+func (handler *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, handler.maxBodyBytes)
+
+	events, err := handler.parser.Parse(r)
+	var signatureError SignatureError
+	if errors.As(err, &signatureError) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, event := range events {
+		if err := handler.handle(r.Context(), event); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// handle records a single delivery event and re-emits it as a CloudEvent, only failing to record it is returned.
+func (handler *Handler) handle(ctx context.Context, event send.DeliveryEvent) error {
+	if err := send.RecordDelivery(ctx, handler.app, event); err != nil {
+		return fmt.Errorf("failed to record %s event %s - %v", event.Status, event.ID, err)
+	}
+	if handler.cloudEvents == nil {
+		return nil
+	}
+	if err := handler.emit(ctx, event); err != nil {
+		handler.errorLogger.Print(err)
+	}
+	return nil
+}
+
+// emit re-emits a recorded delivery event as a CloudEvent.
+func (handler *Handler) emit(ctx context.Context, event send.DeliveryEvent) error {
+	cloudEvent := cloudevents.NewEvent()
+	cloudEvent.SetID(event.ID)
+	if event.ID == "" {
+		cloudEvent.SetID(fmt.Sprintf("%s-%s-%s", event.MessageID, event.Status, event.Recipient))
+	}
+	cloudEvent.SetSource(handler.eventSource)
+	cloudEvent.SetType(cloudEventTypePrefix + string(event.Status))
+	cloudEvent.SetSubject(event.MessageID)
+	cloudEvent.SetTime(event.Timestamp)
+	if err := cloudEvent.SetData(cloudevents.ApplicationJSON, event); err != nil {
+		return err
+	}
+	if result := handler.cloudEvents.Send(ctx, cloudEvent); !cloudevents.IsACK(result) {
+		return fmt.Errorf("failed to emit %s event %s - %v", cloudEvent.Type(), event.ID, result)
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package webhook_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/protocol"
+	"github.com/itmayziii/email/send"
+	"github.com/itmayziii/email/webhook"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const signingKey = "key-test"
+
+// recordingClient implements [cloudevents.Client] and keeps every event it was asked to send.
+type recordingClient struct {
+	mu     sync.Mutex
+	events []cloudevents.Event
+}
+
+func (rc *recordingClient) Send(ctx context.Context, event cloudevents.Event) protocol.Result {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.events = append(rc.events, event)
+	return protocol.ResultACK
+}
+
+func (rc *recordingClient) Request(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, protocol.Result) {
+	return nil, protocol.ResultACK
+}
+
+func (rc *recordingClient) StartReceiver(ctx context.Context, fn interface{}) error {
+	return nil
+}
+
+// mailgunBody creates a signed Mailgun webhook payload.
+func mailgunBody(t *testing.T, key string, timestamp time.Time, eventData map[string]interface{}) string {
+	t.Helper()
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	token := "a8ce0edb2dd8301dee6c2405235584e45aa91d1e9f979f3de0"
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(ts + token))
+	body, err := json.Marshal(map[string]interface{}{
+		"signature": map[string]interface{}{
+			"timestamp": ts,
+			"token":     token,
+			"signature": hex.EncodeToString(mac.Sum(nil)),
+		},
+		"event-data": eventData,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(body)
+}
+
+func mailgunEvent(event string, severity string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":        "event-" + event,
+		"event":     event,
+		"severity":  severity,
+		"timestamp": 1521472262.908181,
+		"reason":    "bounce",
+		"recipient": "tom@example.com",
+		"message": map[string]interface{}{
+			"headers": map[string]interface{}{
+				"message-id": "20130503182626.18666.16540@example.com",
+				"from":       "Example <no-reply@example.com>",
+				"subject":    "hello",
+			},
+		},
+		"delivery-status": map[string]interface{}{"message": "550 5.1.1 The email account does not exist"},
+	}
+}
+
+func TestHandler_Mailgun(t *testing.T) {
+	tests := []struct {
+		name               string
+		body               string
+		expectedStatus     int
+		expectedDelivery   send.DeliveryStatus
+		expectedSuppressed bool
+	}{
+		{
+			"bounce",
+			mailgunBody(t, signingKey, time.Now(), mailgunEvent("failed", "permanent")),
+			http.StatusOK,
+			send.StatusBounced,
+			true,
+		},
+		{
+			"temporary failure",
+			mailgunBody(t, signingKey, time.Now(), mailgunEvent("failed", "temporary")),
+			http.StatusOK,
+			send.StatusDeferred,
+			false,
+		},
+		{
+			"unsubscribe",
+			mailgunBody(t, signingKey, time.Now(), mailgunEvent("unsubscribed", "")),
+			http.StatusOK,
+			send.StatusUnsubscribed,
+			true,
+		},
+		{
+			"delivered",
+			mailgunBody(t, signingKey, time.Now(), mailgunEvent("delivered", "")),
+			http.StatusOK,
+			send.StatusDelivered,
+			false,
+		},
+		{
+			"ignored event",
+			mailgunBody(t, signingKey, time.Now(), mailgunEvent("accepted", "")),
+			http.StatusOK,
+			"",
+			false,
+		},
+		{
+			"wrong key",
+			mailgunBody(t, "key-wrong", time.Now(), mailgunEvent("failed", "permanent")),
+			http.StatusUnauthorized,
+			"",
+			false,
+		},
+		{
+			"expired",
+			mailgunBody(t, signingKey, time.Now().Add(-time.Hour), mailgunEvent("failed", "permanent")),
+			http.StatusUnauthorized,
+			"",
+			false,
+		},
+		{"malformed", "{", http.StatusBadRequest, "", false},
+	}
+
+	for _, tt := range tests {
+		ttCopy := tt
+		t.Run(ttCopy.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			suppressions := send.NewMemorySuppressionStore()
+			sendLog := send.NewMemorySendLog()
+			client := &recordingClient{}
+			app := send.NewApp(send.AppWithSuppressionStore(suppressions), send.AppWithSendLog(sendLog))
+			handler := webhook.NewHandler(
+				app,
+				webhook.NewMailgunParser(signingKey),
+				webhook.HandlerWithCloudEvents(client, "test"),
+			)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(ttCopy.body)))
+			if rec.Code != ttCopy.expectedStatus {
+				t.Fatalf("case: \"%s\", expected status %d but got %d - %s", ttCopy.name, ttCopy.expectedStatus, rec.Code, rec.Body)
+			}
+
+			events := sendLog.Events()
+			if ttCopy.expectedDelivery == "" {
+				if len(events) != 0 || len(client.events) != 0 {
+					t.Errorf("case: \"%s\", expected no events, got %+v", ttCopy.name, events)
+				}
+				return
+			}
+			if len(events) != 1 || events[0].Status != ttCopy.expectedDelivery {
+				t.Fatalf("case: \"%s\", expected a %s event, got %+v", ttCopy.name, ttCopy.expectedDelivery, events)
+			}
+			if events[0].MessageID != "20130503182626.18666.16540@example.com" || events[0].Provider != "mailgun" {
+				t.Errorf("case: \"%s\", unexpected event %+v", ttCopy.name, events[0])
+			}
+			if len(client.events) != 1 || client.events[0].Type() != "email."+string(ttCopy.expectedDelivery) {
+				t.Errorf("case: \"%s\", expected an email.%s CloudEvent, got %+v", ttCopy.name, ttCopy.expectedDelivery, client.events)
+			}
+
+			found, err := suppressions.Find(ctx, []string{"tom@example.com"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ttCopy.expectedSuppressed != (len(found) == 1) {
+				t.Errorf("case: \"%s\", expected suppressed: %t, got %+v", ttCopy.name, ttCopy.expectedSuppressed, found)
+			}
+		})
+	}
+}
+
+// nackClient implements [cloudevents.Client] and fails to send every event.
+type nackClient struct {
+	recordingClient
+}
+
+func (nc *nackClient) Send(ctx context.Context, event cloudevents.Event) protocol.Result {
+	return errors.New("unavailable")
+}
+
+func TestHandler_RecordedWhenEmitFails(t *testing.T) {
+	t.Parallel()
+	sendLog := send.NewMemorySendLog()
+	var logs bytes.Buffer
+	handler := webhook.NewHandler(
+		send.NewApp(send.AppWithSendLog(sendLog)),
+		webhook.NewMailgunParser(signingKey),
+		webhook.HandlerWithCloudEvents(&nackClient{}, "test"),
+		webhook.HandlerWithErrorLogger(log.New(&logs, "", 0)),
+	)
+
+	body := mailgunBody(t, signingKey, time.Now(), mailgunEvent("delivered", ""))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status %d once the event is recorded, got %d - %s", http.StatusOK, rec.Code, rec.Body)
+	}
+	if len(sendLog.Events()) != 1 {
+		t.Errorf("expected the event to be recorded once, got %+v", sendLog.Events())
+	}
+	if !strings.Contains(logs.String(), "failed to emit email.delivered event") {
+		t.Errorf("expected the failed CloudEvent to be logged, got %q", logs.String())
+	}
+}
+
+func TestHandler_MailgunReplay(t *testing.T) {
+	t.Parallel()
+	sendLog := send.NewMemorySendLog()
+	handler := webhook.NewHandler(send.NewApp(send.AppWithSendLog(sendLog)), webhook.NewMailgunParser(signingKey))
+
+	body := mailgunBody(t, signingKey, time.Now(), mailgunEvent("failed", "permanent"))
+	for i, expected := range []int{http.StatusOK, http.StatusUnauthorized} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+		if rec.Code != expected {
+			t.Errorf("request: %d, expected status %d but got %d - %s", i, expected, rec.Code, rec.Body)
+		}
+	}
+	if len(sendLog.Events()) != 1 {
+		t.Errorf("expected the replayed webhook not to be recorded, got %+v", sendLog.Events())
+	}
+}